@@ -1,11 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/assign"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/journal"
 	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/manager"
 	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/queue"
 )
 
 func main() {
@@ -54,5 +64,337 @@ func main() {
 	disp.Match()
 	disp.PrintStatus()
 
+	// 4. Cancellation: jobs and workers can leave the queues by ID in O(log N).
+	// WorkerC was already matched in Round 3, so removing it reports nil.
+	fmt.Println(">>> Cancelling Job3 and WorkerC")
+	removedJob, _ := disp.RemoveJob("Job3")
+	removedWorker, _ := disp.RemoveWorker("WorkerC")
+	fmt.Printf("Removed: %v\n", removedJob)
+	fmt.Printf("Removed: %v\n", removedWorker)
+	disp.PrintStatus()
+
+	// 5. Scale check: matching cost should stay logarithmic with a large backlog.
+	fmt.Println(">>> Scale Check: 100,000 queued jobs")
+	big := manager.NewDispatcher()
+	big.Silent = true
+	now := time.Now()
+	for i := 0; i < 100000; i++ {
+		big.AddJob(&model.Job{ID: fmt.Sprintf("Bulk_%d", i), ArrivalTime: now.Add(-time.Duration(i) * time.Millisecond), Size: i % 100})
+	}
+	for i := 0; i < 1000; i++ {
+		big.AddWorker(&model.Worker{ID: fmt.Sprintf("BulkWorker_%d", i), AvailableTime: now, Efficiency: 1.0})
+	}
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		big.Match()
+	}
+	dur := time.Since(start)
+	fmt.Printf("1,000 Matches in %s (%.2f us/match)\n", dur, float64(dur.Microseconds())/1000.0)
+	big.PrintStatus()
+
+	// 6. Stale heap check: drive a fake clock and compare every Match against a brute-force maximum.
+	fmt.Println(">>> Stale Heap Check (injected clock)")
+	checkScoreMode("static", queue.ScoreStatic, 0)
+	checkScoreMode("refresh(0s)", queue.ScoreRefresh, 0)
+	checkScoreMode("refresh(30s)", queue.ScoreRefresh, 30*time.Second)
+
+	// 7. Scoring policies: the same backlog served by each built-in and by a policy file.
+	fmt.Println(">>> Scoring Policies")
+	custom, err := policy.LoadPolicy("example.policy")
+	if err != nil {
+		fmt.Println("  could not load example.policy:", err)
+	}
+	for _, p := range []policy.ScoringPolicy{policy.FIFO{}, policy.ShortestJobFirst{}, policy.DefaultWeightedAging(), policy.EarliestDeadlineFirst{}, custom} {
+		if p == nil {
+			continue
+		}
+		comparePolicy(p)
+	}
+
+	// 8. Capability-aware matching: the best job is skipped when no worker can run it.
+	fmt.Println(">>> Capability-Aware Matching")
+	capDisp := manager.NewDispatcher()
+	capDisp.Silent = true
+	capDisp.AddJob(&model.Job{ID: "Train", ArrivalTime: now.Add(-time.Hour), Size: 10, Requires: model.Resources{"gpu": 2, "memMB": 16000}})
+	capDisp.AddJob(&model.Job{ID: "Render", ArrivalTime: now.Add(-30 * time.Minute), Size: 10, Requires: model.Resources{"gpu": 1}})
+	capDisp.AddJob(&model.Job{ID: "Lint", ArrivalTime: now.Add(-time.Minute), Size: 1, Requires: model.Resources{"cpu": 1}})
+	capDisp.AddWorker(&model.Worker{ID: "CPUBox", AvailableTime: now.Add(-time.Hour), Efficiency: 1.0, Capacity: model.Resources{"cpu": 16, "memMB": 32000}})
+	capDisp.AddWorker(&model.Worker{ID: "GPUBox", AvailableTime: now, Efficiency: 1.0, Capacity: model.Resources{"cpu": 8, "gpu": 1, "memMB": 8000}})
+	for a := capDisp.Match(); a != nil; a = capDisp.Match() {
+		fmt.Printf("  %s -> %s\n", a.Job.ID, a.Worker.ID)
+	}
+	if reason, ok := capDisp.UnplacedReason("Train"); ok {
+		fmt.Printf("  Train unplaced: %s\n", reason)
+	}
+
+	// 9. Concurrency: many producers feeding a background Run loop.
+	// Run with `go run -race .` to have the race detector check this phase.
+	fmt.Println(">>> Concurrent Producers + Run Loop")
+	concurrencyCheck(16, 2000)
+
+	// 10. Write-ahead log: crash with a torn last record, then recover.
+	fmt.Println(">>> Journal Recovery")
+	if err := journalCheck(); err != nil {
+		fmt.Println("  journal check failed:", err)
+	}
+
+	// 11. Batch matching: greedy vs optimal (Hungarian) on the same pending state.
+	fmt.Println(">>> Batch Matching (greedy vs optimal)")
+	batchCheck()
+
+	// 12. Multi-tenant fairness: one tenant floods the queue, the others still get their share.
+	fmt.Println(">>> Weighted Fair Queuing across tenants")
+	fairnessCheck()
+
+	// 13. Deadlines: expiry to dead letters, boosting close deadlines, refusing slow workers.
+	fmt.Println(">>> Deadlines and Expiry")
+	deadlineCheck()
+
 	fmt.Println("Simulation Complete.")
 }
+
+func deadlineCheck() {
+	now := time.Now()
+	cfg := manager.DefaultConfig()
+	cfg.DeadlineBoostWindow = 10 * time.Minute
+	cfg.DeadlineBoost = 10000
+	disp := manager.NewDispatcherWithConfig(cfg)
+	disp.Silent = true
+
+	disp.AddJob(&model.Job{ID: "Stale", ArrivalTime: now.Add(-2 * time.Hour), TTL: time.Hour, Size: 10})
+	disp.AddJob(&model.Job{ID: "Backlog", ArrivalTime: now.Add(-time.Hour), Duration: time.Minute, Size: 10})
+	disp.AddJob(&model.Job{ID: "Urgent", ArrivalTime: now, Duration: 2 * time.Minute, Deadline: now.Add(time.Minute), Size: 10})
+	disp.AddJob(&model.Job{ID: "Hopeless", ArrivalTime: now, Duration: time.Hour, Deadline: now.Add(5 * time.Minute), Size: 10})
+	disp.AddWorker(&model.Worker{ID: "SlowBox", AvailableTime: now.Add(-time.Hour), Efficiency: 1.0})
+	disp.AddWorker(&model.Worker{ID: "FastBox", AvailableTime: now, Efficiency: 4.0})
+
+	// Urgent is boosted past Backlog, and only FastBox (2m / 4 = 30s) can finish it in time.
+	for a := disp.Match(); a != nil; a = disp.Match() {
+		fmt.Printf("  %s -> %s\n", a.Job.ID, a.Worker.ID)
+	}
+	// A new worker still cannot finish Hopeless (1h of work) in the 5 minutes left.
+	disp.AddWorker(&model.Worker{ID: "SpareBox", AvailableTime: now, Efficiency: 2.0})
+	disp.Match()
+	for _, dl := range disp.DeadLetters() {
+		fmt.Printf("  dead letter: %s (%s)\n", dl.Job.ID, dl.Reason)
+	}
+	if reason, ok := disp.UnplacedReason("Hopeless"); ok {
+		fmt.Printf("  Hopeless unplaced: %s\n", reason)
+	}
+}
+
+// fairnessCheck floods the queue from one tenant (with the oldest, highest-scoring jobs)
+// and shows dispatches still split by tenant weight.
+func fairnessCheck() {
+	now := time.Now()
+	disp := manager.NewDispatcher()
+	disp.Silent = true
+	for i := 0; i < 1000; i++ {
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("Flood_%d", i), Tenant: "flood", ArrivalTime: now.Add(-time.Hour), Size: 100})
+	}
+	for i := 0; i < 20; i++ {
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("Gold_%d", i), Tenant: "gold", Weight: 2, ArrivalTime: now, Size: 1})
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("Basic_%d", i), Tenant: "basic", ArrivalTime: now, Size: 1})
+	}
+	for i := 0; i < 40; i++ {
+		disp.AddWorker(&model.Worker{ID: fmt.Sprintf("FairWorker_%d", i), AvailableTime: now, Efficiency: 1.0})
+	}
+	for disp.Match() != nil {
+	}
+	for _, st := range disp.Stats() {
+		fmt.Printf("  tenant %-6s weight %.0f dispatched %2d pending %4d\n", st.Tenant, st.Weight, st.Dispatched, st.Pending)
+	}
+}
+
+// batchCheck builds a trace where the best jobs compete for the few big workers,
+// and compares the two pairing methods before committing the optimal one.
+func batchCheck() {
+	now := time.Now()
+	cfg := manager.DefaultConfig()
+	// Utility: job score, minus a penalty for memory a worker leaves unused.
+	cfg.Utility = func(j *model.Job, w *model.Worker, now time.Time) float64 {
+		waste := w.Capacity["memMB"] - j.Requires["memMB"]
+		return cfg.Policy.JobScore(j, now) - float64(waste)/100.0
+	}
+	disp := manager.NewDispatcherWithConfig(cfg)
+	disp.Silent = true
+
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 40; i++ {
+		disp.AddJob(&model.Job{
+			ID:          fmt.Sprintf("BatchJob_%d", i),
+			ArrivalTime: now.Add(-time.Duration(rng.Intn(3600)) * time.Second),
+			Size:        rng.Intn(100),
+			Requires:    model.Resources{"memMB": 500 * (1 + rng.Intn(8))},
+		})
+	}
+	for i := 0; i < 30; i++ {
+		disp.AddWorker(&model.Worker{
+			ID:            fmt.Sprintf("BatchWorker_%d", i),
+			AvailableTime: now.Add(-time.Duration(rng.Intn(600)) * time.Second),
+			Efficiency:    1.0,
+			Capacity:      model.Resources{"memMB": 1000 * (1 + rng.Intn(4))},
+		})
+	}
+
+	greedy := disp.PlanBatch(30, assign.Greedy)
+	optimal := disp.PlanBatch(30, assign.Optimal)
+	fmt.Printf("  greedy:    %2d pairs, utility %.1f\n", len(greedy.Assignments), greedy.TotalUtility)
+	fmt.Printf("  hungarian: %2d pairs, utility %.1f\n", len(optimal.Assignments), optimal.TotalUtility)
+
+	res := disp.MatchBatch(30)
+	jobs, workers := disp.Pending()
+	fmt.Printf("  committed %d pairs with %s (left: %d jobs, %d workers)\n", len(res.Assignments), res.Method, jobs, workers)
+}
+
+// journalCheck writes jobs, workers and a match to a journal, compacts once, appends a
+// half-written record as a crash would, and checks that Recover restores the same queues.
+func journalCheck() error {
+	dir, err := os.MkdirTemp("", "dispatcher-journal")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dispatcher.wal")
+	opts := journal.Options{SyncEvery: 8, CompactEvery: 50}
+
+	disp, err := manager.Recover(path, manager.DefaultConfig(), opts)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := 0; i < 60; i++ {
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("WalJob_%d", i), ArrivalTime: now.Add(-time.Duration(i) * time.Minute), Size: i})
+	}
+	disp.AddWorker(&model.Worker{ID: "WalWorkerA", AvailableTime: now.Add(-time.Hour), Efficiency: 1.0})
+	disp.AddWorker(&model.Worker{ID: "WalWorkerB", AvailableTime: now, Efficiency: 2.0})
+	first := disp.Match()
+	if _, err := disp.RemoveJob("WalJob_3"); err != nil {
+		return err
+	}
+	wantJobs, wantWorkers := disp.Pending()
+	wantTop := disp.FairJobQueue.PeekJob()
+	if err := disp.Close(); err != nil {
+		return err
+	}
+
+	// Simulate a crash in the middle of writing the next record.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	f.WriteString(`1badc0de {"Seq":999,"Op":"add_job","Job":{"ID":"Torn`)
+	f.Close()
+
+	recovered, err := manager.Recover(path, manager.DefaultConfig(), opts)
+	if err != nil {
+		return err
+	}
+	defer recovered.Close()
+	gotJobs, gotWorkers := recovered.Pending()
+	gotTop := recovered.FairJobQueue.PeekJob()
+	fmt.Printf("  matched before crash: %s -> %s\n", first.Job.ID, first.Worker.ID)
+	fmt.Printf("  before: %d jobs, %d workers, top %s\n", wantJobs, wantWorkers, wantTop.ID)
+	fmt.Printf("  after:  %d jobs, %d workers, top %s (arrival preserved: %v)\n",
+		gotJobs, gotWorkers, gotTop.ID, gotTop.ArrivalTime.Equal(wantTop.ArrivalTime))
+	if gotJobs != wantJobs || gotWorkers != wantWorkers || gotTop.ID != wantTop.ID {
+		return fmt.Errorf("recovered state differs")
+	}
+	return nil
+}
+
+// concurrencyCheck starts producers goroutines that each add perProducer jobs and as many workers,
+// while Run hands out assignments. Every job must come out exactly once.
+func concurrencyCheck(producers, perProducer int) {
+	disp := manager.NewDispatcher()
+	disp.Silent = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan manager.Assignment, 64)
+	done := make(chan error, 1)
+	go func() { done <- disp.Run(ctx, out) }()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(2)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				disp.AddJob(&model.Job{ID: fmt.Sprintf("P%d_Job%d", p, i), ArrivalTime: time.Now(), Size: i % 50})
+			}
+		}(p)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				disp.AddWorker(&model.Worker{ID: fmt.Sprintf("P%d_Worker%d", p, i), AvailableTime: time.Now(), Efficiency: 1.0})
+			}
+		}(p)
+	}
+
+	total := producers * perProducer
+	seen := make(map[string]bool, total)
+	for len(seen) < total {
+		a := <-out
+		if seen[a.Job.ID] {
+			fmt.Printf("  DUPLICATE assignment of %s\n", a.Job.ID)
+		}
+		seen[a.Job.ID] = true
+	}
+	wg.Wait()
+	cancel()
+	<-done
+
+	jobs, workers := disp.Pending()
+	fmt.Printf("  %d assignments from %d producers in %s (left: %d jobs, %d workers)\n", len(seen), producers, time.Since(start), jobs, workers)
+}
+
+// comparePolicy prints the order in which one policy hands out a fixed set of jobs.
+func comparePolicy(p policy.ScoringPolicy) {
+	now := time.Now()
+	disp := manager.NewDispatcherWithPolicy(p)
+	disp.Silent = true
+	disp.AddJob(&model.Job{ID: "Old", ArrivalTime: now.Add(-30 * time.Minute), Duration: 10 * time.Minute, Size: 5})
+	disp.AddJob(&model.Job{ID: "Quick", ArrivalTime: now.Add(-1 * time.Minute), Duration: 5 * time.Second, Size: 1})
+	disp.AddJob(&model.Job{ID: "Urgent", ArrivalTime: now.Add(-2 * time.Minute), Duration: time.Minute, Size: 20, Deadline: now.Add(3 * time.Minute)})
+	disp.AddJob(&model.Job{ID: "Big", ArrivalTime: now.Add(-5 * time.Minute), Duration: 2 * time.Minute, Size: 2000})
+
+	order := ""
+	for disp.FairJobQueue.Len() > 0 {
+		j, _ := disp.RemoveJob(disp.FairJobQueue.PeekJob().ID)
+		order += " " + j.ID
+	}
+	fmt.Printf("  %-14s%s\n", p.Name()+":", order)
+}
+
+// checkScoreMode pushes and pops jobs while a fake clock moves forward, and counts how often
+// the popped job was not the true current maximum.
+func checkScoreMode(name string, mode queue.ScoreMode, cadence time.Duration) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	disp := manager.NewDispatcherWithConfig(manager.Config{ScoreMode: mode, RefreshCadence: cadence, Clock: clock})
+	disp.Silent = true
+
+	rng := rand.New(rand.NewSource(42))
+	pending := make(map[string]*model.Job)
+	stale := 0
+	for i := 0; i < 2000; i++ {
+		j := &model.Job{ID: fmt.Sprintf("J%d", i), ArrivalTime: now.Add(-time.Duration(rng.Intn(600)) * time.Second), Size: rng.Intn(200)}
+		disp.AddJob(j)
+		pending[j.ID] = j
+		now = now.Add(time.Duration(rng.Intn(5000)) * time.Millisecond)
+
+		if i%3 == 0 {
+			best := math.Inf(-1)
+			for _, p := range pending {
+				best = math.Max(best, p.ScoreAt(now))
+			}
+			got, _ := disp.RemoveJob(disp.FairJobQueue.PeekJob().ID)
+			delete(pending, got.ID)
+			if best-got.ScoreAt(now) > 1e-6 {
+				stale++
+			}
+		}
+	}
+	fmt.Printf("  %-12s stale pops: %d\n", name, stale)
+}
@@ -0,0 +1,246 @@
+package assign
+
+import (
+	"math"
+	"sort"
+)
+
+// Method picks the algorithm used to pair rows (jobs) with columns (workers).
+type Method int
+
+const (
+	// Optimal solves the assignment problem exactly with the Hungarian algorithm, O(n^3).
+	// It first maximizes the number of feasible pairs, then the total utility.
+	Optimal Method = iota
+	// Greedy walks rows in the given order and gives each the first free feasible column.
+	// With rows and columns sorted best-first this is exactly what repeated Match calls do.
+	Greedy
+)
+
+func (m Method) String() string {
+	if m == Optimal {
+		return "hungarian"
+	}
+	return "greedy"
+}
+
+// Solve pairs rows with columns. utility[r][c] is the value of pairing r with c and is only
+// used where feasible[r][c] is true. It returns, for every row, its column or -1, plus the
+// total utility of the chosen pairs.
+func Solve(utility [][]float64, feasible [][]bool, method Method) ([]int, float64) {
+	var rowToCol []int
+	if method == Optimal {
+		rowToCol = hungarian(utility, feasible)
+	} else {
+		rowToCol = greedy(feasible)
+	}
+	total := 0.0
+	for r, c := range rowToCol {
+		if c >= 0 {
+			total += utility[r][c]
+		}
+	}
+	return rowToCol, total
+}
+
+func greedy(feasible [][]bool) []int {
+	rowToCol := make([]int, len(feasible))
+	var taken []bool
+	if len(feasible) > 0 {
+		taken = make([]bool, len(feasible[0]))
+	}
+	for r := range feasible {
+		rowToCol[r] = -1
+		for c, ok := range feasible[r] {
+			if ok && !taken[c] {
+				rowToCol[r] = c
+				taken[c] = true
+				break
+			}
+		}
+	}
+	return rowToCol
+}
+
+// hungarian maximizes utility by minimizing cost on a square matrix padded with dummy rows/cols.
+//
+//	feasible pair:   cost = maxU - utility       (in [0, spread])
+//	infeasible pair: cost = forbidden            (worse than any set of feasible pairs)
+//	dummy row/col:   cost = 0                    (rows/cols left unpaired)
+//
+// forbidden > n*spread, so the solver first minimizes the number of infeasible pairs it is forced
+// into (i.e. maximizes feasible matches) and only then the cost. Infeasible pairs are dropped after.
+// Utilities too far apart for that in float64 are brought closer first (see compressed).
+func hungarian(utility [][]float64, feasible [][]bool) []int {
+	rows := len(utility)
+	if rows == 0 {
+		return nil
+	}
+	cols := len(utility[0])
+	n := rows
+	if cols > n {
+		n = cols
+	}
+	utility = compressed(utility, feasible, n)
+
+	maxU, minU := math.Inf(-1), math.Inf(1)
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			if feasible[r][c] {
+				maxU = math.Max(maxU, utility[r][c])
+				minU = math.Min(minU, utility[r][c])
+			}
+		}
+	}
+	rowToCol := make([]int, rows)
+	for r := range rowToCol {
+		rowToCol[r] = -1
+	}
+	if math.IsInf(maxU, -1) {
+		return rowToCol // nothing is feasible
+	}
+	forbidden := (maxU-minU+1)*float64(n+1) + 1
+
+	cost := func(r, c int) float64 {
+		if r >= rows || c >= cols {
+			return 0
+		}
+		if !feasible[r][c] {
+			return forbidden
+		}
+		return maxU - utility[r][c]
+	}
+
+	// Classic O(n^3) Hungarian with row/column potentials (1-indexed; index 0 is a sentinel).
+	u := make([]float64, n+1)
+	v := make([]float64, n+1)
+	p := make([]int, n+1) // p[col] = row assigned to col
+	way := make([]int, n+1)
+	minv := make([]float64, n+1)
+	used := make([]bool, n+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		for j := range minv {
+			minv[j] = math.Inf(1)
+			used[j] = false
+		}
+		for {
+			used[j0] = true
+			i0 := p[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= n; j++ {
+				if used[j] {
+					continue
+				}
+				cur := cost(i0-1, j-1) - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+			if j0 == 0 {
+				break
+			}
+		}
+	}
+
+	for j := 1; j <= n; j++ {
+		r, c := p[j]-1, j-1
+		if r < rows && c < cols && feasible[r][c] {
+			rowToCol[r] = c
+		}
+	}
+	return rowToCol
+}
+
+// compressed returns utility unchanged unless some gap between its feasible values is too wide
+// for the solver, and otherwise a copy with those gaps narrowed. The potentials add up costs of
+// the order of n*forbidden, about n^2*spread, so a spread like EDF's -1e18 for "no deadline"
+// swamps differences of a few points and the solver picks at random among them.
+//
+// Taking the distinct values' gaps smallest first, a gap wider than (n+1) times the sum S of the
+// gaps before it becomes exactly (n+1)*S: still wider than anything n pairs can gain on the
+// narrower gaps, so crossing it once costs more than any trade below it, which is all a huge gap
+// ever means. Narrower gaps, and so every choice not involving a huge gap, are kept exactly.
+// Solve still reports the real utilities.
+func compressed(utility [][]float64, feasible [][]bool, n int) [][]float64 {
+	var vals []float64
+	for r := range utility {
+		for c, u := range utility[r] {
+			if feasible[r][c] && !math.IsNaN(u) {
+				vals = append(vals, u)
+			}
+		}
+	}
+	sort.Float64s(vals)
+	var distinct []float64
+	for _, u := range vals {
+		if len(distinct) == 0 || u != distinct[len(distinct)-1] {
+			distinct = append(distinct, u)
+		}
+	}
+	if len(distinct) < 3 {
+		return utility // at most one gap: nothing to weigh it against
+	}
+
+	gaps := make([]int, len(distinct)-1) // gap k is between distinct[k] and distinct[k+1]
+	for k := range gaps {
+		gaps[k] = k
+	}
+	width := func(k int) float64 { return distinct[k+1] - distinct[k] }
+	sort.Slice(gaps, func(a, b int) bool { return width(gaps[a]) < width(gaps[b]) })
+	narrowed := make([]float64, len(gaps))
+	sum, changed := 0.0, false
+	for _, k := range gaps {
+		narrowed[k] = width(k)
+		if limit := float64(n+1) * sum; sum > 0 && narrowed[k] > limit {
+			narrowed[k], changed = limit, true
+		}
+		sum += narrowed[k]
+	}
+	if !changed {
+		return utility
+	}
+
+	at := make(map[float64]float64, len(distinct))
+	pos := 0.0
+	for i, u := range distinct {
+		if i > 0 {
+			pos += narrowed[i-1]
+		}
+		at[u] = pos
+	}
+	out := make([][]float64, len(utility))
+	for r := range utility {
+		out[r] = make([]float64, len(utility[r]))
+		for c, u := range utility[r] {
+			if feasible[r][c] {
+				out[r][c] = at[u]
+			}
+		}
+	}
+	return out
+}
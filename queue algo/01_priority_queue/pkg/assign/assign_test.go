@@ -0,0 +1,73 @@
+package assign
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// bestPairing is the brute-force optimum: the most feasible pairs, then the largest total.
+// Totals are exact int64 sums, so -1e18 + 999 and -1e18 stay apart.
+func bestPairing(feasible [][]bool, value [][]int64) (pairs int, total int64) {
+	rows, cols := len(feasible), len(feasible[0])
+	pairs = -1
+	used := make([]bool, cols)
+	var try func(r, n int, sum int64)
+	try = func(r, n int, sum int64) {
+		if r == rows {
+			if n > pairs || n == pairs && sum > total {
+				pairs, total = n, sum
+			}
+			return
+		}
+		try(r+1, n, sum)
+		for c := 0; c < cols; c++ {
+			if feasible[r][c] && !used[c] {
+				used[c] = true
+				try(r+1, n+1, sum+value[r][c])
+				used[c] = false
+			}
+		}
+	}
+	try(0, 0, 0)
+	return pairs, total
+}
+
+// TestOptimalMatchesBruteForce solves random batches of up to 6x6, with and without EDF's
+// -1e18 "no deadline" utility among the values, and compares them with every pairing.
+func TestOptimalMatchesBruteForce(t *testing.T) {
+	for _, huge := range []bool{false, true} {
+		for seed := int64(0); seed < 1000; seed++ {
+			r := rand.New(rand.NewSource(seed))
+			rows, cols := 1+r.Intn(6), 1+r.Intn(6)
+			utility := make([][]float64, rows)
+			value := make([][]int64, rows)
+			feasible := make([][]bool, rows)
+			for i := range utility {
+				utility[i] = make([]float64, cols)
+				value[i] = make([]int64, cols)
+				feasible[i] = make([]bool, cols)
+				for c := range utility[i] {
+					feasible[i][c] = r.Intn(3) > 0
+					value[i][c] = int64(r.Intn(1000))
+					if huge && r.Intn(3) == 0 {
+						value[i][c] = -1e18
+					}
+					utility[i][c] = float64(value[i][c])
+				}
+			}
+
+			rowToCol, _ := Solve(utility, feasible, Optimal)
+			pairs, total := 0, int64(0)
+			for i, c := range rowToCol {
+				if c >= 0 {
+					pairs++
+					total += value[i][c]
+				}
+			}
+			if wantPairs, wantTotal := bestPairing(feasible, value); pairs != wantPairs || total != wantTotal {
+				t.Fatalf("huge=%v seed %d: %d pairs worth %d, want %d worth %d",
+					huge, seed, pairs, total, wantPairs, wantTotal)
+			}
+		}
+	}
+}
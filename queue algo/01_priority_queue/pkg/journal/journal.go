@@ -0,0 +1,247 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// Op is the kind of event stored in the journal.
+type Op string
+
+const (
+	OpAddJob       Op = "add_job"
+	OpAddWorker    Op = "add_worker"
+	OpMatch        Op = "match"
+	OpRemoveJob    Op = "remove_job"
+	OpRemoveWorker Op = "remove_worker"
+	OpExpire       Op = "expire"  // job moved to the dead-letter list
+	OpUnmatch      Op = "unmatch" // an undelivered match was undone: job and worker queued again
+)
+
+// Record is one journal entry. Add and Unmatch records carry the full Job/Worker so ArrivalTime
+// and AvailableTime (and therefore scores) survive a restart. Match/Remove records only carry IDs.
+type Record struct {
+	Seq      uint64
+	Op       Op
+	Job      *model.Job    `json:",omitempty"`
+	Worker   *model.Worker `json:",omitempty"`
+	JobID    string        `json:",omitempty"`
+	WorkerID string        `json:",omitempty"`
+	Reason   string        `json:",omitempty"`
+	At       time.Time     `json:",omitzero"` // when an expiry happened, so replay dates the dead letter the same
+}
+
+// ErrFailed wraps the error that broke a Journal. Once a write, flush or fsync has failed the
+// journal refuses every later Append with it.
+var ErrFailed = errors.New("journal failed")
+
+// Options controls durability vs throughput.
+type Options struct {
+	// SyncEvery fsyncs after this many appended records. 0 or 1 = fsync every record.
+	// With N > 1, up to N-1 acknowledged records can be lost in a crash.
+	SyncEvery int
+	// SyncInterval also fsyncs on append if the last fsync is older than this. 0 = disabled.
+	SyncInterval time.Duration
+	// CompactEvery asks the owner to snapshot and truncate after this many records. 0 = never.
+	CompactEvery int
+}
+
+// Journal is an append-only log file. Every line is
+//
+//	<crc32 of payload, 8 hex digits> <JSON payload>\n
+//
+// A crash can leave a half-written last line; ReadLog detects it by the missing newline or a
+// bad checksum and Open cuts the file back to the last good record.
+// Journal is not safe for concurrent use; the Dispatcher serialises access under its lock.
+type Journal struct {
+	path string
+	opts Options
+	f    *os.File
+	w    *bufio.Writer
+
+	seq       uint64
+	size      int64 // bytes written so far, buffered or not: where the next record starts
+	unsynced  int
+	lastSync  time.Time
+	sinceSnap int
+	err       error // set by fail; every later Append returns it
+}
+
+// Open opens (or creates) the log at path for appending, continuing after lastSeq.
+// validSize is the byte length of the intact prefix reported by ReadLog; anything after it
+// (a torn tail) is truncated away.
+func Open(path string, opts Options, lastSeq uint64, validSize int64) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(validSize); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(validSize, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Journal{
+		path:     path,
+		opts:     opts,
+		f:        f,
+		w:        bufio.NewWriter(f),
+		seq:      lastSeq,
+		size:     validSize,
+		lastSync: time.Now(),
+	}, nil
+}
+
+// Append assigns the next sequence number to r and writes it, fsyncing per Options.
+// The sequence number only advances once r is written. If writing, flushing or fsyncing fails,
+// the file is cut back to where r would have started, so replay can never apply a record the
+// caller was told failed, and the journal is failed for good (see ErrFailed).
+func (j *Journal) Append(r Record) error {
+	if j.err != nil {
+		return j.err
+	}
+	r.Seq = j.seq + 1
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	start := j.size
+	n, err := fmt.Fprintf(j.w, "%08x %s\n", crc32.ChecksumIEEE(payload), payload)
+	if err != nil {
+		return j.fail(start, err)
+	}
+	j.unsynced++
+	if j.unsynced >= j.opts.SyncEvery || (j.opts.SyncInterval > 0 && time.Since(j.lastSync) >= j.opts.SyncInterval) {
+		if err := j.Sync(); err != nil {
+			return j.fail(start, err)
+		}
+	}
+	j.seq = r.Seq
+	j.size += int64(n)
+	j.sinceSnap++
+	return nil
+}
+
+// fail marks the journal failed with err and cuts the file back to size. Records still
+// buffered from earlier appends (SyncEvery > 1) are lost with it, as they would be in a crash.
+func (j *Journal) fail(size int64, err error) error {
+	j.err = fmt.Errorf("%w: %w", ErrFailed, err)
+	if fi, serr := j.f.Stat(); serr == nil && fi.Size() > size {
+		j.f.Truncate(size) // best effort: Open cuts a torn tail anyway
+	}
+	return j.err
+}
+
+// Sync flushes buffered records and fsyncs the file.
+func (j *Journal) Sync() error {
+	if j.err != nil {
+		return j.err
+	}
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.unsynced = 0
+	j.lastSync = time.Now()
+	return nil
+}
+
+// Path returns the log file path.
+func (j *Journal) Path() string { return j.path }
+
+// Seq returns the sequence number of the last appended record.
+func (j *Journal) Seq() uint64 { return j.seq }
+
+// NeedsCompaction reports whether CompactEvery records have been appended since the last Reset.
+func (j *Journal) NeedsCompaction() bool {
+	return j.opts.CompactEvery > 0 && j.sinceSnap >= j.opts.CompactEvery
+}
+
+// Reset empties the log. Call it only after a snapshot covering Seq() is durable.
+// Sequence numbers keep increasing so a stale log can never be replayed over a newer snapshot.
+func (j *Journal) Reset() error {
+	if j.err != nil {
+		return j.err
+	}
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	if err := j.f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := j.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	j.size = 0
+	j.sinceSnap = 0
+	return j.Sync()
+}
+
+// Close flushes, fsyncs and closes the log.
+func (j *Journal) Close() error {
+	err := j.Sync()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadLog reads every intact record from the log at path. It stops at the first torn or
+// corrupt line and reports the byte length of the intact prefix in validSize.
+// A missing file is an empty log.
+func ReadLog(path string) (records []Record, validSize int64, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for len(data[validSize:]) > 0 {
+		rest := data[validSize:]
+		nl := bytes.IndexByte(rest, '\n')
+		if nl < 0 {
+			break // torn write: the last line never got its newline
+		}
+		r, ok := decodeLine(rest[:nl])
+		if !ok {
+			break // torn or corrupt: trust nothing from here on
+		}
+		records = append(records, r)
+		validSize += int64(nl + 1)
+	}
+	return records, validSize, nil
+}
+
+func decodeLine(line []byte) (Record, bool) {
+	var r Record
+	var sum uint32
+	if len(line) < 10 || line[8] != ' ' {
+		return r, false
+	}
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &sum); err != nil {
+		return r, false
+	}
+	payload := line[9:]
+	if crc32.ChecksumIEEE(payload) != sum {
+		return r, false
+	}
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return r, false
+	}
+	return r, true
+}
@@ -0,0 +1,168 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// writeLog journals three add_job records and returns the log's path and contents.
+func writeLog(t *testing.T) (string, []byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.log")
+	j, err := Open(path, Options{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"J1", "J2", "J3"} {
+		if err := j.Append(Record{Op: OpAddJob, Job: &model.Job{ID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+// A crash can tear the last line or leave garbage in it. ReadLog must return every record
+// before it, and Open must cut the file back so the next record follows the intact ones.
+func TestTornOrCorruptTailRecovers(t *testing.T) {
+	damage := map[string]func(data []byte, lastLine int) []byte{
+		"torn": func(data []byte, lastLine int) []byte {
+			return data[:lastLine+(len(data)-lastLine)/2] // no newline at the end
+		},
+		"bad checksum": func(data []byte, lastLine int) []byte {
+			bad := bytes.Clone(data)
+			bad[len(bad)-3] ^= 0x20 // flip a payload byte, keep the newline
+			return bad
+		},
+		"garbage": func(data []byte, lastLine int) []byte {
+			return append(bytes.Clone(data[:lastLine]), "not a record\n"...)
+		},
+	}
+	for name, damage := range damage {
+		t.Run(name, func(t *testing.T) {
+			path, data := writeLog(t)
+			lastLine := bytes.LastIndexByte(data[:len(data)-1], '\n') + 1
+			if err := os.WriteFile(path, damage(data, lastLine), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			records, validSize, err := ReadLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 || records[1].Job.ID != "J2" || validSize != int64(lastLine) {
+				t.Fatalf("ReadLog: %d records, valid size %d; want 2 (J1, J2) and %d", len(records), validSize, lastLine)
+			}
+
+			j, err := Open(path, Options{}, records[1].Seq, validSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Append(Record{Op: OpRemoveJob, JobID: "J1"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+			records, _, err = ReadLog(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 || records[2].Op != OpRemoveJob || records[2].Seq != 3 {
+				t.Fatalf("after Open and Append: %+v, want J1, J2 and the removal as record 3", records)
+			}
+		})
+	}
+}
+
+// A damaged line in the middle ends the log there: nothing after it is trusted.
+func TestCorruptMiddleLineEndsLog(t *testing.T) {
+	path, data := writeLog(t)
+	second := bytes.IndexByte(data, '\n') + 1
+	bad := bytes.Clone(data)
+	bad[second+12] ^= 0x20
+	if err := os.WriteFile(path, bad, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	records, validSize, err := ReadLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || validSize != int64(second) {
+		t.Fatalf("ReadLog: %d records, valid size %d; want 1 and %d", len(records), validSize, second)
+	}
+}
+
+func TestMissingLogIsEmpty(t *testing.T) {
+	records, validSize, err := ReadLog(filepath.Join(t.TempDir(), "none.log"))
+	if err != nil || len(records) != 0 || validSize != 0 {
+		t.Fatalf("ReadLog of a missing file = %v, %d, %v", records, validSize, err)
+	}
+}
+
+// shortWriter passes n bytes through to the file, then fails like a full disk.
+type shortWriter struct {
+	f *os.File
+	n int
+}
+
+var errDiskFull = errors.New("disk full")
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.n {
+		w.n -= len(p)
+		return w.f.Write(p)
+	}
+	n, _ := w.f.Write(p[:w.n])
+	w.n = 0
+	return n, errDiskFull
+}
+
+// A record that cannot be flushed is cut back out of the file, does not use up a sequence
+// number, and fails the journal so nothing can be appended after the gap.
+func TestFailedAppendLeavesNoRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	j, err := Open(path, Options{}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Append(Record{Op: OpAddJob, Job: &model.Job{ID: "J1"}}); err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j.w = bufio.NewWriter(&shortWriter{f: j.f, n: 20}) // half of the next line reaches the file
+	if err := j.Append(Record{Op: OpAddJob, Job: &model.Job{ID: "J2"}}); !errors.Is(err, ErrFailed) || !errors.Is(err, errDiskFull) {
+		t.Fatalf("Append = %v, want ErrFailed wrapping the write error", err)
+	}
+	if j.Seq() != 1 {
+		t.Errorf("Seq() = %d after a failed append, want 1", j.Seq())
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, good) {
+		t.Errorf("log after the failed append:\n%s\nwant only the first record:\n%s", data, good)
+	}
+
+	if err := j.Append(Record{Op: OpAddJob, Job: &model.Job{ID: "J3"}}); !errors.Is(err, ErrFailed) {
+		t.Fatalf("Append after a failure = %v, want ErrFailed", err)
+	}
+	j.Close()
+	records, _, err := ReadLog(path)
+	if err != nil || len(records) != 1 || records[0].Job.ID != "J1" {
+		t.Fatalf("ReadLog = %+v, %v; want only J1", records, err)
+	}
+}
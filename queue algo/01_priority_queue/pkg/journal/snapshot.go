@@ -0,0 +1,95 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// Snapshot is the full queued state as of log record LastSeq.
+// Recovery loads it and then replays only log records with Seq > LastSeq.
+type Snapshot struct {
+	LastSeq uint64
+	Jobs    []*model.Job
+	Workers []*model.Worker
+
+	// Fair-queuing state: without it a restart would forget how much every tenant has already
+	// been dispatched and hand the tenants that were ahead their share a second time.
+	VirtualTime float64 // the system virtual time
+	Tenants     []TenantState
+	// DeadLetters are the jobs that expired before the snapshot, oldest first.
+	DeadLetters []DeadLetter
+}
+
+// TenantState is one tenant's weighted-fair-queuing bookkeeping.
+type TenantState struct {
+	Tenant      string
+	Weight      float64
+	VirtualTime float64
+	Dispatched  int
+}
+
+// DeadLetter is a job that expired while queued.
+type DeadLetter struct {
+	Job    *model.Job
+	Reason string
+	At     time.Time
+}
+
+// SnapshotPath is where the snapshot for the log at logPath lives.
+func SnapshotPath(logPath string) string {
+	return logPath + ".snap"
+}
+
+// WriteSnapshot durably replaces the snapshot at path: write a temp file, fsync, rename, fsync dir.
+// A crash at any point leaves either the old or the new snapshot, never a mix.
+func WriteSnapshot(path string, s *Snapshot) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// ReadSnapshot loads the snapshot at path. A missing file is an empty snapshot.
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Snapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
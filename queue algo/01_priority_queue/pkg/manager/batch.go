@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/assign"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/journal"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// Utility values pairing job j with worker w at time now. Higher is better.
+type Utility func(j *model.Job, w *model.Worker, now time.Time) float64
+
+// rankUtility is the default batch utility. The job ranked r-th of n in dispatch order and the
+// worker ranked c-th of m by score are worth (n-r) x (m-c): positive and rising with both ranks,
+// so the optimum hands the best jobs the best workers. Multiplying raw scores would not: a
+// policy like SJF or EDF scores every job negative, and with more workers than jobs the
+// product is highest on the slowest workers.
+func rankUtility(r, n, c, m int) float64 {
+	return float64(n-r) * float64(m-c)
+}
+
+// BatchResult is the outcome of one batch round.
+type BatchResult struct {
+	Assignments  []Assignment
+	TotalUtility float64
+	Method       assign.Method
+}
+
+// PlanBatch computes how the top n jobs and top n workers would be paired by method,
+// without changing any queue. Use it to compare greedy and optimal pairing on the same state.
+func (d *Dispatcher) PlanBatch(n int, method assign.Method) BatchResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	res, _ := d.planBatch(n, method, d.now())
+	return res
+}
+
+// MatchBatch pairs up to n of the best jobs with up to n of the best workers in one round,
+// maximizing the total Utility instead of pairing greedily one job at a time.
+// Batches up to HungarianLimit are solved optimally; larger ones fall back to greedy.
+// Jobs and workers left unpaired stay queued. If a pair cannot be journaled, it and the
+// pairs after it stay queued too and are left out of the result (see Err).
+func (d *Dispatcher) MatchBatch(n int) BatchResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.expireJobs(now)
+	method := assign.Optimal
+	if n > d.cfg.HungarianLimit {
+		method = assign.Greedy
+	}
+	res, utilities := d.planBatch(n, method, now)
+
+	// Take every pair out of the queues (same steps as a single match).
+	for i, a := range res.Assignments {
+		if err := d.record(journal.Record{Op: journal.OpMatch, JobID: a.Job.ID, WorkerID: a.Worker.ID}); err != nil {
+			res.Assignments, res.TotalUtility = res.Assignments[:i], 0
+			for _, u := range utilities[:i] {
+				res.TotalUtility += u
+			}
+			break
+		}
+		d.FairJobQueue.Take(a.Job)
+		d.ScoreWorkerQueue.Remove(a.Worker.ID)
+		d.removeFromOtherJobQueues(a.Job.ID)
+		d.removeFromOtherWorkerQueues(a.Worker.ID)
+		d.logf("[BATCH MATCH] (%s) %s -> %s\n", method, a.Job, a.Worker)
+	}
+	d.maybeCompact()
+	return res
+}
+
+// planBatch solves one batch at time now without changing any queue.
+// It also returns the utility of each assignment, in the same order.
+func (d *Dispatcher) planBatch(n int, method assign.Method, now time.Time) (BatchResult, []float64) {
+	res := BatchResult{Method: method}
+	if n <= 0 {
+		return res, nil
+	}
+
+	// 1. Candidates: the next n jobs in fair dispatch order and the top n workers.
+	var jobs []*model.Job
+	d.FairJobQueue.Walk(func(j *model.Job) bool {
+		jobs = append(jobs, j)
+		return len(jobs) < n
+	})
+	var workers []*model.Worker
+	d.ScoreWorkerQueue.Walk(func(w *model.Worker) bool {
+		workers = append(workers, w)
+		return len(workers) < n
+	})
+	if len(jobs) == 0 || len(workers) == 0 {
+		return res, nil
+	}
+
+	// 2. Utility matrix; pairs the worker cannot run (or not in time) are infeasible.
+	utility := make([][]float64, len(jobs))
+	feasible := make([][]bool, len(jobs))
+	for r, j := range jobs {
+		utility[r] = make([]float64, len(workers))
+		feasible[r] = make([]bool, len(workers))
+		for c, w := range workers {
+			feasible[r][c] = d.feasible(j, w, now)
+			if d.cfg.Utility == nil {
+				utility[r][c] = rankUtility(r, len(jobs), c, len(workers))
+			} else {
+				utility[r][c] = d.cfg.Utility(j, w, now)
+			}
+		}
+	}
+
+	// 3. Solve.
+	rowToCol, total := assign.Solve(utility, feasible, method)
+	res.TotalUtility = total
+	var utilities []float64
+	for r, c := range rowToCol {
+		if c < 0 {
+			continue
+		}
+		res.Assignments = append(res.Assignments, Assignment{Job: jobs[r], Worker: workers[c]})
+		utilities = append(utilities, utility[r][c])
+	}
+	return res, utilities
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.cfg.Clock == nil {
+		return time.Now()
+	}
+	return d.cfg.Clock()
+}
@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/assign"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
+)
+
+// SJF scores every job negative, so multiplying job and worker scores would rather pair a job
+// with a slow worker than a fast one whenever there are more workers than jobs. The default
+// batch utility must give the shortest job the most efficient worker, and a Config that leaves
+// HungarianLimit 0 must still solve optimally.
+func TestMatchBatchShortestJobGetsBestWorker(t *testing.T) {
+	d, now := clockDispatcher(Config{Policy: policy.ShortestJobFirst{}})
+	for _, dur := range []int{20, 10} {
+		d.AddJob(&model.Job{ID: fmt.Sprintf("J%d", dur), ArrivalTime: *now, Duration: time.Duration(dur) * time.Second})
+	}
+	for _, eff := range []int{1, 3, 2} {
+		d.AddWorker(&model.Worker{ID: fmt.Sprintf("W%d", eff), AvailableTime: *now, Efficiency: float64(eff)})
+	}
+
+	res := d.MatchBatch(3)
+	if res.Method != assign.Optimal {
+		t.Errorf("Method = %s, want %s for a 3-pair batch with HungarianLimit 0", res.Method, assign.Optimal)
+	}
+	got := make(map[string]string)
+	for _, a := range res.Assignments {
+		got[a.Job.ID] = a.Worker.ID
+	}
+	want := map[string]string{"J10": "W3", "J20": "W2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("MatchBatch paired %v, want %v", got, want)
+	}
+}
+
+func TestHungarianLimit(t *testing.T) {
+	for _, tc := range []struct {
+		limit, n int
+		want     assign.Method
+	}{
+		{limit: 0, n: DefaultHungarianLimit, want: assign.Optimal},
+		{limit: 0, n: DefaultHungarianLimit + 1, want: assign.Greedy},
+		{limit: 2, n: 2, want: assign.Optimal},
+		{limit: 2, n: 3, want: assign.Greedy},
+		{limit: -1, n: 1, want: assign.Greedy},
+	} {
+		d, now := clockDispatcher(Config{HungarianLimit: tc.limit})
+		d.AddJob(&model.Job{ID: "J1", ArrivalTime: *now})
+		d.AddWorker(&model.Worker{ID: "W1", AvailableTime: *now})
+		if got := d.MatchBatch(tc.n).Method; got != tc.want {
+			t.Errorf("HungarianLimit %d, batch of %d: %s, want %s", tc.limit, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package manager
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// clockDispatcher is a silent in-memory Dispatcher on a fake clock that starts at the returned time.
+func clockDispatcher(cfg Config) (*Dispatcher, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg.Clock = func() time.Time { return now }
+	d := NewDispatcherWithConfig(cfg)
+	d.Silent = true
+	return d, &now
+}
+
+// Match passes over a better-scored worker that would finish after the job's deadline, and a
+// job no worker can finish in time stays queued with a deadline reason.
+func TestMatchChecksDeadlineFeasibility(t *testing.T) {
+	d, now := clockDispatcher(DefaultConfig())
+	job := &model.Job{ID: "J1", ArrivalTime: *now, Duration: 20 * time.Second, Deadline: now.Add(10 * time.Second)}
+	d.AddJob(job)
+	// Slow idles far longer, so it heads the worker queue, but needs 20s.
+	d.AddWorker(&model.Worker{ID: "Slow", AvailableTime: now.Add(-time.Hour), Efficiency: 1})
+	d.AddWorker(&model.Worker{ID: "Fast", AvailableTime: *now, Efficiency: 4})
+
+	a := d.Match()
+	if a == nil || a.Worker.ID != "Fast" {
+		t.Fatalf("Match = %+v, want J1 on Fast", a)
+	}
+
+	d.AddJob(&model.Job{ID: "J2", ArrivalTime: *now, Duration: 20 * time.Second, Deadline: now.Add(10 * time.Second)})
+	if a := d.Match(); a != nil {
+		t.Fatalf("Match = %+v, want nil: Slow cannot finish J2 in time", a)
+	}
+	if jobs, workers := d.Pending(); jobs != 1 || workers != 1 {
+		t.Fatalf("pending %d jobs, %d workers; want 1, 1", jobs, workers)
+	}
+	reason, ok := d.UnplacedReason("J2")
+	if !ok || !strings.HasPrefix(reason, "cannot finish before deadline") {
+		t.Fatalf("UnplacedReason(J2) = %q, %v; want a deadline reason", reason, ok)
+	}
+}
+
+// Under DeadlineBoost a job with a deadline loses to an older job until it is inside the
+// window, and wins once the boost has grown past the older job's head start.
+func TestDeadlineBoostWindow(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DeadlineBoostWindow = 10 * time.Minute
+	cfg.DeadlineBoost = 10000
+
+	first := func(elapsed time.Duration) string {
+		t.Helper()
+		d, now := clockDispatcher(cfg)
+		start := *now
+		d.AddJob(&model.Job{ID: "Old", ArrivalTime: start.Add(-10 * time.Minute)})
+		d.AddJob(&model.Job{ID: "Due", ArrivalTime: start, Deadline: start.Add(30 * time.Minute)})
+		d.AddWorker(&model.Worker{ID: "W1", AvailableTime: start})
+		*now = start.Add(elapsed)
+		a := d.Match()
+		if a == nil {
+			t.Fatalf("after %v: no match", elapsed)
+		}
+		return a.Job.ID
+	}
+
+	if got := first(0); got != "Old" {
+		t.Errorf("30m before the deadline: matched %s first, want Old", got)
+	}
+	if got := first(19 * time.Minute); got != "Old" {
+		t.Errorf("11m before the deadline (outside the window): matched %s first, want Old", got)
+	}
+	// 5m left: Due gains 5000 points, Old's head start is 10m*1.5 = 900.
+	if got := first(25 * time.Minute); got != "Due" {
+		t.Errorf("5m before the deadline: matched %s first, want Due", got)
+	}
+}
+
+// Expired jobs become dead letters dated at the sweep, with the reason for the earlier of
+// their two limits.
+func TestExpiryDeadLetterReasons(t *testing.T) {
+	d, now := clockDispatcher(DefaultConfig())
+	start := *now
+	d.AddJob(&model.Job{ID: "TTL", ArrivalTime: start, TTL: time.Minute})
+	d.AddJob(&model.Job{ID: "Deadline", ArrivalTime: start, Deadline: start.Add(2 * time.Minute)})
+	d.AddJob(&model.Job{ID: "DeadlineFirst", ArrivalTime: start, TTL: time.Hour, Deadline: start.Add(3 * time.Minute)})
+	d.AddJob(&model.Job{ID: "Fresh", ArrivalTime: start, TTL: time.Hour})
+
+	*now = start.Add(30 * time.Second)
+	d.ExpireJobs()
+	if dead := d.DeadLetters(); len(dead) != 0 {
+		t.Fatalf("dead letters before any limit: %+v", dead)
+	}
+
+	*now = start.Add(5 * time.Minute)
+	d.ExpireJobs()
+	want := map[string]string{"TTL": "ttl expired", "Deadline": "deadline passed", "DeadlineFirst": "deadline passed"}
+	dead := d.DeadLetters()
+	if len(dead) != len(want) {
+		t.Fatalf("dead letters %+v, want %d", dead, len(want))
+	}
+	for _, dl := range dead {
+		if dl.Reason != want[dl.Job.ID] || !dl.At.Equal(*now) {
+			t.Errorf("%s: reason %q at %s, want %q at %s", dl.Job.ID, dl.Reason, dl.At, want[dl.Job.ID], *now)
+		}
+	}
+	if jobs, _ := d.Pending(); jobs != 1 {
+		t.Errorf("pending %d jobs, want only Fresh", jobs)
+	}
+	if d.TimeJobQueue.Contains("TTL") || d.ExpiryJobQueue.Contains("TTL") {
+		t.Error("an expired job is still indexed")
+	}
+}
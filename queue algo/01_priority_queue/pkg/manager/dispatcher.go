@@ -1,150 +1,557 @@
 package manager
 
 import (
-	"container/heap"
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/journal"
 	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
 	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/queue"
 )
 
+var (
+	ErrDuplicateJob    = errors.New("job with this ID is already queued")
+	ErrDuplicateWorker = errors.New("worker with this ID is already queued")
+)
+
+// Assignment is one Job handed to one Worker.
+type Assignment struct {
+	Job    *model.Job
+	Worker *model.Worker
+}
+
+// Dispatcher is safe for concurrent use. All exported methods take mu;
+// the exported queue fields must not be touched directly while other goroutines use the Dispatcher.
 type Dispatcher struct {
-	// Job Queues
-	TimeJobQueue  *queue.TimeJobQueue
-	WaitJobQueue  *queue.WaitJobQueue
-	ScoreJobQueue *queue.ScoreJobQueue
-
-	// Worker Queues
-	TimeWorkerQueue  *queue.TimeWorkerQueue
-	WaitWorkerQueue  *queue.WaitWorkerQueue
+	mu sync.Mutex
+	// wake is poked (non-blocking) whenever a job or worker arrives, so Run can sleep in between.
+	wake chan struct{}
+
+	// Policy decides the order inside FairJobQueue's per-tenant heaps and ScoreWorkerQueue.
+	Policy policy.ScoringPolicy
+
+	// Job Queues. Every heap is indexed by job ID, so "remove from the other queues"
+	// is O(log N) per heap instead of a linear scan. TimeJobQueue holds every queued job
+	// and doubles as the ID index.
+	TimeJobQueue   *queue.JobHeap
+	WaitJobQueue   *queue.JobHeap
+	FairJobQueue   *queue.FairJobQueue // Score order within a tenant, weighted fair queuing across tenants
+	ExpiryJobQueue *queue.JobHeap      // Soonest TTL/deadline expiry first
+
+	// Worker Queues (indexed by worker ID, TimeWorkerQueue is the worker index)
+	TimeWorkerQueue  *queue.WorkerHeap
+	WaitWorkerQueue  *queue.WorkerHeap
 	ScoreWorkerQueue *queue.ScoreWorkerQueue
 
-	// Maps to track items across queues for safe removal (optional, but good for O(1) lookup if needed)
-	// For this simulation, we will assume removing the popped item from other queues is key.
-	// Since heap removal is O(n) without an index, and we are sharing pointers, we need to handle "already processed" items.
-	// A simple way is to mark the Job/Worker as "Assigned" in the struct, or maintain a set of IDs.
+	// Silent turns off the per-event console logging (useful for large simulations).
+	Silent bool
+
+	// journal is the optional write-ahead log (see Recover). nil = in-memory only.
+	journal    *journal.Journal
+	journalErr error
+
+	// unplaced holds the IDs of queued jobs the last Match could not give to any worker.
+	// The reason is only worked out when asked for, see UnplacedReason.
+	unplaced map[string]struct{}
+	cfg      Config
+
+	// deadLetters are jobs that expired (TTL or deadline passed) before being matched.
+	deadLetters []DeadLetter
+}
+
+// DeadLetter is a job that expired while still queued.
+type DeadLetter struct {
+	Job    *model.Job
+	Reason string
+	At     time.Time
+}
+
+// Config tunes how the Dispatcher keeps its time-dependent score ordering correct.
+type Config struct {
+	// ScoreMode picks how the job score heaps handle aging scores (see queue.ScoreMode).
+	ScoreMode queue.ScoreMode
+	// RefreshCadence is how often ScoreRefresh mode re-heapifies. 0 = before every Match.
+	RefreshCadence time.Duration
+	// Clock is used for score evaluation. nil means time.Now.
+	Clock model.Clock
+	// Policy scores jobs and workers. nil means policy.DefaultWeightedAging().
+	Policy policy.ScoringPolicy
+	// MatchScanLimit caps how many jobs (best first) one Match examines when looking for a
+	// job that some worker can actually run. 0 = no limit.
+	MatchScanLimit int
+	// Utility values one job/worker pairing for MatchBatch. nil values pairs by rank, so the
+	// best jobs get the best workers whatever the sign of the policy's scores (see rankUtility).
+	Utility Utility
+	// HungarianLimit is the largest batch MatchBatch solves optimally; bigger batches use greedy.
+	// 0 means DefaultHungarianLimit; a negative limit makes every batch greedy.
+	HungarianLimit int
+	// DeadlineBoostWindow > 0 wraps Policy in policy.DeadlineBoost: jobs gain up to
+	// DeadlineBoost points over the last DeadlineBoostWindow before their deadline.
+	// The boost is not time-invariant, so the job heaps switch to ScoreRefresh (see RefreshCadence).
+	DeadlineBoostWindow time.Duration
+	DeadlineBoost       float64
+}
+
+// DefaultHungarianLimit is the HungarianLimit used when Config leaves it 0. The Hungarian
+// algorithm is O(n^3), so a 200x200 batch is about eight million steps.
+const DefaultHungarianLimit = 200
+
+// DefaultConfig uses the original weighted formula and keys the score heap on its
+// time-invariant score, so it never goes stale.
+func DefaultConfig() Config {
+	return Config{ScoreMode: queue.ScoreStatic, Policy: policy.DefaultWeightedAging(), MatchScanLimit: 1024, HungarianLimit: DefaultHungarianLimit}
 }
 
 func NewDispatcher() *Dispatcher {
+	return NewDispatcherWithConfig(DefaultConfig())
+}
+
+// NewDispatcherWithPolicy is NewDispatcher with a different scoring policy.
+func NewDispatcherWithPolicy(p policy.ScoringPolicy) *Dispatcher {
+	cfg := DefaultConfig()
+	cfg.Policy = p
+	return NewDispatcherWithConfig(cfg)
+}
+
+func NewDispatcherWithConfig(cfg Config) *Dispatcher {
+	if cfg.Policy == nil {
+		cfg.Policy = policy.DefaultWeightedAging()
+	}
+	if cfg.DeadlineBoostWindow > 0 {
+		cfg.Policy = policy.NewDeadlineBoost(cfg.Policy, cfg.DeadlineBoostWindow, cfg.DeadlineBoost)
+	}
+	if cfg.HungarianLimit == 0 {
+		cfg.HungarianLimit = DefaultHungarianLimit
+	}
 	return &Dispatcher{
-		TimeJobQueue:     &queue.TimeJobQueue{},
-		WaitJobQueue:     &queue.WaitJobQueue{},
-		ScoreJobQueue:    &queue.ScoreJobQueue{},
-		TimeWorkerQueue:  &queue.TimeWorkerQueue{},
-		WaitWorkerQueue:  &queue.WaitWorkerQueue{},
-		ScoreWorkerQueue: &queue.ScoreWorkerQueue{},
+		wake:             make(chan struct{}, 1),
+		Policy:           cfg.Policy,
+		TimeJobQueue:     queue.NewTimeJobQueue(),
+		WaitJobQueue:     queue.NewWaitJobQueue(),
+		FairJobQueue:     queue.NewFairJobQueue(cfg.ScoreMode, cfg.RefreshCadence, cfg.Clock, cfg.Policy),
+		ExpiryJobQueue:   queue.NewExpiryJobQueue(),
+		TimeWorkerQueue:  queue.NewTimeWorkerQueue(),
+		WaitWorkerQueue:  queue.NewWaitWorkerQueue(),
+		ScoreWorkerQueue: queue.NewScoreWorkerQueue(cfg.Clock, cfg.Policy),
+		unplaced:         make(map[string]struct{}),
+		cfg:              cfg,
+	}
+}
+
+func (d *Dispatcher) logf(format string, args ...interface{}) {
+	if !d.Silent {
+		fmt.Printf(format, args...)
 	}
 }
 
-func (d *Dispatcher) AddJob(j *model.Job) {
-	fmt.Printf("[Dispatcher] Adding Job: %s\n", j)
-	d.TimeJobQueue.PushJob(j)
-	d.WaitJobQueue.PushJob(j)
-	d.ScoreJobQueue.PushJob(j)
+// notify wakes a Run loop that is waiting for work. It never blocks.
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
 }
 
-func (d *Dispatcher) AddWorker(w *model.Worker) {
-	fmt.Printf("[Dispatcher] Adding Worker: %s\n", w)
-	d.TimeWorkerQueue.PushWorker(w)
-	d.WaitWorkerQueue.PushWorker(w)
-	d.ScoreWorkerQueue.PushWorker(w)
+func (d *Dispatcher) AddJob(j *model.Job) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.addJob(j)
 }
 
-// removeJobFromAll removes the job from all queues using the Heap Remove if we tracked indices,
-// or we rebuild/filter.
-// For simplicity in this specific "container/heap" usage without a shared index map map:
-// We will just Pop from the ScoreQueue (Master) and then lazily ignore it in others or do a linear scan remove.
-// Given the prompt asks for "queues", synchronization is implied.
-// Linear scan remove is O(N).
-func (d *Dispatcher) removeJob(j *model.Job) {
-	// Helper to remove a specific job from a specific heap interface
-	remove := func(h interface{}, jobID string) {
-		// This is tricky with standard heap interface without exposing the slice.
-		// We will rely on unique IDs.
-		// NOTE: In a real high-perf system, we'd use the map[ID]*Item to get the index.
-		// Here we will just iterate and remove for correctness demonstration.
-		// Since we defined the underlying types as slices in queue package, we can't easily access them without casting or adding Remove helpers there.
-		// Let's rely on the fact that if we POP from one, we should remove from others.
+func (d *Dispatcher) addJob(j *model.Job) error {
+	if d.TimeJobQueue.Contains(j.ID) {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, j.ID)
+	}
+	if err := d.record(journal.Record{Op: journal.OpAddJob, Job: j}); err != nil {
+		return err
+	}
+	d.logf("[Dispatcher] Adding Job: %s\n", j)
+	d.FairJobQueue.PushJob(j)
+	d.queueJob(j)
+	d.maybeCompact()
+	d.notify()
+	return nil
+}
 
-		// To make this robust, let's implement a 'RemoveByID' in the queue package or just handle it here by
-		// popping everything and pushing back except the target. (Inefficient but clear).
-		// actually, let's just mark the job as "Processed" using a map in Dispatcher? No, the user wants queues.
+// queueJob puts j in every job queue but the Score one (the caller pushes or un-takes it there).
+func (d *Dispatcher) queueJob(j *model.Job) {
+	d.TimeJobQueue.Push(j)
+	d.WaitJobQueue.Push(j)
+	if _, ok := j.ExpiryTime(); ok {
+		d.ExpiryJobQueue.Push(j)
+	}
+}
+
+func (d *Dispatcher) AddWorker(w *model.Worker) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.addWorker(w)
+}
+
+func (d *Dispatcher) addWorker(w *model.Worker) error {
+	if d.TimeWorkerQueue.Contains(w.ID) {
+		return fmt.Errorf("%w: %s", ErrDuplicateWorker, w.ID)
+	}
+	if err := d.record(journal.Record{Op: journal.OpAddWorker, Worker: w}); err != nil {
+		return err
+	}
+	d.logf("[Dispatcher] Adding Worker: %s\n", w)
+	d.queueWorker(w)
+	d.maybeCompact()
+	d.notify()
+	return nil
+}
+
+func (d *Dispatcher) queueWorker(w *model.Worker) {
+	d.TimeWorkerQueue.Push(w)
+	d.WaitWorkerQueue.Push(w)
+	d.ScoreWorkerQueue.Push(w)
+}
+
+// RemoveJob cancels a queued job. It returns the removed job, or nil if the ID is not queued.
+// If the removal cannot be journaled it returns the journal error and the job stays queued.
+// Cost: O(log N) per heap.
+func (d *Dispatcher) RemoveJob(id string) (*model.Job, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.TimeJobQueue.Contains(id) {
+		return nil, nil
+	}
+	if err := d.record(journal.Record{Op: journal.OpRemoveJob, JobID: id}); err != nil {
+		return nil, err
+	}
+	j := d.removeJob(id)
+	d.maybeCompact()
+	return j, nil
+}
+
+func (d *Dispatcher) removeJob(id string) *model.Job {
+	j, ok := d.TimeJobQueue.Get(id)
+	if !ok {
+		return nil
+	}
+	d.FairJobQueue.Remove(j)
+	d.removeFromOtherJobQueues(id)
+	return j
+}
+
+// RemoveWorker takes a queued worker out of rotation. It returns the removed worker, or nil if
+// the ID is not queued. If the removal cannot be journaled it returns the journal error and the
+// worker stays queued.
+func (d *Dispatcher) RemoveWorker(id string) (*model.Worker, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.TimeWorkerQueue.Contains(id) {
+		return nil, nil
+	}
+	if err := d.record(journal.Record{Op: journal.OpRemoveWorker, WorkerID: id}); err != nil {
+		return nil, err
 	}
-	_ = remove // placeholder
+	w := d.removeWorker(id)
+	d.maybeCompact()
+	return w, nil
 }
 
-// Helper to remove by Ref (requires scanning the slice)
-func removeJobFromHeap(h heap.Interface, job *model.Job) {
-	// We need to access the underlying slice to find the index.
-	// We can do this by repeated popping or better: modify the Queue implementation to support Remove(item).
-	// But `heap.Remove` takes an index.
-	// Let's defer this complexity. For this algorithm, we MUST pick from the Mathematical/Score queue as per instructions?
-	// "final queue is based on something mathematical dependency... this will assign the job"
-	// So we Pop from ScoreQueue.
+func (d *Dispatcher) removeWorker(id string) *model.Worker {
+	w, ok := d.ScoreWorkerQueue.Remove(id)
+	if !ok {
+		return nil
+	}
+	d.removeFromOtherWorkerQueues(id)
+	return w
 }
 
-// Match attempts to pair the highest priority Job with the highest priority Worker.
-func (d *Dispatcher) Match() {
-	if d.ScoreJobQueue.Len() == 0 || d.ScoreWorkerQueue.Len() == 0 {
-		fmt.Println("[Dispatcher] Not enough jobs or workers to match.")
-		return
+// Match pairs the highest priority Job that some worker can run with the highest priority
+// Worker that can run it. Jobs no worker can run are skipped (they stay queued) and marked,
+// see UnplacedReason. It returns nil when no feasible pair exists, or when the
+// match could not be journaled (both then stay queued, see Err).
+func (d *Dispatcher) Match() *Assignment {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expireJobs(d.now())
+	if d.FairJobQueue.Len() == 0 || d.ScoreWorkerQueue.Len() == 0 {
+		d.logf("[Dispatcher] Not enough jobs or workers to match.\n")
+		return nil
+	}
+	a, err := d.match()
+	if a == nil && err == nil {
+		d.logf("[Dispatcher] No queued worker can run any of the queued jobs.\n")
 	}
+	return a
+}
 
-	// 1. Get Best Job (Mathematical Queue)
-	// We use the ScoreQueue as the decision maker.
-	jobItem := heap.Pop(d.ScoreJobQueue).(*queue.JobItem) // Pop from Score Queue
-	job := jobItem.Job
+// match does the actual pairing. Caller holds mu and has checked both queues are non-empty.
+// It returns the journal error if the chosen pair could not be recorded; nothing is taken then.
+func (d *Dispatcher) match() (*Assignment, error) {
+	// 1. Walk jobs in dispatch order (fair across tenants, best score first within a tenant)
+	// and, for each, walk workers best-first until one has the resources and can finish
+	// before the job's deadline. Nothing is popped until a feasible pair is found,
+	// so skipped jobs and workers simply stay where they are.
+	now := d.now()
+	var job *model.Job
+	var worker *model.Worker
+	examined := 0
+	d.FairJobQueue.Walk(func(j *model.Job) bool {
+		examined++
+		d.ScoreWorkerQueue.Walk(func(w *model.Worker) bool {
+			if d.feasible(j, w, now) {
+				worker = w
+				return false
+			}
+			return true
+		})
+		if worker != nil {
+			job = j
+			return false
+		}
+		d.unplaced[j.ID] = struct{}{}
+		return d.cfg.MatchScanLimit == 0 || examined < d.cfg.MatchScanLimit
+	})
+	if job == nil {
+		return nil, nil
+	}
 
-	// 2. Get Best Worker (Mathematical Queue)
-	workerItem := heap.Pop(d.ScoreWorkerQueue).(*queue.WorkerItem)
-	worker := workerItem.Worker
+	// 2. Journal the decision, then take the pair out of the Score queues by ID
+	// (this also charges the job's tenant).
+	if err := d.record(journal.Record{Op: journal.OpMatch, JobID: job.ID, WorkerID: worker.ID}); err != nil {
+		return nil, err
+	}
+	d.FairJobQueue.Take(job)
+	d.ScoreWorkerQueue.Remove(worker.ID)
 
-	fmt.Printf("\n[MATCH] Assigned %s \n        To       %s\n\n", job, worker)
+	d.logf("\n[MATCH] (%s) Assigned %s \n        To       %s\n\n", d.Policy.Name(), job, worker)
 
 	// 3. Cleanup: Remove from other queues.
-	// Since we popped from ScoreQueue, we need to remove this specific job/worker from Time and Wait queues.
-	d.removeFromOtherJobQueues(job)
-	d.removeFromOtherWorkerQueues(worker)
+	// Since we removed from ScoreQueue, we need to remove this specific job/worker from Time and Wait queues.
+	d.removeFromOtherJobQueues(job.ID)
+	d.removeFromOtherWorkerQueues(worker.ID)
+	d.maybeCompact()
+	return &Assignment{Job: job, Worker: worker}, nil
 }
 
-func (d *Dispatcher) removeFromOtherJobQueues(target *model.Job) {
-	// Brute-force remove for correctness
-	// TimeQueue
-	for i := 0; i < d.TimeJobQueue.Len(); i++ {
-		if d.TimeJobQueue.BaseJobQueue[i].Job.ID == target.ID {
-			heap.Remove(d.TimeJobQueue, i)
-			break
+// feasible reports whether w can take j right now: enough resources and done before the deadline.
+func (d *Dispatcher) feasible(j *model.Job, w *model.Worker, now time.Time) bool {
+	ok, _ := w.CanRun(j)
+	return ok && w.FinishesInTime(j, now)
+}
+
+// explainUnplaced says why no queued worker can run j at now. It costs O(workers * resources),
+// which is why Match only marks skipped jobs and UnplacedReason calls this on demand.
+func (d *Dispatcher) explainUnplaced(j *model.Job, now time.Time) string {
+	names := make([]string, 0, len(j.Requires))
+	for name := range j.Requires {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		best := 0
+		d.ScoreWorkerQueue.Each(func(w *model.Worker) bool {
+			if c := w.Capacity[name]; c > best {
+				best = c
+			}
+			return true
+		})
+		if best < j.Requires[name] {
+			return fmt.Sprintf("needs %s=%d but the largest queued worker has %d", name, j.Requires[name], best)
 		}
 	}
-	// WaitQueue
-	for i := 0; i < d.WaitJobQueue.Len(); i++ {
-		if d.WaitJobQueue.BaseJobQueue[i].Job.ID == target.ID {
-			heap.Remove(d.WaitJobQueue, i)
-			break
+
+	// Resources are available; is it the deadline?
+	var fastest time.Duration = -1
+	d.ScoreWorkerQueue.Each(func(w *model.Worker) bool {
+		if ok, _ := w.CanRun(j); ok {
+			if rt := w.Runtime(j); fastest < 0 || rt < fastest {
+				fastest = rt
+			}
 		}
+		return true
+	})
+	if fastest >= 0 && (j.Deadline.IsZero() || !now.Add(fastest).After(j.Deadline)) {
+		return "a worker that can run it has been queued since the last Match"
+	}
+	if fastest >= 0 {
+		return fmt.Sprintf("cannot finish before deadline: fastest capable worker needs %s, %s left",
+			fastest.Round(time.Second), j.Deadline.Sub(now).Round(time.Second))
 	}
+	return fmt.Sprintf("no single queued worker has all of %v", j.Requires)
 }
 
-func (d *Dispatcher) removeFromOtherWorkerQueues(target *model.Worker) {
-	// TimeQueue
-	for i := 0; i < d.TimeWorkerQueue.Len(); i++ {
-		if d.TimeWorkerQueue.BaseWorkerQueue[i].Worker.ID == target.ID {
-			heap.Remove(d.TimeWorkerQueue, i)
+// expireJobs moves every queued job whose TTL or deadline has passed to the dead-letter list.
+// If an expiry cannot be journaled the sweep stops there; the next one retries it.
+func (d *Dispatcher) expireJobs(now time.Time) {
+	for d.ExpiryJobQueue.Len() > 0 {
+		j, _ := d.ExpiryJobQueue.Peek()
+		at, _ := j.ExpiryTime()
+		if at.After(now) {
+			return
+		}
+		reason := "deadline passed"
+		if j.TTL > 0 && !j.ArrivalTime.Add(j.TTL).After(now) {
+			reason = "ttl expired"
+		}
+		if err := d.record(journal.Record{Op: journal.OpExpire, JobID: j.ID, Reason: reason, At: now}); err != nil {
 			break
 		}
+		d.expireJob(j.ID, reason, now)
 	}
-	// WaitQueue
-	for i := 0; i < d.WaitWorkerQueue.Len(); i++ {
-		if d.WaitWorkerQueue.BaseWorkerQueue[i].Worker.ID == target.ID {
-			heap.Remove(d.WaitWorkerQueue, i)
-			break
+	d.maybeCompact()
+}
+
+func (d *Dispatcher) expireJob(id, reason string, at time.Time) {
+	if j := d.removeJob(id); j != nil {
+		d.deadLetters = append(d.deadLetters, DeadLetter{Job: j, Reason: reason, At: at})
+		d.logf("[Dispatcher] Expired %s (%s)\n", j, reason)
+	}
+}
+
+// ExpireJobs runs the expiry sweep now, without matching. Match and Run also sweep on every call.
+func (d *Dispatcher) ExpireJobs() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expireJobs(d.now())
+}
+
+// DeadLetters returns every job that expired before it could be matched, oldest first.
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeadLetter(nil), d.deadLetters...)
+}
+
+// UnplacedReason returns why the job could not be placed by the last Match that looked at it.
+// ok is false if that Match placed it or never reached it. The reason is worked out now,
+// against the workers queued now.
+func (d *Dispatcher) UnplacedReason(jobID string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.unplaced[jobID]; !ok {
+		return "", false
+	}
+	j, _ := d.TimeJobQueue.Get(jobID)
+	return d.explainUnplaced(j, d.now()), true
+}
+
+// tryMatch is Match without the "not enough" log, for the Run loop.
+func (d *Dispatcher) tryMatch() (*Assignment, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expireJobs(d.now())
+	if d.FairJobQueue.Len() == 0 || d.ScoreWorkerQueue.Len() == 0 {
+		return nil, nil
+	}
+	return d.match()
+}
+
+// Run matches continuously and sends every Assignment to out.
+// It blocks while there is no job or no worker, and returns ctx.Err() once ctx is cancelled,
+// or the journal error if a match cannot be recorded.
+// An assignment that could not be delivered because ctx was cancelled is undone (see unmatch);
+// if journaling that fails, the error is returned along with ctx.Err().
+func (d *Dispatcher) Run(ctx context.Context, out chan<- Assignment) error {
+	for {
+		a, err := d.tryMatch()
+		if err != nil {
+			return err
+		}
+		if a != nil {
+			select {
+			case out <- *a:
+				continue
+			case <-ctx.Done():
+				d.mu.Lock()
+				err := d.unmatch(a)
+				d.mu.Unlock()
+				return errors.Join(ctx.Err(), err)
+			}
 		}
+
+		select {
+		case <-d.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// unmatch undoes a match that was never delivered: one OpUnmatch record, then the job and the
+// worker go back into every queue they were in and the job's tenant gets its fair-queuing
+// charge back. If the record cannot be written nothing changes, so memory still agrees with
+// the journal (which says the pair was matched).
+func (d *Dispatcher) unmatch(a *Assignment) error {
+	if err := d.record(journal.Record{Op: journal.OpUnmatch, Job: a.Job, Worker: a.Worker}); err != nil {
+		return err
 	}
+	d.requeue(a)
+	d.logf("[Dispatcher] Undelivered, queued again: %s and %s\n", a.Job, a.Worker)
+	d.maybeCompact()
+	d.notify()
+	return nil
+}
+
+// requeue is unmatch without the journal record (also used for replay).
+func (d *Dispatcher) requeue(a *Assignment) {
+	d.FairJobQueue.Untake(a.Job)
+	d.queueJob(a.Job)
+	d.queueWorker(a.Worker)
+}
+
+// Pending returns how many jobs and workers are currently queued.
+func (d *Dispatcher) Pending() (jobs, workers int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.FairJobQueue.Len(), d.ScoreWorkerQueue.Len()
+}
+
+// removeFromOtherJobQueues drops the job from the Time, Wait and Expiry heaps by ID.
+// The Score heap is handled by the caller (Take or Remove).
+func (d *Dispatcher) removeFromOtherJobQueues(id string) {
+	d.TimeJobQueue.Remove(id)
+	d.WaitJobQueue.Remove(id)
+	d.ExpiryJobQueue.Remove(id) // no-op if the job never expires
+	delete(d.unplaced, id)
+}
+
+func (d *Dispatcher) removeFromOtherWorkerQueues(id string) {
+	d.TimeWorkerQueue.Remove(id)
+	d.WaitWorkerQueue.Remove(id)
 }
 
 func (d *Dispatcher) PrintStatus() {
+	jobs, workers := d.Pending()
 	fmt.Println("--- Queue Status ---")
-	fmt.Printf("Jobs Pending: %d\n", d.ScoreJobQueue.Len())
-	fmt.Printf("Workers Available: %d\n", d.ScoreWorkerQueue.Len())
+	fmt.Printf("Jobs Pending: %d\n", jobs)
+	fmt.Printf("Workers Available: %d\n", workers)
 	fmt.Println("--------------------")
 }
+
+// TenantStats is the fair-queuing state of one tenant.
+type TenantStats struct {
+	Tenant      string
+	Weight      float64
+	Pending     int
+	Dispatched  int
+	VirtualTime float64
+}
+
+// Stats returns per-tenant queue depth, dispatch counts and fair-queuing state, sorted by tenant.
+func (d *Dispatcher) Stats() []TenantStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tenants := d.FairJobQueue.Tenants()
+	out := make([]TenantStats, 0, len(tenants))
+	for _, tq := range tenants {
+		out = append(out, TenantStats{
+			Tenant:      tq.Tenant,
+			Weight:      tq.Weight,
+			Pending:     tq.Jobs.Len(),
+			Dispatched:  tq.Dispatched,
+			VirtualTime: tq.VirtualTime,
+		})
+	}
+	return out
+}
@@ -0,0 +1,333 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/journal"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// A match Run cannot deliver before ctx is cancelled is undone with one unmatch record: the
+// job and worker are queued again, the tenant's charge is refunded, and recovery agrees.
+func TestRunUndoesUndeliveredMatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatch.log")
+	d, err := Recover(path, DefaultConfig(), journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Silent = true
+	d.AddJob(&model.Job{ID: "J1", ArrivalTime: time.Now(), Tenant: "acme"})
+	d.AddWorker(&model.Worker{ID: "W1", AvailableTime: time.Now()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- d.Run(ctx, make(chan Assignment)) }() // nobody receives
+	for jobs, _ := d.Pending(); jobs > 0; jobs, _ = d.Pending() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run returned %v, want context.Canceled", err)
+	}
+
+	check := func(d *Dispatcher, when string) {
+		t.Helper()
+		if jobs, workers := d.Pending(); jobs != 1 || workers != 1 {
+			t.Fatalf("%s: pending %d jobs, %d workers; want 1, 1", when, jobs, workers)
+		}
+		if s := d.Stats(); len(s) != 1 || s[0].Dispatched != 0 || s[0].VirtualTime != 0 {
+			t.Fatalf("%s: tenant stats %+v, want the match refunded", when, s)
+		}
+	}
+	check(d, "after Run")
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, _, err := journal.ReadLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []journal.Op
+	for _, r := range records {
+		ops = append(ops, r.Op)
+	}
+	want := []journal.Op{journal.OpAddJob, journal.OpAddWorker, journal.OpMatch, journal.OpUnmatch}
+	if fmt.Sprint(ops) != fmt.Sprint(want) {
+		t.Fatalf("journal ops %v, want %v", ops, want)
+	}
+
+	again, err := Recover(path, DefaultConfig(), journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	check(again, "after Recover")
+}
+
+// Run matches while other goroutines add and cancel jobs and add workers. Run with -race.
+// Every job ends up exactly once delivered, cancelled or still queued.
+func TestRunConcurrentAddRemove(t *testing.T) {
+	d := NewDispatcher()
+	d.Silent = true
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan Assignment)
+	done := make(chan error)
+	go func() { done <- d.Run(ctx, out) }()
+
+	var mu sync.Mutex
+	delivered := make(map[string]int)
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		for a := range out {
+			mu.Lock()
+			delivered[a.Job.ID]++
+			mu.Unlock()
+		}
+	}()
+
+	const producers, perProducer = 4, 200
+	var wg sync.WaitGroup
+	var removedMu sync.Mutex
+	removed := make(map[string]bool)
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				id := fmt.Sprintf("P%d_J%d", p, i)
+				if err := d.AddJob(&model.Job{ID: id, ArrivalTime: time.Now(), Tenant: fmt.Sprint(p % 2)}); err != nil {
+					t.Error(err)
+				}
+				if i%2 == 0 {
+					d.AddWorker(&model.Worker{ID: fmt.Sprintf("P%d_W%d", p, i), AvailableTime: time.Now()})
+				}
+				if i%3 != 0 {
+					continue
+				}
+				if j, err := d.RemoveJob(id); err != nil {
+					t.Error(err)
+				} else if j != nil {
+					removedMu.Lock()
+					removed[id] = true
+					removedMu.Unlock()
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	// Let Run drain whatever it can still match, then stop it.
+	for jobs, workers := d.Pending(); jobs > 0 && workers > 0; jobs, workers = d.Pending() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run returned %v", err)
+	}
+	close(out)
+	<-received
+
+	queued, _ := d.Pending()
+	total := 0
+	for id, n := range delivered {
+		if n != 1 {
+			t.Errorf("%s delivered %d times", id, n)
+		}
+		if removed[id] {
+			t.Errorf("%s was cancelled and delivered", id)
+		}
+		total++
+	}
+	if got := total + len(removed) + queued; got != producers*perProducer {
+		t.Fatalf("delivered %d + cancelled %d + queued %d = %d, want %d",
+			total, len(removed), queued, got, producers*perProducer)
+	}
+}
+
+// Once the journal cannot be written, changes are refused instead of applied unrecorded.
+func TestJournalFailureLeavesQueuesAlone(t *testing.T) {
+	d, err := Recover(filepath.Join(t.TempDir(), "dispatch.log"), DefaultConfig(), journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Silent = true
+	d.AddJob(&model.Job{ID: "J1", ArrivalTime: time.Now()})
+	d.AddJob(&model.Job{ID: "J2", ArrivalTime: time.Now()})
+	d.AddWorker(&model.Worker{ID: "W1", AvailableTime: time.Now()})
+	d.AddWorker(&model.Worker{ID: "W2", AvailableTime: time.Now()})
+	d.journal.Close() // every later append fails
+
+	if j, err := d.RemoveJob("J1"); j != nil || err == nil {
+		t.Errorf("RemoveJob = %v, %v; want nil and the journal error", j, err)
+	}
+	if w, err := d.RemoveWorker("W1"); w != nil || err == nil {
+		t.Errorf("RemoveWorker = %v, %v; want nil and the journal error", w, err)
+	}
+	if a := d.Match(); a != nil {
+		t.Errorf("Match = %v, want nil", a)
+	}
+	if res := d.MatchBatch(2); len(res.Assignments) != 0 || res.TotalUtility != 0 {
+		t.Errorf("MatchBatch = %+v, want nothing", res)
+	}
+	if err := d.Run(context.Background(), make(chan Assignment)); err == nil {
+		t.Error("Run returned nil")
+	}
+	if jobs, workers := d.Pending(); jobs != 2 || workers != 2 {
+		t.Errorf("pending %d jobs, %d workers; want 2, 2", jobs, workers)
+	}
+	if d.Err() == nil {
+		t.Error("Err() = nil")
+	}
+}
+
+// A snapshot carries the tenants' fair-queuing state and the dead letters, so recovering from
+// it (with nothing left in the log) gives the same Stats and DeadLetters.
+func TestRecoverRestoresFairnessAndDeadLetters(t *testing.T) {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
+	cfg.Clock = func() time.Time { return clock }
+	path := filepath.Join(t.TempDir(), "dispatch.log")
+	d, err := Recover(path, cfg, journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Silent = true
+	for i := 0; i < 6; i++ {
+		d.AddJob(&model.Job{ID: fmt.Sprintf("A%d", i), ArrivalTime: clock, Tenant: "a", Weight: 2})
+		d.AddJob(&model.Job{ID: fmt.Sprintf("B%d", i), ArrivalTime: clock, Tenant: "b"})
+	}
+	d.AddJob(&model.Job{ID: "Stale", ArrivalTime: clock, Tenant: "c", TTL: time.Minute})
+	for i := 0; i < 5; i++ {
+		d.AddWorker(&model.Worker{ID: fmt.Sprintf("W%d", i), AvailableTime: clock})
+	}
+	clock = clock.Add(2 * time.Minute)
+	for d.Match() != nil {
+	}
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	stats, dead := d.Stats(), d.DeadLetters()
+	d.Close()
+
+	again, err := Recover(path, cfg, journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if got := again.Stats(); fmt.Sprint(got) != fmt.Sprint(stats) {
+		t.Errorf("recovered stats %+v, want %+v", got, stats)
+	}
+	got := again.DeadLetters()
+	if len(got) != 1 || len(dead) != 1 || got[0].Job.ID != "Stale" || got[0].Reason != dead[0].Reason || !got[0].At.Equal(dead[0].At) {
+		t.Errorf("recovered dead letters %+v, want %+v", got, dead)
+	}
+}
+
+// Replaying an expiry dates the dead letter when the job expired, not when recovery runs.
+func TestReplayedExpiryKeepsItsTime(t *testing.T) {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
+	cfg.Clock = func() time.Time { return clock }
+	path := filepath.Join(t.TempDir(), "dispatch.log")
+	d, err := Recover(path, cfg, journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Silent = true
+	d.AddJob(&model.Job{ID: "Stale", ArrivalTime: clock, TTL: time.Minute})
+	clock = clock.Add(2 * time.Minute)
+	expiredAt := clock
+	d.ExpireJobs()
+	d.Close()
+
+	clock = clock.Add(time.Hour)
+	again, err := Recover(path, cfg, journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if dead := again.DeadLetters(); len(dead) != 1 || !dead[0].At.Equal(expiredAt) {
+		t.Fatalf("recovered dead letters %+v, want Stale expired at %s", dead, expiredAt)
+	}
+}
+
+// A removed job or worker is gone from every heap and index, so the same ID can be added again,
+// and recovery agrees with what is left.
+func TestRemoveClearsEveryIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatch.log")
+	d, err := Recover(path, DefaultConfig(), journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Silent = true
+	now := time.Now()
+	job := &model.Job{ID: "J1", ArrivalTime: now, Tenant: "acme", TTL: time.Hour, Requires: model.Resources{"gpu": 1}}
+	worker := &model.Worker{ID: "W1", AvailableTime: now}
+	d.AddJob(job)
+	d.AddJob(&model.Job{ID: "J2", ArrivalTime: now, Tenant: "acme"})
+	d.AddWorker(worker)
+	d.Match() // J2 takes W1; J1 is skipped and marked unplaced
+	d.AddWorker(worker)
+
+	gone := func(when string) {
+		t.Helper()
+		for name, in := range map[string]bool{
+			"TimeJobQueue":     d.TimeJobQueue.Contains("J1"),
+			"WaitJobQueue":     d.WaitJobQueue.Contains("J1"),
+			"ExpiryJobQueue":   d.ExpiryJobQueue.Contains("J1"),
+			"FairJobQueue":     d.FairJobQueue.Len() != 0,
+			"unplaced":         len(d.unplaced) != 0,
+			"TimeWorkerQueue":  d.TimeWorkerQueue.Contains("W1"),
+			"WaitWorkerQueue":  d.WaitWorkerQueue.Contains("W1"),
+			"ScoreWorkerQueue": d.ScoreWorkerQueue.Contains("W1"),
+		} {
+			if in {
+				t.Errorf("%s: still in %s", when, name)
+			}
+		}
+		if st := d.Stats(); len(st) != 1 || st[0].Pending != 0 {
+			t.Errorf("%s: tenant stats %+v, want acme with nothing pending", when, st)
+		}
+	}
+
+	if j, err := d.RemoveJob("J1"); j != job || err != nil {
+		t.Fatalf("RemoveJob = %v, %v; want J1", j, err)
+	}
+	if w, err := d.RemoveWorker("W1"); w != worker || err != nil {
+		t.Fatalf("RemoveWorker = %v, %v; want W1", w, err)
+	}
+	gone("after removal")
+	if j, err := d.RemoveJob("J1"); j != nil || err != nil {
+		t.Errorf("second RemoveJob = %v, %v; want nil, nil", j, err)
+	}
+
+	if err := d.AddJob(job); err != nil {
+		t.Fatalf("adding J1 again: %v", err)
+	}
+	if err := d.AddWorker(worker); err != nil {
+		t.Fatalf("adding W1 again: %v", err)
+	}
+	if jobs, workers := d.Pending(); jobs != 1 || workers != 1 {
+		t.Fatalf("pending %d jobs, %d workers after adding back; want 1, 1", jobs, workers)
+	}
+	d.RemoveJob("J1")
+	d.RemoveWorker("W1")
+	gone("after the second removal")
+	d.Close()
+
+	again, err := Recover(path, DefaultConfig(), journal.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if jobs, workers := again.Pending(); jobs != 0 || workers != 0 {
+		t.Errorf("recovered %d jobs, %d workers; want none", jobs, workers)
+	}
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// Jobs no queued worker can run are passed over without being taken: the jobs behind them
+// still place, the skipped ones stay queued, and UnplacedReason names what is missing.
+func TestMatchSkipsInfeasibleJobs(t *testing.T) {
+	d, now := clockDispatcher(DefaultConfig())
+	start := *now
+	// Arrival order is score order under the default weighted policy.
+	d.AddJob(&model.Job{ID: "GPU", ArrivalTime: start.Add(-3 * time.Minute), Requires: model.Resources{"gpu": 1}})
+	d.AddJob(&model.Job{ID: "Both", ArrivalTime: start.Add(-2 * time.Minute), Requires: model.Resources{"cpu": 8, "mem": 64}})
+	d.AddJob(&model.Job{ID: "Small", ArrivalTime: start.Add(-time.Minute), Requires: model.Resources{"cpu": 2}})
+	d.AddJob(&model.Job{ID: "Plain", ArrivalTime: start})
+	d.AddWorker(&model.Worker{ID: "Cpu", AvailableTime: start, Capacity: model.Resources{"cpu": 8, "mem": 16}})
+	d.AddWorker(&model.Worker{ID: "Mem", AvailableTime: start, Capacity: model.Resources{"cpu": 2, "mem": 64}})
+
+	var got []string
+	for a := d.Match(); a != nil; a = d.Match() {
+		got = append(got, a.Job.ID)
+	}
+	if len(got) != 2 || got[0] != "Small" || got[1] != "Plain" {
+		t.Fatalf("matched %v, want [Small Plain]", got)
+	}
+	if jobs, workers := d.Pending(); jobs != 2 || workers != 0 {
+		t.Fatalf("pending %d jobs, %d workers; want 2, 0", jobs, workers)
+	}
+
+	// The reason is worked out against the workers queued when asked, so queue them again.
+	d.AddWorker(&model.Worker{ID: "Cpu2", AvailableTime: start, Capacity: model.Resources{"cpu": 8, "mem": 16}})
+	d.AddWorker(&model.Worker{ID: "Mem2", AvailableTime: start, Capacity: model.Resources{"cpu": 2, "mem": 64}})
+	want := map[string]string{
+		"GPU":  "needs gpu=1 but the largest queued worker has 0",
+		"Both": "no single queued worker has all of map[cpu:8 mem:64]",
+	}
+	for id, reason := range want {
+		if got, ok := d.UnplacedReason(id); !ok || got != reason {
+			t.Errorf("UnplacedReason(%s) = %q, %v; want %q", id, got, ok, reason)
+		}
+	}
+	if _, ok := d.UnplacedReason("Small"); ok {
+		t.Error("a matched job still has an unplaced reason")
+	}
+
+	d.AddWorker(&model.Worker{ID: "Big", AvailableTime: start, Capacity: model.Resources{"cpu": 8, "mem": 64}})
+	if got, _ := d.UnplacedReason("Both"); got != "a worker that can run it has been queued since the last Match" {
+		t.Errorf("UnplacedReason(Both) with Big queued = %q", got)
+	}
+	if a := d.Match(); a == nil || a.Job.ID != "Both" || a.Worker.ID != "Big" {
+		t.Fatalf("Match = %+v, want Both on Big", a)
+	}
+	if _, ok := d.UnplacedReason("Both"); ok {
+		t.Error("Both still has an unplaced reason after it was matched")
+	}
+}
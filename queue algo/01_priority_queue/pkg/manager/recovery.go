@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/journal"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// Recover builds a journaled Dispatcher from the write-ahead log at path.
+// It loads the snapshot (path + ".snap"), replays the log records written after it,
+// cuts off a torn tail left by a crash, and keeps appending to the same log.
+// Jobs and workers come back with their original ArrivalTime/AvailableTime, so scores are preserved,
+// and so do every tenant's fair-queuing state and the dead letters.
+// If neither file exists this simply starts a new, empty journal.
+func Recover(path string, cfg Config, opts journal.Options) (*Dispatcher, error) {
+	d := NewDispatcherWithConfig(cfg)
+	d.Silent = true // replay quietly; the caller can switch logging back on
+
+	snap, err := journal.ReadSnapshot(journal.SnapshotPath(path))
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	for _, j := range snap.Jobs {
+		d.addJob(j)
+	}
+	for _, t := range snap.Tenants {
+		d.FairJobQueue.Restore(snap.VirtualTime, t.Tenant, t.Weight, t.VirtualTime, t.Dispatched)
+	}
+	for _, dl := range snap.DeadLetters {
+		d.deadLetters = append(d.deadLetters, DeadLetter{Job: dl.Job, Reason: dl.Reason, At: dl.At})
+	}
+	for _, w := range snap.Workers {
+		d.addWorker(w)
+	}
+
+	records, validSize, err := journal.ReadLog(path)
+	if err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	lastSeq := snap.LastSeq
+	for _, r := range records {
+		if r.Seq <= snap.LastSeq {
+			continue // already folded into the snapshot
+		}
+		d.replay(r)
+		lastSeq = r.Seq
+	}
+
+	j, err := journal.Open(path, opts, lastSeq, validSize)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	d.journal = j
+	return d, nil
+}
+
+// replay applies one journal record without journaling it again.
+func (d *Dispatcher) replay(r journal.Record) {
+	switch r.Op {
+	case journal.OpAddJob:
+		d.addJob(r.Job)
+	case journal.OpAddWorker:
+		d.addWorker(r.Worker)
+	case journal.OpMatch:
+		if j, ok := d.TimeJobQueue.Get(r.JobID); ok {
+			d.FairJobQueue.Take(j) // charge the tenant, as the original match did
+			d.removeFromOtherJobQueues(r.JobID)
+		}
+		d.removeWorker(r.WorkerID)
+	case journal.OpRemoveJob:
+		d.removeJob(r.JobID)
+	case journal.OpRemoveWorker:
+		d.removeWorker(r.WorkerID)
+	case journal.OpUnmatch:
+		d.requeue(&Assignment{Job: r.Job, Worker: r.Worker})
+	case journal.OpExpire:
+		at := r.At
+		if at.IsZero() {
+			at = d.now() // written before expiries carried their time
+		}
+		d.expireJob(r.JobID, r.Reason, at)
+	}
+}
+
+// record appends r to the journal, if there is one. The first failure is kept for Err.
+func (d *Dispatcher) record(r journal.Record) error {
+	if d.journal == nil {
+		return nil
+	}
+	if err := d.journal.Append(r); err != nil {
+		d.logf("[Dispatcher] journal write failed: %v\n", err)
+		if d.journalErr == nil {
+			d.journalErr = err
+		}
+		return err
+	}
+	return nil
+}
+
+// maybeCompact snapshots once the journal has grown by CompactEvery records.
+// Called after a change has been applied, so the snapshot always includes it.
+func (d *Dispatcher) maybeCompact() {
+	if d.journal != nil && d.journal.NeedsCompaction() {
+		if err := d.compact(); err != nil && d.journalErr == nil {
+			d.journalErr = err
+		}
+	}
+}
+
+// Compact writes a snapshot of every queued job and worker, the tenants' fair-queuing state and
+// the dead letters, and truncates the log.
+func (d *Dispatcher) Compact() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.journal == nil {
+		return nil
+	}
+	return d.compact()
+}
+
+func (d *Dispatcher) compact() error {
+	snap := &journal.Snapshot{
+		LastSeq:     d.journal.Seq(),
+		Jobs:        make([]*model.Job, 0, d.TimeJobQueue.Len()),
+		Workers:     make([]*model.Worker, 0, d.TimeWorkerQueue.Len()),
+		VirtualTime: d.FairJobQueue.VirtualTime(),
+	}
+	for _, tq := range d.FairJobQueue.Tenants() {
+		snap.Tenants = append(snap.Tenants, journal.TenantState{
+			Tenant: tq.Tenant, Weight: tq.Weight, VirtualTime: tq.VirtualTime, Dispatched: tq.Dispatched,
+		})
+	}
+	for _, dl := range d.deadLetters {
+		snap.DeadLetters = append(snap.DeadLetters, journal.DeadLetter{Job: dl.Job, Reason: dl.Reason, At: dl.At})
+	}
+	d.TimeJobQueue.Each(func(j *model.Job) bool {
+		snap.Jobs = append(snap.Jobs, j)
+		return true
+	})
+	d.TimeWorkerQueue.Each(func(w *model.Worker) bool {
+		snap.Workers = append(snap.Workers, w)
+		return true
+	})
+	// Make every record up to LastSeq durable first: if the snapshot write fails
+	// the log alone must still be complete.
+	if err := d.journal.Sync(); err != nil {
+		return err
+	}
+	if err := journal.WriteSnapshot(journal.SnapshotPath(d.journal.Path()), snap); err != nil {
+		return err
+	}
+	return d.journal.Reset()
+}
+
+// Err returns the first journal failure, if any. A change whose record could not be written is
+// not applied (Add* and Remove* report it, Match returns nil), so the queues never get ahead of
+// the journal. After a failed write the journal refuses every later record (journal.ErrFailed),
+// so every later change fails too; recover from the log to continue.
+func (d *Dispatcher) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.journalErr
+}
+
+// Close flushes and closes the journal. The Dispatcher must not be used afterwards.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.journal == nil {
+		return nil
+	}
+	return d.journal.Close()
+}
@@ -2,15 +2,65 @@ package model
 
 import (
 	"fmt"
+	"sort"
 	"time"
 )
 
+// Clock returns the current time. It is injected wherever scores are evaluated
+// so simulations can control "now" instead of relying on time.Now.
+type Clock func() time.Time
+
+// Scoring weights used by Job.Score and Worker.Score.
+const (
+	JobWaitWeight          = 1.5
+	JobSizeWeight          = 0.5
+	WorkerIdleWeight       = 1.0
+	WorkerEfficiencyWeight = 10.0
+)
+
+// Resources is a set of named resource amounts, e.g. {"cpu": 4, "memMB": 8192, "gpu": 1}.
+// A missing key means zero.
+type Resources map[string]int
+
+// Covers reports whether r has at least need of every resource.
+// If not, it returns the first missing resource name (in sorted order, so reasons are stable).
+func (r Resources) Covers(need Resources) (bool, string) {
+	names := make([]string, 0, len(need))
+	for name := range need {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if r[name] < need[name] {
+			return false, name
+		}
+	}
+	return true, ""
+}
+
 // Job represents a task to be executed.
 type Job struct {
 	ID          string
 	ArrivalTime time.Time
 	Duration    time.Duration // Estimated execution time
 	Size        int           // Abstract size for score calculation
+	Deadline    time.Time     // Optional. Zero means no deadline. The job must finish by then
+	TTL         time.Duration // Optional. The job expires if still queued TTL after ArrivalTime
+	Requires    Resources     // Optional. What a worker must have to run this job
+	Tenant      string        // Owner for fair queuing. Empty is a tenant like any other
+	Weight      float64       // Tenant's fair-share weight. 0 keeps the tenant's current weight (default 1)
+}
+
+// ExpiryTime is when a still-queued job becomes useless: the earlier of its Deadline
+// and ArrivalTime+TTL. ok is false if the job never expires.
+func (j *Job) ExpiryTime() (t time.Time, ok bool) {
+	if j.TTL > 0 {
+		t, ok = j.ArrivalTime.Add(j.TTL), true
+	}
+	if !j.Deadline.IsZero() && (!ok || j.Deadline.Before(t)) {
+		t, ok = j.Deadline, true
+	}
+	return t, ok
 }
 
 // WaitingTime returns the duration the job has been waiting.
@@ -21,7 +71,12 @@ func (j *Job) WaitingTime() time.Duration {
 // Score calculates the priority score. Higher score = Higher priority.
 // Formula: (Waiting Time (seconds) * 1.5) + (Job Size * 0.5)
 func (j *Job) Score() float64 {
-	return (j.WaitingTime().Seconds() * 1.5) + (float64(j.Size) * 0.5)
+	return j.ScoreAt(time.Now())
+}
+
+// ScoreAt evaluates Score as if the current time were now.
+func (j *Job) ScoreAt(now time.Time) float64 {
+	return (now.Sub(j.ArrivalTime).Seconds() * JobWaitWeight) + (float64(j.Size) * JobSizeWeight)
 }
 
 func (j *Job) String() string {
@@ -32,7 +87,29 @@ func (j *Job) String() string {
 type Worker struct {
 	ID            string
 	AvailableTime time.Time
-	Efficiency    float64 // Multiplier for score
+	Efficiency    float64   // Multiplier for score
+	Capacity      Resources // What this worker can offer to a single job
+}
+
+// Runtime estimates how long the worker needs for the job: Duration / Efficiency.
+// A worker without an Efficiency is treated as 1.0.
+func (w *Worker) Runtime(j *Job) time.Duration {
+	if w.Efficiency <= 0 {
+		return j.Duration
+	}
+	return time.Duration(float64(j.Duration) / w.Efficiency)
+}
+
+// FinishesInTime reports whether the job, started now on this worker, ends by its Deadline.
+// Jobs without a deadline always do.
+func (w *Worker) FinishesInTime(j *Job, now time.Time) bool {
+	return j.Deadline.IsZero() || !now.Add(w.Runtime(j)).After(j.Deadline)
+}
+
+// CanRun reports whether the worker has every resource the job requires.
+// If not, it also returns the name of the first resource that falls short.
+func (w *Worker) CanRun(j *Job) (bool, string) {
+	return w.Capacity.Covers(j.Requires)
 }
 
 // IdleTime returns the duration the worker has been idle.
@@ -43,7 +120,12 @@ func (w *Worker) IdleTime() time.Duration {
 // Score calculates the priority score. Higher score = Higher priority.
 // Formula: (Idle Time (seconds) * 1.0) + (Efficiency * 10)
 func (w *Worker) Score() float64 {
-	return (w.IdleTime().Seconds() * 1.0) + (w.Efficiency * 10.0)
+	return w.ScoreAt(time.Now())
+}
+
+// ScoreAt evaluates Score as if the current time were now.
+func (w *Worker) ScoreAt(now time.Time) float64 {
+	return (now.Sub(w.AvailableTime).Seconds() * WorkerIdleWeight) + (w.Efficiency * WorkerEfficiencyWeight)
 }
 
 func (w *Worker) String() string {
@@ -0,0 +1,271 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// A policy file is a list of "key = value" lines. Blank lines and '#' comments are ignored.
+//
+//	# pick a built-in (then it must be the only key)...
+//	policy = fifo
+//
+//	# ...or write linear formulas
+//	name   = batch-team
+//	job    = 2*wait + 0.1*size - 0.5*duration
+//	worker = idle + 5*efficiency
+//
+// Job variables:    wait (s since arrival), size, duration (s), slack (s until deadline, 0 if none)
+// Worker variables: idle (s since available), efficiency
+// A missing job/worker line falls back to the default weighted formula for that side.
+
+var (
+	jobVars    = map[string]bool{"wait": true, "size": true, "duration": true, "slack": true}
+	workerVars = map[string]bool{"idle": true, "efficiency": true}
+)
+
+// linearExpr is sum(coef[var] * var) + constant.
+type linearExpr struct {
+	coef     map[string]float64
+	constant float64
+}
+
+// parseExpr parses a linear formula like "1.5*wait + 0.5*size - 3".
+// Every term is a product of numbers with at most one variable.
+func parseExpr(src string, vars map[string]bool) (linearExpr, error) {
+	e := linearExpr{coef: make(map[string]float64)}
+	toks, err := tokenize(src)
+	if err != nil {
+		return e, err
+	}
+	if len(toks) == 0 {
+		return e, fmt.Errorf("empty expression")
+	}
+
+	pos := 0
+	for pos < len(toks) {
+		sign := 1.0
+		for pos < len(toks) && (toks[pos] == "+" || toks[pos] == "-") {
+			if toks[pos] == "-" {
+				sign = -sign
+			}
+			pos++
+		}
+
+		factor := sign
+		variable := ""
+		for {
+			if pos >= len(toks) {
+				return e, fmt.Errorf("expression ends with an operator")
+			}
+			tok := toks[pos]
+			pos++
+			if v, err := strconv.ParseFloat(tok, 64); err == nil {
+				factor *= v
+			} else if vars[tok] {
+				if variable != "" {
+					return e, fmt.Errorf("term multiplies %q by %q: only linear formulas are supported", variable, tok)
+				}
+				variable = tok
+			} else {
+				return e, fmt.Errorf("unknown variable %q", tok)
+			}
+			if pos < len(toks) && toks[pos] == "*" {
+				pos++
+				continue
+			}
+			break
+		}
+
+		if variable == "" {
+			e.constant += factor
+		} else {
+			e.coef[variable] += factor
+		}
+
+		if pos < len(toks) && toks[pos] != "+" && toks[pos] != "-" {
+			return e, fmt.Errorf("unexpected %q", toks[pos])
+		}
+	}
+	return e, nil
+}
+
+func tokenize(src string) ([]string, error) {
+	var toks []string
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '+' || r == '-' || r == '*':
+			toks = append(toks, string(r))
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || rs[i] == '.') {
+				i++
+			}
+			toks = append(toks, string(rs[start:i]))
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+				i++
+			}
+			toks = append(toks, strings.ToLower(string(rs[start:i])))
+		default:
+			return nil, fmt.Errorf("unexpected character %q", r)
+		}
+	}
+	return toks, nil
+}
+
+// exprPolicy evaluates a job formula and a worker formula.
+type exprPolicy struct {
+	name   string
+	job    linearExpr
+	worker linearExpr
+}
+
+func (p *exprPolicy) Name() string { return p.name }
+
+func (p *exprPolicy) JobScore(j *model.Job, now time.Time) float64 {
+	slack := 0.0
+	if !j.Deadline.IsZero() {
+		slack = j.Deadline.Sub(now).Seconds()
+	}
+	c := p.job.coef
+	return p.job.constant +
+		c["wait"]*now.Sub(j.ArrivalTime).Seconds() +
+		c["size"]*float64(j.Size) +
+		c["duration"]*j.Duration.Seconds() +
+		c["slack"]*slack
+}
+
+func (p *exprPolicy) WorkerScore(w *model.Worker, now time.Time) float64 {
+	c := p.worker.coef
+	return p.worker.constant +
+		c["idle"]*now.Sub(w.AvailableTime).Seconds() +
+		c["efficiency"]*w.Efficiency
+}
+
+// StaticWorkerScore exists for every formula: the worker variables are idle and efficiency,
+// so every worker's score grows at the same rate (the idle coefficient).
+func (p *exprPolicy) StaticWorkerScore(w *model.Worker) float64 {
+	c := p.worker.coef
+	return p.worker.constant -
+		c["idle"]*seconds(w.AvailableTime) +
+		c["efficiency"]*w.Efficiency
+}
+
+// staticExprPolicy is an exprPolicy whose job formula does not use slack.
+// Then every job's score grows at the same rate (the wait coefficient), so a static job key exists.
+// slack is excluded because jobs without a deadline would age at a different rate from jobs with one.
+type staticExprPolicy struct {
+	*exprPolicy
+}
+
+func (p staticExprPolicy) StaticJobScore(j *model.Job) float64 {
+	c := p.job.coef
+	return p.job.constant -
+		c["wait"]*seconds(j.ArrivalTime) +
+		c["size"]*float64(j.Size) +
+		c["duration"]*j.Duration.Seconds()
+}
+
+// ParsePolicy reads a policy file (see the format above).
+func ParsePolicy(r io.Reader) (ScoringPolicy, error) {
+	def := DefaultWeightedAging()
+	p := &exprPolicy{
+		name: "custom",
+		job: linearExpr{coef: map[string]float64{
+			"wait": def.WaitWeight,
+			"size": def.SizeWeight,
+		}},
+		worker: linearExpr{coef: map[string]float64{
+			"idle":       def.IdleWeight,
+			"efficiency": def.EfficiencyWeight,
+		}},
+	}
+
+	// builtin is set by a "policy = <name>" line, which must be the only key in the file.
+	var builtin ScoringPolicy
+	keys := 0
+
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key, value = strings.TrimSpace(strings.ToLower(key)), strings.TrimSpace(value)
+		if builtin != nil || (key == "policy" && keys > 0) {
+			return nil, fmt.Errorf("line %d: policy = <name> cannot be combined with other keys", lineNo)
+		}
+		keys++
+
+		var err error
+		switch key {
+		case "policy":
+			b, ok := Builtin(strings.ToLower(value))
+			if !ok {
+				return nil, fmt.Errorf("line %d: unknown built-in policy %q", lineNo, value)
+			}
+			builtin = b
+		case "name":
+			p.name = value
+		case "job":
+			p.job, err = parseExpr(value, jobVars)
+		case "worker":
+			p.worker, err = parseExpr(value, workerVars)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if builtin != nil {
+		return builtin, nil
+	}
+
+	if p.job.coef["slack"] != 0 {
+		return p, nil
+	}
+	return staticExprPolicy{p}, nil
+}
+
+// LoadPolicy reads a policy file from disk.
+func LoadPolicy(path string) (ScoringPolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := ParsePolicy(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
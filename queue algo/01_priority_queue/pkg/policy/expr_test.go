@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+		err  string
+	}{
+		{src: "", want: nil},
+		{src: "1.5*wait + 0.5*size", want: []string{"1.5", "*", "wait", "+", "0.5", "*", "size"}},
+		{src: "  -Idle_2*3 ", want: []string{"-", "idle_2", "*", "3"}},
+		{src: "wait/2", err: `unexpected character '/'`},
+		{src: "(wait)", err: `unexpected character '('`},
+	}
+	for _, tc := range tests {
+		got, err := tokenize(tc.src)
+		if tc.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("tokenize(%q) error = %v, want %q", tc.src, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("tokenize(%q) = %q, %v; want %q", tc.src, got, err, tc.want)
+		}
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	job := &model.Job{ArrivalTime: at, Size: 4, Duration: 10 * time.Second, Deadline: at.Add(time.Minute)}
+	worker := &model.Worker{AvailableTime: at, Efficiency: 2}
+	now := at.Add(20 * time.Second)
+
+	tests := []struct {
+		name   string
+		src    string
+		err    string  // non-empty: ParsePolicy must fail with this in the message
+		policy string  // expected Name()
+		job    float64 // expected JobScore(job, now)
+		worker float64 // expected WorkerScore(worker, now)
+		static bool    // expected to implement StaticJobScorer
+	}{
+		{name: "builtin", src: "policy = fifo", policy: "fifo", job: 20, worker: 20, static: true},
+		{name: "builtin upper case", src: "POLICY = SJF", policy: "sjf", job: -10, worker: 2, static: true},
+		{name: "builtin edf", src: "policy = edf\n", policy: "edf", job: -float64(at.Add(time.Minute).Unix()), worker: 2, static: true},
+		{name: "builtin weighted", src: "policy = weighted", policy: "weighted", job: 32, worker: 40, static: true},
+		{name: "unknown builtin", src: "policy = lifo", err: `unknown built-in policy "lifo"`},
+		{name: "key after builtin", src: "policy = fifo\njob = wait", err: "line 2: policy = <name> cannot be combined"},
+		{name: "key before builtin", src: "name = x\npolicy = fifo", err: "line 2: policy = <name> cannot be combined"},
+		{name: "two builtins", src: "policy = fifo\npolicy = sjf", err: "line 2: policy = <name> cannot be combined"},
+		{
+			name:   "formulas with comments",
+			src:    "# header\nname = team # trailing\n\njob = 2*wait + 0.1*size - 0.5*duration\nworker = idle + 5*efficiency\n",
+			policy: "team", job: 40 + 0.4 - 5, worker: 20 + 10, static: true,
+		},
+		{name: "defaults", src: "# nothing but a comment", policy: "custom", job: 32, worker: 40, static: true},
+		{name: "constant and repeated variable", src: "job = 3 + wait - 2*wait*1", policy: "custom", job: 3 - 20, worker: 40, static: true},
+		{name: "slack", src: "job = -slack", policy: "custom", job: -40, worker: 40, static: false},
+		{name: "missing equals", src: "job 2*wait", err: "line 1: expected key = value"},
+		{name: "unknown key", src: "jobs = wait", err: `line 1: unknown key "jobs"`},
+		{name: "unknown job variable", src: "job = idle", err: `line 1: unknown variable "idle"`},
+		{name: "unknown worker variable", src: "\nworker = size", err: `line 2: unknown variable "size"`},
+		{name: "non-linear term", src: "job = wait*size", err: `multiplies "wait" by "size"`},
+		{name: "trailing operator", src: "job = wait +", err: "ends with an operator"},
+		{name: "empty expression", src: "job =", err: "empty expression"},
+		{name: "missing operator", src: "job = 2 wait", err: `unexpected "wait"`},
+		{name: "bad character", src: "worker = idle/2", err: `unexpected character '/'`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := ParsePolicy(strings.NewReader(tc.src))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("error = %v, want %q", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name() != tc.policy {
+				t.Errorf("Name() = %q, want %q", p.Name(), tc.policy)
+			}
+			if got := p.JobScore(job, now); got != tc.job {
+				t.Errorf("JobScore = %v, want %v", got, tc.job)
+			}
+			if got := p.WorkerScore(worker, now); got != tc.worker {
+				t.Errorf("WorkerScore = %v, want %v", got, tc.worker)
+			}
+			if _, ok := p.(StaticJobScorer); ok != tc.static {
+				t.Errorf("static job score = %v, want %v", ok, tc.static)
+			}
+			// Every policy keeps a static worker key, even one whose job formula uses slack.
+			sw, ok := p.(StaticWorkerScorer)
+			if !ok {
+				t.Fatal("no static worker score")
+			}
+			later := &model.Worker{AvailableTime: at.Add(5 * time.Second), Efficiency: 2}
+			if live, static := p.WorkerScore(worker, now)-p.WorkerScore(later, now), sw.StaticWorkerScore(worker)-sw.StaticWorkerScore(later); live != static {
+				t.Errorf("static worker score gap %v, live gap %v", static, live)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package policy
+
+import (
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// ScoringPolicy decides how "good" a Job or Worker is at a given instant.
+// Higher score = Higher priority, for both jobs and workers.
+type ScoringPolicy interface {
+	Name() string
+	JobScore(j *model.Job, now time.Time) float64
+	WorkerScore(w *model.Worker, now time.Time) float64
+}
+
+// StaticScorer is implemented by policies where every job (and every worker) ages at the same rate.
+// The static score then orders items exactly like the live score at any instant,
+// so the score heaps can key on it and never go stale (see queue.ScoreStatic).
+type StaticScorer interface {
+	StaticJobScorer
+	StaticWorkerScorer
+}
+
+// StaticJobScorer and StaticWorkerScorer are the two halves of StaticScorer. A policy can have
+// one without the other: DeadlineBoost bends job scores but leaves worker scores alone, so the
+// worker heap can still key on its Base's static worker score.
+type StaticJobScorer interface {
+	StaticJobScore(j *model.Job) float64
+}
+
+type StaticWorkerScorer interface {
+	StaticWorkerScore(w *model.Worker) float64
+}
+
+// noDeadlineScore puts jobs without a deadline behind every job that has one under EDF.
+const noDeadlineScore = -1e18
+
+func seconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
+
+// --- FIFO ---
+
+// FIFO serves the longest-waiting job first and the longest-idle worker first.
+type FIFO struct{}
+
+func (FIFO) Name() string { return "fifo" }
+func (FIFO) JobScore(j *model.Job, now time.Time) float64 {
+	return now.Sub(j.ArrivalTime).Seconds()
+}
+func (FIFO) WorkerScore(w *model.Worker, now time.Time) float64 {
+	return now.Sub(w.AvailableTime).Seconds()
+}
+func (FIFO) StaticJobScore(j *model.Job) float64       { return -seconds(j.ArrivalTime) }
+func (FIFO) StaticWorkerScore(w *model.Worker) float64 { return -seconds(w.AvailableTime) }
+
+// --- Shortest Job First ---
+
+// ShortestJobFirst serves the job with the smallest estimated Duration first
+// and hands it to the most efficient worker.
+type ShortestJobFirst struct{}
+
+func (ShortestJobFirst) Name() string { return "sjf" }
+func (ShortestJobFirst) JobScore(j *model.Job, now time.Time) float64 {
+	return -j.Duration.Seconds()
+}
+func (ShortestJobFirst) WorkerScore(w *model.Worker, now time.Time) float64 {
+	return w.Efficiency
+}
+func (ShortestJobFirst) StaticJobScore(j *model.Job) float64       { return -j.Duration.Seconds() }
+func (ShortestJobFirst) StaticWorkerScore(w *model.Worker) float64 { return w.Efficiency }
+
+// --- Weighted Aging ---
+
+// WeightedAging is the original formula with the weights pulled out:
+// Job:    (Waiting Time (seconds) * WaitWeight) + (Job Size * SizeWeight)
+// Worker: (Idle Time (seconds) * IdleWeight) + (Efficiency * EfficiencyWeight)
+type WeightedAging struct {
+	WaitWeight       float64
+	SizeWeight       float64
+	IdleWeight       float64
+	EfficiencyWeight float64
+}
+
+// DefaultWeightedAging matches model.Job.Score and model.Worker.Score.
+func DefaultWeightedAging() WeightedAging {
+	return WeightedAging{
+		WaitWeight:       model.JobWaitWeight,
+		SizeWeight:       model.JobSizeWeight,
+		IdleWeight:       model.WorkerIdleWeight,
+		EfficiencyWeight: model.WorkerEfficiencyWeight,
+	}
+}
+
+func (p WeightedAging) Name() string { return "weighted" }
+func (p WeightedAging) JobScore(j *model.Job, now time.Time) float64 {
+	return (now.Sub(j.ArrivalTime).Seconds() * p.WaitWeight) + (float64(j.Size) * p.SizeWeight)
+}
+func (p WeightedAging) WorkerScore(w *model.Worker, now time.Time) float64 {
+	return (now.Sub(w.AvailableTime).Seconds() * p.IdleWeight) + (w.Efficiency * p.EfficiencyWeight)
+}
+func (p WeightedAging) StaticJobScore(j *model.Job) float64 {
+	return (float64(j.Size) * p.SizeWeight) - (seconds(j.ArrivalTime) * p.WaitWeight)
+}
+func (p WeightedAging) StaticWorkerScore(w *model.Worker) float64 {
+	return (w.Efficiency * p.EfficiencyWeight) - (seconds(w.AvailableTime) * p.IdleWeight)
+}
+
+// --- Earliest Deadline First ---
+
+// EarliestDeadlineFirst serves the job with the nearest Deadline first.
+// Jobs without a deadline go last. Workers are ranked by efficiency.
+type EarliestDeadlineFirst struct{}
+
+func (EarliestDeadlineFirst) Name() string { return "edf" }
+func (p EarliestDeadlineFirst) JobScore(j *model.Job, now time.Time) float64 {
+	return p.StaticJobScore(j)
+}
+func (EarliestDeadlineFirst) WorkerScore(w *model.Worker, now time.Time) float64 {
+	return w.Efficiency
+}
+func (EarliestDeadlineFirst) StaticJobScore(j *model.Job) float64 {
+	if j.Deadline.IsZero() {
+		return noDeadlineScore
+	}
+	return -seconds(j.Deadline)
+}
+func (EarliestDeadlineFirst) StaticWorkerScore(w *model.Worker) float64 { return w.Efficiency }
+
+// --- Deadline Boost ---
+
+// DeadlineBoost wraps another policy and adds up to Boost points to a job's score as its
+// Deadline approaches: nothing while more than Window is left, rising linearly to the full
+// Boost at the deadline. Jobs without a deadline are unaffected.
+// The boost makes job scores non-linear in time, so the job score heap falls back to ScoreRefresh.
+// Build it with NewDeadlineBoost, which keeps Base's static worker score.
+type DeadlineBoost struct {
+	Base   ScoringPolicy
+	Window time.Duration
+	Boost  float64
+}
+
+func (p DeadlineBoost) Name() string { return p.Base.Name() + "+deadline" }
+func (p DeadlineBoost) JobScore(j *model.Job, now time.Time) float64 {
+	score := p.Base.JobScore(j, now)
+	if j.Deadline.IsZero() || p.Window <= 0 {
+		return score
+	}
+	slack := j.Deadline.Sub(now)
+	if slack >= p.Window {
+		return score
+	}
+	if slack < 0 {
+		slack = 0
+	}
+	return score + p.Boost*(1-float64(slack)/float64(p.Window))
+}
+func (p DeadlineBoost) WorkerScore(w *model.Worker, now time.Time) float64 {
+	return p.Base.WorkerScore(w, now)
+}
+
+// staticWorkerBoost is a DeadlineBoost over a Base with a static worker score.
+type staticWorkerBoost struct {
+	DeadlineBoost
+}
+
+func (p staticWorkerBoost) StaticWorkerScore(w *model.Worker) float64 {
+	return p.Base.(StaticWorkerScorer).StaticWorkerScore(w)
+}
+
+// NewDeadlineBoost wraps base in a DeadlineBoost. The result forwards base's static worker
+// score when it has one; a zero window or boost changes nothing, so base itself is returned
+// with all of its static scores.
+func NewDeadlineBoost(base ScoringPolicy, window time.Duration, boost float64) ScoringPolicy {
+	if window <= 0 || boost == 0 {
+		return base
+	}
+	p := DeadlineBoost{Base: base, Window: window, Boost: boost}
+	if _, ok := base.(StaticWorkerScorer); ok {
+		return staticWorkerBoost{p}
+	}
+	return p
+}
+
+// Builtin returns a built-in policy by name: fifo, sjf, weighted, edf.
+func Builtin(name string) (ScoringPolicy, bool) {
+	switch name {
+	case "fifo":
+		return FIFO{}, true
+	case "sjf":
+		return ShortestJobFirst{}, true
+	case "weighted":
+		return DefaultWeightedAging(), true
+	case "edf":
+		return EarliestDeadlineFirst{}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,33 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+func TestNewDeadlineBoostKeepsStaticScores(t *testing.T) {
+	w := &model.Worker{AvailableTime: time.Unix(100, 0), Efficiency: 2}
+
+	p := NewDeadlineBoost(FIFO{}, time.Minute, 100)
+	if _, ok := p.(StaticJobScorer); ok {
+		t.Error("boosted policy claims a static job score")
+	}
+	sw, ok := p.(StaticWorkerScorer)
+	if !ok {
+		t.Fatal("boosted FIFO lost its static worker score")
+	}
+	if got, want := sw.StaticWorkerScore(w), (FIFO{}).StaticWorkerScore(w); got != want {
+		t.Errorf("StaticWorkerScore = %v, want FIFO's %v", got, want)
+	}
+
+	if _, ok := NewDeadlineBoost(FIFO{}, 0, 100).(StaticScorer); !ok {
+		t.Error("a zero window should leave FIFO fully static")
+	}
+
+	live := NewDeadlineBoost(DeadlineBoost{Base: FIFO{}, Window: time.Minute, Boost: 1}, time.Minute, 100)
+	if _, ok := live.(StaticWorkerScorer); ok {
+		t.Error("a base without a static worker score cannot gain one")
+	}
+}
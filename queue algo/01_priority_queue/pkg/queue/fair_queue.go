@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
+)
+
+// TenantQueue is one tenant's share of the FairJobQueue: its own score heap plus
+// the weighted-fair-queuing bookkeeping.
+type TenantQueue struct {
+	Tenant string
+	Weight float64
+	Jobs   *ScoreJobQueue
+
+	// VirtualTime grows by 1/Weight for every job dispatched, so a tenant with weight 2
+	// can take two jobs for every one a weight-1 tenant takes before it falls behind.
+	VirtualTime float64
+	Dispatched  int
+}
+
+// FairJobQueue is weighted fair queuing across tenants on top of one ScoreJobQueue per tenant.
+// The next job always comes from the backlogged tenant with the lowest virtual time, and
+// inside a tenant jobs still come out in score order. One tenant flooding the queue
+// only makes its own heap deeper; it cannot push other tenants back.
+type FairJobQueue struct {
+	tenants map[string]*TenantQueue
+	size    int
+	// vtime is the system virtual time: the lowest virtual time among backlogged tenants.
+	// A tenant that goes idle and comes back starts from here, so idling does not bank credit.
+	vtime float64
+
+	mode    ScoreMode
+	cadence time.Duration
+	clock   model.Clock
+	policy  policy.ScoringPolicy
+}
+
+func NewFairJobQueue(mode ScoreMode, cadence time.Duration, clock model.Clock, p policy.ScoringPolicy) *FairJobQueue {
+	return &FairJobQueue{
+		tenants: make(map[string]*TenantQueue),
+		mode:    mode,
+		cadence: cadence,
+		clock:   clock,
+		policy:  p,
+	}
+}
+
+func (fq *FairJobQueue) Len() int { return fq.size }
+
+func (fq *FairJobQueue) tenant(j *model.Job) *TenantQueue {
+	tq, ok := fq.tenants[j.Tenant]
+	if !ok {
+		tq = &TenantQueue{
+			Tenant:      j.Tenant,
+			Weight:      1,
+			Jobs:        NewScoreJobQueue(fq.mode, fq.cadence, fq.clock, fq.policy),
+			VirtualTime: fq.vtime,
+		}
+		fq.tenants[j.Tenant] = tq
+	}
+	return tq
+}
+
+// PushJob queues j under its tenant. A positive Job.Weight updates the tenant's weight.
+// It returns false if j's ID is already queued.
+func (fq *FairJobQueue) PushJob(j *model.Job) bool {
+	tq := fq.tenant(j)
+	if tq.Jobs.Contains(j.ID) {
+		return false
+	}
+	if j.Weight > 0 {
+		tq.Weight = j.Weight
+	}
+	if tq.Jobs.Len() == 0 && tq.VirtualTime < fq.vtime {
+		tq.VirtualTime = fq.vtime
+	}
+	fq.size++
+	return tq.Jobs.PushJob(j)
+}
+
+// Remove drops a queued job without charging its tenant (cancellation).
+func (fq *FairJobQueue) Remove(j *model.Job) bool {
+	tq, ok := fq.tenants[j.Tenant]
+	if !ok {
+		return false
+	}
+	if _, ok := tq.Jobs.Remove(j.ID); !ok {
+		return false
+	}
+	fq.size--
+	fq.advance()
+	return true
+}
+
+// Take removes a job that is being dispatched and charges its tenant for it.
+func (fq *FairJobQueue) Take(j *model.Job) bool {
+	tq, ok := fq.tenants[j.Tenant]
+	if !ok {
+		return false
+	}
+	if _, ok := tq.Jobs.Remove(j.ID); !ok {
+		return false
+	}
+	fq.size--
+	tq.VirtualTime += 1 / tq.Weight
+	tq.Dispatched++
+	fq.advance()
+	return true
+}
+
+// Untake puts back a job that Take removed but that was never dispatched after all, and
+// refunds its tenant the charge. The refund stops at the system virtual time: if the system has
+// moved on since the Take, a full refund would leave the tenant credit nobody else has.
+// It returns false if j's ID is already queued.
+func (fq *FairJobQueue) Untake(j *model.Job) bool {
+	tq := fq.tenant(j)
+	if tq.Jobs.Contains(j.ID) {
+		return false
+	}
+	tq.VirtualTime = max(tq.VirtualTime-1/tq.Weight, fq.vtime)
+	tq.Dispatched--
+	fq.size++
+	return tq.Jobs.PushJob(j)
+}
+
+// VirtualTime is the system virtual time (see vtime).
+func (fq *FairJobQueue) VirtualTime() float64 { return fq.vtime }
+
+// Restore sets the system virtual time and one tenant's weight, virtual time and dispatch count,
+// as saved in a snapshot. Call it after queuing the tenant's jobs again, so that their Weight
+// fields do not override the saved weight.
+func (fq *FairJobQueue) Restore(systemVirtualTime float64, tenant string, weight, virtualTime float64, dispatched int) {
+	fq.vtime = systemVirtualTime
+	tq := fq.tenant(&model.Job{Tenant: tenant})
+	tq.Weight, tq.VirtualTime, tq.Dispatched = weight, virtualTime, dispatched
+}
+
+// advance moves the system virtual time up to the slowest backlogged tenant. It never goes back.
+func (fq *FairJobQueue) advance() {
+	min := math.Inf(1)
+	for _, tq := range fq.tenants {
+		if tq.Jobs.Len() > 0 && tq.VirtualTime < min {
+			min = tq.VirtualTime
+		}
+	}
+	if !math.IsInf(min, 1) && min > fq.vtime {
+		fq.vtime = min
+	}
+}
+
+// Walk visits queued jobs in the order they would be dispatched, without removing them:
+// it replays the fair-queuing choice step by step, taking each tenant's jobs best-first.
+func (fq *FairJobQueue) Walk(visit func(*model.Job) bool) {
+	type cursor struct {
+		tq     *TenantQueue
+		walker *HeapWalker[*model.Job, string]
+		vtime  float64
+	}
+	cursors := make([]*cursor, 0, len(fq.tenants))
+	for _, tq := range fq.tenants {
+		if tq.Jobs.Len() == 0 {
+			continue
+		}
+		tq.Jobs.Refresh()
+		cursors = append(cursors, &cursor{tq: tq, walker: tq.Jobs.Walker(), vtime: tq.VirtualTime})
+	}
+	// Stable order for equal virtual times.
+	sort.Slice(cursors, func(a, b int) bool { return cursors[a].tq.Tenant < cursors[b].tq.Tenant })
+
+	for len(cursors) > 0 {
+		best := 0
+		for c := 1; c < len(cursors); c++ {
+			if cursors[c].vtime < cursors[best].vtime {
+				best = c
+			}
+		}
+		cur := cursors[best]
+		j, ok := cur.walker.Next()
+		if !ok {
+			cursors = append(cursors[:best], cursors[best+1:]...)
+			continue
+		}
+		cur.vtime += 1 / cur.tq.Weight
+		if !visit(j) {
+			return
+		}
+	}
+}
+
+// PeekJob returns the job that would be dispatched next, or nil.
+func (fq *FairJobQueue) PeekJob() *model.Job {
+	var job *model.Job
+	fq.Walk(func(j *model.Job) bool {
+		job = j
+		return false
+	})
+	return job
+}
+
+// Tenants returns every tenant seen so far, sorted by name.
+func (fq *FairJobQueue) Tenants() []*TenantQueue {
+	out := make([]*TenantQueue, 0, len(fq.tenants))
+	for _, tq := range fq.tenants {
+		out = append(out, tq)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Tenant < out[b].Tenant })
+	return out
+}
@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
+)
+
+func newFairQueue() *FairJobQueue {
+	return NewFairJobQueue(ScoreStatic, 0, nil, policy.FIFO{})
+}
+
+// push queues n jobs for tenant, each arriving a second after the last.
+func push(fq *FairJobQueue, tenant string, weight float64, n int) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		fq.PushJob(&model.Job{ID: fmt.Sprintf("%s%d", tenant, i), Tenant: tenant, Weight: weight, ArrivalTime: base.Add(time.Duration(i) * time.Second)})
+	}
+}
+
+// dispatch takes the next n jobs and counts them per tenant.
+func dispatch(t *testing.T, fq *FairJobQueue, n int) map[string]int {
+	t.Helper()
+	got := make(map[string]int)
+	for i := 0; i < n; i++ {
+		j := fq.PeekJob()
+		if j == nil || !fq.Take(j) {
+			t.Fatalf("dispatch %d: nothing to take", i)
+		}
+		got[j.Tenant]++
+	}
+	return got
+}
+
+func TestFairQueueWeights(t *testing.T) {
+	fq := newFairQueue()
+	push(fq, "a", 2, 300)
+	push(fq, "b", 1, 300)
+	if got := dispatch(t, fq, 150); got["a"] != 100 || got["b"] != 50 {
+		t.Fatalf("weights 2:1 dispatched %v, want a:100 b:50", got)
+	}
+}
+
+// A tenant with a huge backlog gets its share and no more: a light tenant arriving behind
+// it is served every other job, not after the flood.
+func TestFairQueueFloodDoesNotStarve(t *testing.T) {
+	fq := newFairQueue()
+	push(fq, "flood", 1, 1000)
+	dispatch(t, fq, 100)
+	push(fq, "light", 1, 5)
+	if got := dispatch(t, fq, 10); got["light"] != 5 || got["flood"] != 5 {
+		t.Fatalf("next 10 dispatches %v, want light:5 flood:5", got)
+	}
+}
+
+// A tenant that was idle while others were served comes back at the system virtual time,
+// so it does not get a run of jobs for the time it was away.
+func TestFairQueueIdleTenantBanksNoCredit(t *testing.T) {
+	fq := newFairQueue()
+	push(fq, "a", 1, 100)
+	push(fq, "b", 1, 1)
+	dispatch(t, fq, 2) // one each; b goes idle
+	dispatch(t, fq, 50)
+	push(fq, "b", 1, 20)
+
+	var b *TenantQueue
+	for _, tq := range fq.Tenants() {
+		if tq.Tenant == "b" {
+			b = tq
+		}
+	}
+	if b.VirtualTime != fq.VirtualTime() {
+		t.Fatalf("returning tenant at virtual time %v, want the system's %v", b.VirtualTime, fq.VirtualTime())
+	}
+	if got := dispatch(t, fq, 10); got["b"] > 6 {
+		t.Fatalf("next 10 dispatches %v: the returning tenant jumped the queue", got)
+	}
+}
+
+// An Untake after the system virtual time has moved on refunds no further than it.
+func TestFairQueueUntakeStopsAtSystemTime(t *testing.T) {
+	fq := newFairQueue()
+	push(fq, "a", 1, 3)
+	push(fq, "b", 1, 3)
+	a := fq.PeekJob()
+	fq.Take(a)
+	fq.Take(fq.PeekJob()) // b catches up; the system virtual time is now 1
+	if fq.VirtualTime() != 1 {
+		t.Fatalf("system virtual time %v, want 1", fq.VirtualTime())
+	}
+
+	fq.Untake(a)
+	for _, tq := range fq.Tenants() {
+		if tq.VirtualTime < fq.VirtualTime() {
+			t.Errorf("tenant %s at virtual time %v, behind the system's %v", tq.Tenant, tq.VirtualTime, fq.VirtualTime())
+		}
+	}
+	if got := dispatch(t, fq, 4); got["a"] != 2 || got["b"] != 2 {
+		t.Fatalf("after the refund dispatched %v, want a:2 b:2", got)
+	}
+}
@@ -0,0 +1,318 @@
+package queue
+
+// IndexedHeap is a binary heap of T that also indexes every item by its key K.
+//
+//   - less decides the order; items that compare equal come out in insertion order
+//     (a sequence number breaks ties), so the heap is stable.
+//   - Remove, Fix and Get take a key and cost O(log N) / O(1), no linear scans.
+//   - Entries are stored by value in one slice. Each entry points at a small position slot
+//     (also reachable from the key map), so sifting updates positions without hashing.
+//     Slots are recycled, so a steady Push/Pop/Remove/Fix workload does not allocate at all,
+//     unlike container/heap which needs a fresh *Item for every element it queues.
+//
+// The zero value is not usable; create heaps with NewIndexedHeap.
+type IndexedHeap[T any, K comparable] struct {
+	entries []heapEntry[T]
+	pos     map[K]*heapSlot
+	free    []*heapSlot // slots of removed entries, reused by Push
+	key     func(T) K
+	less    func(a, b T) bool
+	seq     uint64
+}
+
+type heapEntry[T any] struct {
+	val  T
+	seq  uint64
+	slot *heapSlot
+}
+
+// heapSlot holds an entry's current index in entries.
+type heapSlot struct{ i int }
+
+func NewIndexedHeap[T any, K comparable](key func(T) K, less func(a, b T) bool) *IndexedHeap[T, K] {
+	return &IndexedHeap[T, K]{
+		pos:  make(map[K]*heapSlot),
+		key:  key,
+		less: less,
+	}
+}
+
+func (h *IndexedHeap[T, K]) Len() int { return len(h.entries) }
+
+// Contains reports whether an item with key k is queued.
+func (h *IndexedHeap[T, K]) Contains(k K) bool {
+	_, ok := h.pos[k]
+	return ok
+}
+
+// Get returns the queued item with key k.
+func (h *IndexedHeap[T, K]) Get(k K) (T, bool) {
+	s, ok := h.pos[k]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return h.entries[s.i].val, true
+}
+
+// Push adds v. It returns false (and changes nothing) if an item with the same key is queued.
+func (h *IndexedHeap[T, K]) Push(v T) bool {
+	k := h.key(v)
+	if _, ok := h.pos[k]; ok {
+		return false
+	}
+	var s *heapSlot
+	if n := len(h.free); n > 0 {
+		s, h.free = h.free[n-1], h.free[:n-1]
+	} else {
+		s = &heapSlot{}
+	}
+	h.seq++
+	s.i = len(h.entries)
+	h.entries = append(h.entries, heapEntry[T]{val: v, seq: h.seq, slot: s})
+	h.pos[k] = s
+	h.up(s.i)
+	return true
+}
+
+// Peek returns the best item without removing it.
+func (h *IndexedHeap[T, K]) Peek() (T, bool) {
+	if len(h.entries) == 0 {
+		var zero T
+		return zero, false
+	}
+	return h.entries[0].val, true
+}
+
+// Pop removes and returns the best item.
+func (h *IndexedHeap[T, K]) Pop() (T, bool) {
+	if len(h.entries) == 0 {
+		var zero T
+		return zero, false
+	}
+	return h.removeAt(0), true
+}
+
+// PopIf pops the best item only if keep(best) is true.
+func (h *IndexedHeap[T, K]) PopIf(keep func(T) bool) (T, bool) {
+	if len(h.entries) == 0 || !keep(h.entries[0].val) {
+		var zero T
+		return zero, false
+	}
+	return h.removeAt(0), true
+}
+
+// Remove takes the item with key k out of the heap.
+func (h *IndexedHeap[T, K]) Remove(k K) (T, bool) {
+	s, ok := h.pos[k]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return h.removeAt(s.i), true
+}
+
+// Fix restores the heap order after the item with key k changed in a way that affects less
+// (the update-key operation). Its insertion sequence, and so its tie-breaking rank, is kept.
+func (h *IndexedHeap[T, K]) Fix(k K) bool {
+	s, ok := h.pos[k]
+	if !ok {
+		return false
+	}
+	if !h.down(s.i) {
+		h.up(s.i)
+	}
+	return true
+}
+
+// Update replaces the queued item that has v's key with v and re-orders it.
+func (h *IndexedHeap[T, K]) Update(v T) bool {
+	s, ok := h.pos[h.key(v)]
+	if !ok {
+		return false
+	}
+	h.entries[s.i].val = v
+	if !h.down(s.i) {
+		h.up(s.i)
+	}
+	return true
+}
+
+// Init re-heapifies everything in O(N). Use it when less itself has changed,
+// e.g. after moving the snapshot time of a time-dependent score.
+func (h *IndexedHeap[T, K]) Init() {
+	for i := len(h.entries)/2 - 1; i >= 0; i-- {
+		h.down(i)
+	}
+}
+
+// Each visits every item in heap (not priority) order, until visit returns false.
+func (h *IndexedHeap[T, K]) Each(visit func(T) bool) {
+	for _, e := range h.entries {
+		if !visit(e.val) {
+			return
+		}
+	}
+}
+
+// Walk visits items from best to worst without removing them, until visit returns false.
+// Visiting k items costs O(k log k), whatever the heap size.
+func (h *IndexedHeap[T, K]) Walk(visit func(T) bool) {
+	w := h.Walker()
+	for v, ok := w.Next(); ok; v, ok = w.Next() {
+		if !visit(v) {
+			return
+		}
+	}
+}
+
+// Walker returns an iterator over the items from best to worst. The heap must not be
+// modified while the walker is in use.
+func (h *IndexedHeap[T, K]) Walker() *HeapWalker[T, K] {
+	w := &HeapWalker[T, K]{h: h}
+	if len(h.entries) > 0 {
+		w.frontier = append(w.frontier, 0)
+	}
+	return w
+}
+
+// --- internals ---
+
+// before is less with the insertion-order tie-break.
+func (h *IndexedHeap[T, K]) before(a, b heapEntry[T]) bool {
+	if h.less(a.val, b.val) {
+		return true
+	}
+	if h.less(b.val, a.val) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+func (h *IndexedHeap[T, K]) lessAt(i, j int) bool { return h.before(h.entries[i], h.entries[j]) }
+
+// place stores e at i and records its position.
+func (h *IndexedHeap[T, K]) place(i int, e heapEntry[T]) {
+	h.entries[i] = e
+	e.slot.i = i
+}
+
+// up and down move a "hole" instead of swapping: one entry write per level.
+func (h *IndexedHeap[T, K]) up(i int) {
+	e := h.entries[i]
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.before(e, h.entries[parent]) {
+			break
+		}
+		h.place(i, h.entries[parent])
+		i = parent
+	}
+	h.place(i, e)
+}
+
+// down sifts i towards the leaves and reports whether it moved.
+func (h *IndexedHeap[T, K]) down(i int) bool {
+	start, n := i, len(h.entries)
+	e := h.entries[i]
+	for {
+		child := 2*i + 1
+		if child >= n {
+			break
+		}
+		if r := child + 1; r < n && h.lessAt(r, child) {
+			child = r
+		}
+		if !h.before(h.entries[child], e) {
+			break
+		}
+		h.place(i, h.entries[child])
+		i = child
+	}
+	if i != start {
+		h.place(i, e)
+	}
+	return i > start
+}
+
+func (h *IndexedHeap[T, K]) removeAt(i int) T {
+	last := len(h.entries) - 1
+	v := h.entries[i].val
+	delete(h.pos, h.key(v))
+	h.free = append(h.free, h.entries[i].slot)
+	if i != last {
+		h.place(i, h.entries[last])
+	}
+	var zero heapEntry[T]
+	h.entries[last] = zero // don't keep the removed value alive
+	h.entries = h.entries[:last]
+	if i != last {
+		if !h.down(i) {
+			h.up(i)
+		}
+	}
+	return v
+}
+
+// HeapWalker yields the items of an IndexedHeap from best to worst.
+// An entry can only be beaten by its ancestors, so a best-first search from the root
+// (a small heap of positions, the frontier) is enough and the heap itself is never touched.
+type HeapWalker[T any, K comparable] struct {
+	h        *IndexedHeap[T, K]
+	frontier []int
+}
+
+// Next returns the next best item, or false when every item has been visited.
+func (w *HeapWalker[T, K]) Next() (T, bool) {
+	if len(w.frontier) == 0 {
+		var zero T
+		return zero, false
+	}
+	i := w.popFrontier()
+	n := len(w.h.entries)
+	if c := 2*i + 1; c < n {
+		w.pushFrontier(c)
+	}
+	if c := 2*i + 2; c < n {
+		w.pushFrontier(c)
+	}
+	return w.h.entries[i].val, true
+}
+
+func (w *HeapWalker[T, K]) pushFrontier(pos int) {
+	w.frontier = append(w.frontier, pos)
+	i := len(w.frontier) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !w.h.lessAt(w.frontier[i], w.frontier[parent]) {
+			return
+		}
+		w.frontier[i], w.frontier[parent] = w.frontier[parent], w.frontier[i]
+		i = parent
+	}
+}
+
+func (w *HeapWalker[T, K]) popFrontier() int {
+	f := w.frontier
+	top := f[0]
+	last := len(f) - 1
+	f[0] = f[last]
+	f = f[:last]
+	i := 0
+	for {
+		best := i
+		if l := 2*i + 1; l < len(f) && w.h.lessAt(f[l], f[best]) {
+			best = l
+		}
+		if r := 2*i + 2; r < len(f) && w.h.lessAt(f[r], f[best]) {
+			best = r
+		}
+		if best == i {
+			break
+		}
+		f[i], f[best] = f[best], f[i]
+		i = best
+	}
+	w.frontier = f
+	return top
+}
@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"container/heap"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+)
+
+// legacyItem / legacyQueue are the old container/heap design, kept here only to benchmark
+// against: one *Item allocated per job, and every Push/Pop boxed through interface{}.
+type legacyItem struct {
+	Job   *model.Job
+	Index int
+}
+
+type legacyQueue []*legacyItem
+
+func (pq legacyQueue) Len() int           { return len(pq) }
+func (pq legacyQueue) Less(i, j int) bool { return pq[i].Job.ArrivalTime.Before(pq[j].Job.ArrivalTime) }
+func (pq legacyQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].Index = i
+	pq[j].Index = j
+}
+func (pq *legacyQueue) Push(x interface{}) {
+	item := x.(*legacyItem)
+	item.Index = len(*pq)
+	*pq = append(*pq, item)
+}
+func (pq *legacyQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.Index = -1
+	*pq = old[0 : n-1]
+	return item
+}
+
+// benchJobs builds n jobs with shuffled arrival times.
+func benchJobs(n int) []*model.Job {
+	base := time.Now()
+	jobs := make([]*model.Job, n)
+	for i := range jobs {
+		jobs[i] = &model.Job{ID: fmt.Sprintf("B%d", i), ArrivalTime: base.Add(time.Duration((i*7919)%n) * time.Millisecond)}
+	}
+	return jobs
+}
+
+// BenchmarkHeapChurn runs the same steady-state workload (one Push + one Pop per op on a heap
+// holding N jobs, plus a cancel-by-ID every other op) on both designs:
+//
+//	go test ./pkg/queue -bench HeapChurn -benchmem
+func BenchmarkHeapChurn(b *testing.B) {
+	for _, n := range []int{1000, 100000} {
+		jobs := benchJobs(n)
+
+		b.Run(fmt.Sprintf("container_heap/N=%d", n), func(b *testing.B) {
+			pq := &legacyQueue{}
+			byID := make(map[string]*legacyItem, n)
+			for _, j := range jobs {
+				item := &legacyItem{Job: j}
+				heap.Push(pq, item)
+				byID[j.ID] = item
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				item := heap.Pop(pq).(*legacyItem)
+				if i%2 == 0 {
+					// Cancel-by-ID, then put it back.
+					victim := byID[jobs[i%n].ID]
+					if victim.Index >= 0 {
+						heap.Remove(pq, victim.Index)
+						heap.Push(pq, victim)
+					}
+				}
+				fresh := &legacyItem{Job: item.Job}
+				heap.Push(pq, fresh)
+				byID[item.Job.ID] = fresh
+			}
+		})
+
+		b.Run(fmt.Sprintf("indexed/N=%d", n), func(b *testing.B) {
+			pq := NewTimeJobQueue()
+			for _, j := range jobs {
+				pq.Push(j)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				j, _ := pq.Pop()
+				if i%2 == 0 {
+					if victim, ok := pq.Remove(jobs[i%n].ID); ok {
+						pq.Push(victim)
+					}
+				}
+				pq.Push(j)
+			}
+		})
+	}
+}
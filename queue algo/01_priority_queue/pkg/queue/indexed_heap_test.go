@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type heapItem struct {
+	id, pri int
+}
+
+// refEntry is the reference model's copy of a queued item: its key, its current priority and
+// the insertion rank the heap breaks ties with.
+type refEntry struct {
+	id, pri int
+	seq     int
+}
+
+// TestIndexedHeapRandomOps runs random Push / Pop / PopIf / Remove / Fix / Update / Init calls
+// against a slice kept sorted by (priority, insertion order), checking every answer, Len,
+// Peek, Get and a full Walk after each call.
+func TestIndexedHeapRandomOps(t *testing.T) {
+	for seed := int64(1); seed <= 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		h := NewIndexedHeap(func(it *heapItem) int { return it.id }, func(a, b *heapItem) bool { return a.pri < b.pri })
+		items := make(map[int]*heapItem) // queued items by id
+		var ref []refEntry
+		seq := 0
+		sortRef := func() {
+			sort.Slice(ref, func(a, b int) bool {
+				if ref[a].pri != ref[b].pri {
+					return ref[a].pri < ref[b].pri
+				}
+				return ref[a].seq < ref[b].seq
+			})
+		}
+		find := func(id int) int {
+			for k, e := range ref {
+				if e.id == id {
+					return k
+				}
+			}
+			return -1
+		}
+		setPri := func(id, pri int) {
+			ref[find(id)].pri = pri
+			sortRef()
+		}
+
+		for op := 0; op < 2000; op++ {
+			fail := func(format string, args ...interface{}) {
+				t.Helper()
+				t.Fatalf("seed %d op %d: "+format, append([]interface{}{seed, op}, args...)...)
+			}
+			id, pri := r.Intn(60), r.Intn(20)
+			switch r.Intn(8) {
+			case 0, 1:
+				it := &heapItem{id: id, pri: pri}
+				_, queued := items[id]
+				if got := h.Push(it); got == queued {
+					fail("Push(%d) = %v with the key queued = %v", id, got, queued)
+				}
+				if !queued {
+					items[id] = it
+					seq++
+					ref = append(ref, refEntry{id: id, pri: pri, seq: seq})
+					sortRef()
+				}
+			case 2:
+				got, ok := h.Pop()
+				if ok != (len(ref) > 0) || ok && got.id != ref[0].id {
+					fail("Pop() = %v, %v; want %v", got, ok, ref)
+				}
+				if ok {
+					delete(items, got.id)
+					ref = ref[1:]
+				}
+			case 3:
+				keep := func(it *heapItem) bool { return it.pri < pri }
+				got, ok := h.PopIf(keep)
+				want := len(ref) > 0 && ref[0].pri < pri
+				if ok != want || ok && got.id != ref[0].id {
+					fail("PopIf(pri < %d) = %v, %v; want %v from %v", pri, got, ok, want, ref)
+				}
+				if ok {
+					delete(items, got.id)
+					ref = ref[1:]
+				}
+			case 4:
+				got, ok := h.Remove(id)
+				if k := find(id); ok != (k >= 0) || ok && got != items[id] {
+					fail("Remove(%d) = %v, %v", id, got, ok)
+				} else if ok {
+					delete(items, id)
+					ref = append(ref[:k], ref[k+1:]...)
+				}
+			case 5:
+				it, queued := items[id]
+				if queued {
+					it.pri = pri
+					setPri(id, pri)
+				}
+				if got := h.Fix(id); got != queued {
+					fail("Fix(%d) = %v, want %v", id, got, queued)
+				}
+			case 6:
+				it := &heapItem{id: id, pri: pri}
+				_, queued := items[id]
+				if got := h.Update(it); got != queued {
+					fail("Update(%d) = %v, want %v", id, got, queued)
+				}
+				if queued {
+					items[id] = it
+					setPri(id, pri)
+				}
+			default:
+				h.Init()
+			}
+
+			if h.Len() != len(ref) {
+				fail("Len() = %d, want %d", h.Len(), len(ref))
+			}
+			if got, ok := h.Peek(); ok != (len(ref) > 0) || ok && got.id != ref[0].id {
+				fail("Peek() = %v, %v; want %v", got, ok, ref)
+			}
+			if got, ok := h.Get(id); ok != (items[id] != nil) || got != items[id] {
+				fail("Get(%d) = %v, %v; want %v", id, got, ok, items[id])
+			}
+			k := 0
+			h.Walk(func(it *heapItem) bool {
+				if k >= len(ref) || it.id != ref[k].id {
+					fail("Walk visited %v at %d, want %v", it, k, ref)
+				}
+				k++
+				return true
+			})
+			if k != len(ref) {
+				fail("Walk visited %d items, want %d", k, len(ref))
+			}
+		}
+	}
+}
@@ -1,230 +1,179 @@
 package queue
 
 import (
-	"container/heap"
+	"time"
 
 	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
 )
 
-// Item wraps the actual data to manage heap indices
-type JobItem struct {
-	Job   *model.Job
-	Index int
-}
-
-type WorkerItem struct {
-	Worker *model.Worker
-	Index  int
-}
-
-// --- Job Queues ---
-
-// JobQueue interface
-type JobQueue interface {
-	heap.Interface
-	PushJob(*model.Job)
-	PopJob() *model.Job
-	PeekJob() *model.Job
-}
-
-// BaseJobQueue containing the slice
-type BaseJobQueue []*JobItem
+// JobHeap and WorkerHeap are IndexedHeaps keyed by ID.
+// Every queue below is one of these plus an ordering; adding a new ordering is one line:
+//
+//	byPriority := NewJobHeap(func(a, b *model.Job) bool { return a.Size > b.Size })
+type JobHeap = IndexedHeap[*model.Job, string]
+type WorkerHeap = IndexedHeap[*model.Worker, string]
 
-func (pq BaseJobQueue) Len() int { return len(pq) }
+func jobID(j *model.Job) string       { return j.ID }
+func workerID(w *model.Worker) string { return w.ID }
 
-func (pq BaseJobQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].Index = i
-	pq[j].Index = j
+func NewJobHeap(less func(a, b *model.Job) bool) *JobHeap {
+	return NewIndexedHeap(jobID, less)
 }
 
-func (pq *BaseJobQueue) Push(x interface{}) {
-	n := len(*pq)
-	item := x.(*JobItem)
-	item.Index = n
-	*pq = append(*pq, item)
+func NewWorkerHeap(less func(a, b *model.Worker) bool) *WorkerHeap {
+	return NewIndexedHeap(workerID, less)
 }
 
-func (pq *BaseJobQueue) Pop() interface{} {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	old[n-1] = nil // Avoid memory leak
-	item.Index = -1
-	*pq = old[0 : n-1]
-	return item
-}
+// --- Job Queues ---
 
-// --- Specific Job Queues ---
+// ByArrival: earliest ArrivalTime first. This is both the Time queue (min arrival) and the
+// Wait queue (max waiting time), since the longest-waiting job is the one that arrived first.
+func ByArrival(a, b *model.Job) bool { return a.ArrivalTime.Before(b.ArrivalTime) }
+
+// ByExpiry: soonest Job.ExpiryTime first. Only jobs that can expire belong in this queue.
+func ByExpiry(a, b *model.Job) bool {
+	x, _ := a.ExpiryTime()
+	y, _ := b.ExpiryTime()
+	return x.Before(y)
+}
+
+func NewTimeJobQueue() *JobHeap   { return NewJobHeap(ByArrival) }
+func NewWaitJobQueue() *JobHeap   { return NewJobHeap(ByArrival) }
+func NewExpiryJobQueue() *JobHeap { return NewJobHeap(ByExpiry) }
+
+// ScoreMode controls how ScoreJobQueue orders jobs whose score changes with time.
+type ScoreMode int
+
+const (
+	// ScoreStatic orders on the policy's time-invariant static score (policy.StaticJobScorer).
+	// The heap can never go stale, and comparisons do no clock reads.
+	// Policies without a static score fall back to ScoreRefresh.
+	ScoreStatic ScoreMode = iota
+	// ScoreRefresh compares scores at a snapshot time and re-heapifies (Init) whenever
+	// the snapshot is older than Cadence. A Cadence of 0 refreshes on every Pop/Peek,
+	// which makes the popped job the exact current maximum at O(N) cost.
+	ScoreRefresh
+	// ScoreLive evaluates the score at the clock's time on every comparison.
+	// This is the original behaviour and is only ordered as of the last Push/Pop.
+	ScoreLive
+)
 
-// TimeJobQueue: Min-heap based on ArrivalTime
-type TimeJobQueue struct {
-	BaseJobQueue
+// ScoreJobQueue: Max-heap based on the policy's job score.
+type ScoreJobQueue struct {
+	*JobHeap
+	Mode    ScoreMode
+	Cadence time.Duration
+	Clock   model.Clock // nil means time.Now
+	Policy  policy.ScoringPolicy
+
+	static policy.StaticJobScorer // set when Mode == ScoreStatic
+	asOf   time.Time              // snapshot time used by ScoreRefresh
+}
+
+func NewScoreJobQueue(mode ScoreMode, cadence time.Duration, clock model.Clock, p policy.ScoringPolicy) *ScoreJobQueue {
+	pq := &ScoreJobQueue{Mode: mode, Cadence: cadence, Clock: clock, Policy: p}
+	if mode == ScoreStatic {
+		if s, ok := p.(policy.StaticJobScorer); ok {
+			pq.static = s
+		} else {
+			pq.Mode = ScoreRefresh
+		}
+	}
+	pq.JobHeap = NewJobHeap(pq.higher)
+	return pq
 }
 
-func (pq TimeJobQueue) Less(i, j int) bool {
-	return pq.BaseJobQueue[i].Job.ArrivalTime.Before(pq.BaseJobQueue[j].Job.ArrivalTime)
-}
-func (pq *TimeJobQueue) PushJob(j *model.Job) { heap.Push(pq, &JobItem{Job: j}) }
-func (pq *TimeJobQueue) PopJob() *model.Job {
-	if pq.Len() == 0 {
-		return nil
+func (pq *ScoreJobQueue) now() time.Time {
+	if pq.Clock == nil {
+		return time.Now()
 	}
-	return heap.Pop(pq).(*JobItem).Job
-}
-func (pq *TimeJobQueue) PeekJob() *model.Job {
-	if pq.Len() == 0 {
-		return nil
+	return pq.Clock()
+}
+
+// higher is the heap order: higher score first (a max-heap).
+func (pq *ScoreJobQueue) higher(a, b *model.Job) bool {
+	switch pq.Mode {
+	case ScoreStatic:
+		return pq.static.StaticJobScore(a) > pq.static.StaticJobScore(b)
+	case ScoreRefresh:
+		return pq.Policy.JobScore(a, pq.asOf) > pq.Policy.JobScore(b, pq.asOf)
+	default:
+		now := pq.now()
+		return pq.Policy.JobScore(a, now) > pq.Policy.JobScore(b, now)
 	}
-	return pq.BaseJobQueue[0].Job
 }
 
-// WaitJobQueue: Max-heap based on WaitingTime
-type WaitJobQueue struct {
-	BaseJobQueue
-}
-
-func (pq WaitJobQueue) Less(i, j int) bool {
-	// Earlier arrival = Longer wait. We want Longest wait first (Max-heap logic).
-	// So we want 'Before' to be TRUE if i has EARLIER arrival than j.
-	// Logic: If i arriving at 10:00 (Wait 20m) and j at 10:10 (Wait 10m).
-	// We want i < j to be true if i should pop first?
-	// Heap Min-Heap pops the "smallest".
-	// If we want Max-Wait (Earliest Arrival) to pop first, then strictly speaking:
-	// A standard TimeQueue (Min Arrival) IS a Max-Wait Queue.
-	// So Less logic is same: I.Arrival < J.Arrival.
-	return pq.BaseJobQueue[i].Job.ArrivalTime.Before(pq.BaseJobQueue[j].Job.ArrivalTime)
-}
-func (pq *WaitJobQueue) PushJob(j *model.Job) { heap.Push(pq, &JobItem{Job: j}) }
-func (pq *WaitJobQueue) PopJob() *model.Job {
-	if pq.Len() == 0 {
-		return nil
+// Refresh re-heapifies at the current clock time if the snapshot is older than Cadence.
+// It is a no-op outside ScoreRefresh mode. PopJob, PeekJob and Walk call it automatically.
+func (pq *ScoreJobQueue) Refresh() {
+	if pq.Mode != ScoreRefresh {
+		return
 	}
-	return heap.Pop(pq).(*JobItem).Job
-}
-func (pq *WaitJobQueue) PeekJob() *model.Job {
-	if pq.Len() == 0 {
-		return nil
+	now := pq.now()
+	if pq.asOf.IsZero() || now.Sub(pq.asOf) >= pq.Cadence {
+		pq.asOf = now
+		pq.Init()
 	}
-	return pq.BaseJobQueue[0].Job
-}
-
-// ScoreJobQueue: Max-heap based on Score
-type ScoreJobQueue struct {
-	BaseJobQueue
 }
 
-func (pq ScoreJobQueue) Less(i, j int) bool {
-	// Max Heap: We want Higher Score first.
-	// Less(i, j) should return true if i > j? No, heap is Min-Heap.
-	// To make it Max-Heap, Less must return true if i > j.
-	return pq.BaseJobQueue[i].Job.Score() > pq.BaseJobQueue[j].Job.Score()
+func (pq *ScoreJobQueue) PushJob(j *model.Job) bool {
+	if pq.Mode == ScoreRefresh && pq.asOf.IsZero() {
+		pq.asOf = pq.now()
+	}
+	return pq.Push(j)
 }
-func (pq *ScoreJobQueue) PushJob(j *model.Job) { heap.Push(pq, &JobItem{Job: j}) }
 func (pq *ScoreJobQueue) PopJob() *model.Job {
-	if pq.Len() == 0 {
-		return nil
-	}
-	return heap.Pop(pq).(*JobItem).Job
+	pq.Refresh()
+	j, _ := pq.Pop()
+	return j
 }
 func (pq *ScoreJobQueue) PeekJob() *model.Job {
-	if pq.Len() == 0 {
-		return nil
-	}
-	return pq.BaseJobQueue[0].Job
-}
-
-// --- Worker Queues ---
-
-type BaseWorkerQueue []*WorkerItem
-
-func (pq BaseWorkerQueue) Len() int { return len(pq) }
-
-func (pq BaseWorkerQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].Index = i
-	pq[j].Index = j
+	pq.Refresh()
+	j, _ := pq.Peek()
+	return j
 }
 
-func (pq *BaseWorkerQueue) Push(x interface{}) {
-	n := len(*pq)
-	item := x.(*WorkerItem)
-	item.Index = n
-	*pq = append(*pq, item)
+// Walk visits queued jobs from highest to lowest score without removing them,
+// until visit returns false.
+func (pq *ScoreJobQueue) Walk(visit func(*model.Job) bool) {
+	pq.Refresh()
+	pq.JobHeap.Walk(visit)
 }
 
-func (pq *BaseWorkerQueue) Pop() interface{} {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	old[n-1] = nil
-	item.Index = -1
-	*pq = old[0 : n-1]
-	return item
-}
+// --- Worker Queues ---
 
-// TimeWorkerQueue
-type TimeWorkerQueue struct {
-	BaseWorkerQueue
-}
+// ByAvailable: earliest AvailableTime (longest idle) first.
+func ByAvailable(a, b *model.Worker) bool { return a.AvailableTime.Before(b.AvailableTime) }
 
-func (pq TimeWorkerQueue) Less(i, j int) bool {
-	return pq.BaseWorkerQueue[i].Worker.AvailableTime.Before(pq.BaseWorkerQueue[j].Worker.AvailableTime)
-}
-func (pq *TimeWorkerQueue) PushWorker(w *model.Worker) { heap.Push(pq, &WorkerItem{Worker: w}) }
-func (pq *TimeWorkerQueue) PopWorker() *model.Worker {
-	if pq.Len() == 0 {
-		return nil
-	}
-	return heap.Pop(pq).(*WorkerItem).Worker
-}
-func (pq *TimeWorkerQueue) PeekWorker() *model.Worker {
-	if pq.Len() == 0 {
-		return nil
-	}
-	return pq.BaseWorkerQueue[0].Worker
-}
+func NewTimeWorkerQueue() *WorkerHeap { return NewWorkerHeap(ByAvailable) }
+func NewWaitWorkerQueue() *WorkerHeap { return NewWorkerHeap(ByAvailable) }
 
-// WaitWorkerQueue
-type WaitWorkerQueue struct {
-	BaseWorkerQueue
-}
+// ScoreWorkerQueue: Max-heap based on the policy's worker score.
+// Keyed on the static worker score when the policy has one (whether or not its job score is
+// static, see policy.StaticWorkerScorer), otherwise evaluated live.
+type ScoreWorkerQueue struct {
+	*WorkerHeap
+	Clock  model.Clock // nil means time.Now
+	Policy policy.ScoringPolicy
 
-func (pq WaitWorkerQueue) Less(i, j int) bool {
-	return pq.BaseWorkerQueue[i].Worker.AvailableTime.Before(pq.BaseWorkerQueue[j].Worker.AvailableTime)
-}
-func (pq *WaitWorkerQueue) PushWorker(w *model.Worker) { heap.Push(pq, &WorkerItem{Worker: w}) }
-func (pq *WaitWorkerQueue) PopWorker() *model.Worker {
-	if pq.Len() == 0 {
-		return nil
-	}
-	return heap.Pop(pq).(*WorkerItem).Worker
-}
-func (pq *WaitWorkerQueue) PeekWorker() *model.Worker {
-	if pq.Len() == 0 {
-		return nil
-	}
-	return pq.BaseWorkerQueue[0].Worker
+	static policy.StaticWorkerScorer
 }
 
-// ScoreWorkerQueue
-type ScoreWorkerQueue struct {
-	BaseWorkerQueue
+func NewScoreWorkerQueue(clock model.Clock, p policy.ScoringPolicy) *ScoreWorkerQueue {
+	pq := &ScoreWorkerQueue{Clock: clock, Policy: p}
+	pq.static, _ = p.(policy.StaticWorkerScorer)
+	pq.WorkerHeap = NewWorkerHeap(pq.higher)
+	return pq
 }
 
-func (pq ScoreWorkerQueue) Less(i, j int) bool {
-	return pq.BaseWorkerQueue[i].Worker.Score() > pq.BaseWorkerQueue[j].Worker.Score()
-}
-func (pq *ScoreWorkerQueue) PushWorker(w *model.Worker) { heap.Push(pq, &WorkerItem{Worker: w}) }
-func (pq *ScoreWorkerQueue) PopWorker() *model.Worker {
-	if pq.Len() == 0 {
-		return nil
+func (pq *ScoreWorkerQueue) higher(a, b *model.Worker) bool {
+	if pq.static != nil {
+		return pq.static.StaticWorkerScore(a) > pq.static.StaticWorkerScore(b)
 	}
-	return heap.Pop(pq).(*WorkerItem).Worker
-}
-func (pq *ScoreWorkerQueue) PeekWorker() *model.Worker {
-	if pq.Len() == 0 {
-		return nil
+	now := time.Now()
+	if pq.Clock != nil {
+		now = pq.Clock()
 	}
-	return pq.BaseWorkerQueue[0].Worker
+	return pq.Policy.WorkerScore(a, now) > pq.Policy.WorkerScore(b, now)
 }
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/model"
+	"github.com/adarsh/woc1/queue_algo/01_priority_queue/pkg/policy"
+)
+
+// staleRun drives a ScoreJobQueue with a fake clock that ticks one second per operation,
+// mixing pushes and pops. After every pop it compares the popped job's live score with the
+// live maximum over everything that was queued, and returns how many pops were stale and
+// the largest score shortfall seen.
+func staleRun(t *testing.T, mode ScoreMode, cadence time.Duration, p policy.ScoringPolicy) (pops, stale int, worst float64) {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	pq := NewScoreJobQueue(mode, cadence, func() time.Time { return now }, p)
+
+	r := rand.New(rand.NewSource(7))
+	queued := make(map[string]*model.Job)
+	for op := 0; op < 3000; op++ {
+		now = now.Add(time.Second)
+		if len(queued) == 0 || r.Intn(3) > 0 && len(queued) < 40 {
+			j := &model.Job{
+				ID:          fmt.Sprintf("j%d", op),
+				ArrivalTime: now.Add(-time.Duration(r.Intn(30)) * time.Second),
+				Duration:    time.Duration(1+r.Intn(30)) * time.Second,
+				Size:        r.Intn(20),
+				Deadline:    now.Add(time.Duration(r.Intn(120)) * time.Second),
+			}
+			pq.PushJob(j)
+			queued[j.ID] = j
+			continue
+		}
+
+		best := -1e300
+		for _, j := range queued {
+			best = max(best, p.JobScore(j, now))
+		}
+		j := pq.PopJob()
+		if _, ok := queued[j.ID]; !ok {
+			t.Fatalf("op %d: popped %s, which is not queued", op, j.ID)
+		}
+		delete(queued, j.ID)
+		pops++
+		if short := best - p.JobScore(j, now); short > 1e-6 {
+			stale++
+			worst = max(worst, short)
+		}
+	}
+	if pq.Len() != len(queued) {
+		t.Fatalf("queue holds %d jobs, want %d", pq.Len(), len(queued))
+	}
+	return pops, stale, worst
+}
+
+func TestScoreStaticNeverStale(t *testing.T) {
+	pops, stale, worst := staleRun(t, ScoreStatic, 0, policy.DefaultWeightedAging())
+	if stale != 0 {
+		t.Fatalf("ScoreStatic: %d of %d pops were stale (worst shortfall %.3f), want 0", stale, pops, worst)
+	}
+}
+
+func TestScoreRefreshZeroCadenceNeverStale(t *testing.T) {
+	boost := policy.DeadlineBoost{Base: policy.ShortestJobFirst{}, Window: time.Minute, Boost: 100}
+	pops, stale, worst := staleRun(t, ScoreRefresh, 0, boost)
+	if stale != 0 {
+		t.Fatalf("ScoreRefresh/0: %d of %d pops were stale (worst shortfall %.3f), want 0", stale, pops, worst)
+	}
+}
+
+// With a non-zero Cadence the heap is ordered as of a snapshot less than Cadence old, and a
+// DeadlineBoost score moves by at most Boost*Cadence/Window in that time, so no pop can fall
+// further than that behind the true maximum.
+func TestScoreRefreshCadenceBoundsStaleness(t *testing.T) {
+	boost := policy.DeadlineBoost{Base: policy.ShortestJobFirst{}, Window: time.Minute, Boost: 100}
+	cadence := 10 * time.Second
+	pops, stale, worst := staleRun(t, ScoreRefresh, cadence, boost)
+	if stale == 0 {
+		t.Fatalf("ScoreRefresh/%v: no stale pops in %d; the run does not exercise the cadence", cadence, pops)
+	}
+	if stale == pops {
+		t.Fatalf("ScoreRefresh/%v: every one of %d pops was stale", cadence, pops)
+	}
+	bound := boost.Boost * float64(cadence) / float64(boost.Window)
+	if worst > bound+1e-6 {
+		t.Fatalf("ScoreRefresh/%v: worst shortfall %.3f exceeds Boost*Cadence/Window = %.3f", cadence, worst, bound)
+	}
+	t.Logf("ScoreRefresh/%v: %d of %d pops stale, worst shortfall %.3f (bound %.3f)", cadence, stale, pops, worst, bound)
+}
+
+// DeadlineBoost leaves worker scores alone, so the worker heap keys on the base policy's
+// static worker score and never reads the clock.
+func TestScoreWorkerQueueKeepsStaticKeyUnderDeadlineBoost(t *testing.T) {
+	clock := func() time.Time {
+		t.Fatal("ScoreWorkerQueue read the clock")
+		return time.Time{}
+	}
+	pq := NewScoreWorkerQueue(clock, policy.NewDeadlineBoost(policy.FIFO{}, time.Minute, 100))
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, i := range []int{3, 1, 4, 0, 2} {
+		pq.Push(&model.Worker{ID: fmt.Sprintf("w%d", i), AvailableTime: base.Add(time.Duration(i) * time.Second)})
+	}
+	for i := 0; i < 5; i++ {
+		w, _ := pq.Pop()
+		if want := fmt.Sprintf("w%d", i); w.ID != want {
+			t.Fatalf("pop %d = %s, want %s (longest idle first)", i, w.ID, want)
+		}
+	}
+}
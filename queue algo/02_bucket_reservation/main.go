@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/manager"
 	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
@@ -13,9 +15,17 @@ func main() {
 	// system max mem 2000 mb
 	disp := manager.NewDispatcher(2000)
 
+	// simulated clock: jobs "run" for their Duration as we advance it, no sleeping
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	disp.Clock = func() time.Time { return clock }
+	advance := func(d time.Duration) {
+		clock = clock.Add(d)
+		disp.CompleteFinishedJobs()
+	}
+
 	// 1. add small jobs (under 200 mb)
 	for i := 1; i <= 5; i++ {
-		disp.AddJob(&model.Job{ID: fmt.Sprintf("SmallJob_%d", i), SizeMB: 100})
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("SmallJob_%d", i), SizeMB: 100, Duration: 10 * time.Second})
 	}
 
 	// 2. add workers
@@ -30,9 +40,14 @@ func main() {
 
 	fmt.Println("\n>>> Triggering Avalanche: Adding 5 Heavy Jobs (>800MB)")
 	for i := 1; i <= 5; i++ {
-		disp.AddJob(&model.Job{ID: fmt.Sprintf("HeavyJob_%d", i), SizeMB: 1500})
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("HeavyJob_%d", i), SizeMB: 1500, Duration: 30 * time.Second})
 	}
 
+	// Both workers are still busy with their Round 1 jobs: nothing can be assigned.
+	fmt.Println("\n>>> Round 1b: Workers still busy")
+	fmt.Printf("assigned %d jobs\n", len(disp.Match()))
+	advance(10 * time.Second) // Round 1 jobs finish
+
 	fmt.Println("\n>>> Round 2: Avalanche Detection")
 	// The next Match calls should detect avalanche.
 	// We expect HeavyWorker to switching to RESERVED mode.
@@ -40,13 +55,374 @@ func main() {
 	// If HeavyWorker was busy in Round 1 (simulated), it would finish and then check again.
 	// Here, we simulate new match round.
 	disp.Match()
+	advance(30 * time.Second)
 
 	fmt.Println("\n>>> Round 3: Continued Matching")
 	disp.Match()
+	advance(30 * time.Second)
 
 	// Add a new small job to see if HeavyWorker ignores it
-	disp.AddJob(&model.Job{ID: "SmallJob_New", SizeMB: 50})
+	disp.AddJob(&model.Job{ID: "SmallJob_New", SizeMB: 50, Duration: 10 * time.Second})
 	fmt.Println("\n>>> Round 4: Temptation Test")
 	// HeavyWorker should distinct HeavyJob_2 over SmallJob_New
 	disp.Match()
+	advance(30 * time.Second)
+
+	fmt.Println("\n>>> Bucket Layouts (jobs from 10MB to 12GB)")
+	compareLayouts()
+
+	fmt.Println("\n>>> Avalanche Hysteresis (heavy backlog oscillating around 3)")
+	hysteresisCheck()
+
+	fmt.Println("\n>>> Partial Reservation (1 heavy job, 6 large workers, 30 small jobs)")
+	for _, mode := range []manager.ReservationMode{manager.ReserveAll, manager.ReservePartial} {
+		reservationCheck(mode)
+	}
+
+	fmt.Println("\n>>> EASY Backfilling (heavy job waits 30s for the only worker it fits)")
+	for _, on := range []bool{false, true} {
+		backfillCheck(on)
+	}
+
+	fmt.Println("\n>>> Multi-Resource Jobs (bucketing on memory vs on the dominant resource)")
+	multiResourceCheck("memory-only", model.Scale{})
+	multiResourceCheck("dominant", model.DefaultScale())
+
+	fmt.Println("\n>>> Dominant-Resource Fairness (CPU-heavy alice vs memory-heavy bob, 4 workers)")
+	for _, drf := range []bool{false, true} {
+		fairnessCheck(drf)
+	}
+
+	fmt.Println("\n>>> Decision Trace (why each idle worker did or did not get a job)")
+	traceCheck()
+
+	fmt.Println("\n>>> Cancel, Resize and Priority (queued jobs edited by ID)")
+	queueEditCheck()
+
+	fmt.Println("\n>>> Worker Utilization")
+	for _, w := range disp.Workers {
+		fmt.Printf("%s: %d jobs, busy %s, utilization %.0f%%\n", w.ID, w.Completed, w.BusyTime(clock), 100*w.Utilization(clock))
+	}
+	fmt.Printf("overall utilization %.0f%%\n", 100*disp.Utilization())
+}
+
+// compareLayouts queues the same spread of sizes under each layout and shows how many buckets
+// each one needs, plus what each overflow policy does with a job past the last edge.
+func compareLayouts() {
+	const maxMB = 12 * 1024
+	sizes := []int{10, 25, 60, 120, 300, 700, 1500, 3000, 6000, 12000}
+	layouts := []model.BucketLayout{
+		model.LinearLayout{Interval: model.BucketInterval, MaxSizeMB: maxMB},
+		model.GeometricLayout{FirstMB: 16, Factor: 2, MaxSizeMB: maxMB},
+		model.ExplicitLayout{EdgesMB: []int{64, 256, 1024, 2048, 4096, 8192, maxMB + 1}},
+	}
+	for _, layout := range layouts {
+		bm := mustBuckets(layout, model.OverflowReject)
+		bm.Silent = true
+		for i, size := range sizes {
+			bm.AddJob(&model.Job{ID: fmt.Sprintf("J%d", i), SizeMB: size})
+		}
+		fmt.Printf("%-24s %4d buckets, %2d in use\n", layout.Name(), len(bm.Buckets), bm.NonEmpty())
+	}
+
+	huge := &model.Job{ID: "Huge", SizeMB: 40 * 1024}
+	for _, policy := range []model.OverflowPolicy{model.OverflowReject, model.OverflowBucket, model.OverflowGrow} {
+		bm := mustBuckets(layouts[1], policy)
+		bm.Silent = true
+		before := len(bm.Buckets)
+		err := bm.AddJob(huge)
+		fmt.Printf("overflow %-16s buckets %2d -> %2d, err: %v\n", policy, before, len(bm.Buckets), err)
+	}
+
+	// Layouts that can't work are refused up front.
+	for _, bad := range []model.BucketLayout{
+		model.LinearLayout{Interval: 0, MaxSizeMB: maxMB},
+		model.ExplicitLayout{},
+		model.ExplicitLayout{EdgesMB: []int{256, 64, 64}},
+	} {
+		_, err := model.NewBucketManagerWithLayout(bad, model.OverflowReject)
+		fmt.Println("rejected:", err)
+	}
+
+	// A worker with 5000MB must not get a 6000MB job just because both fall in the 4096-8192 bucket.
+	bm := mustBuckets(layouts[1], model.OverflowReject)
+	bm.Silent = true
+	bm.AddJob(&model.Job{ID: "Big6000", SizeMB: 6000})
+	bm.AddJob(&model.Job{ID: "Fit3000", SizeMB: 3000})
+	fmt.Printf("5000MB worker gets %s\n", bm.GetHeaviestJobForCapacity(5000, 0))
+}
+
+// mustBuckets is NewBucketManagerWithLayout for the demos' layouts, which are known to be valid.
+func mustBuckets(layout model.BucketLayout, overflow model.OverflowPolicy) *model.BucketManager {
+	bm, err := model.NewBucketManagerWithLayout(layout, overflow)
+	if err != nil {
+		panic(err)
+	}
+	return bm
+}
+
+// hysteresisCheck feeds the same oscillating heavy backlog to the old on/off rule and to the
+// default enter/exit thresholds with a minimum dwell, and counts mode switches.
+// Then it shows a single heavy job triggering reservation just by waiting too long.
+func hysteresisCheck() {
+	legacy := manager.DefaultConfig()
+	legacy.EnterBacklog, legacy.ExitBacklog = 3, 2 // on at >= 3, off below 3: the old rule
+	legacy.EnterOldestWait, legacy.MinDwell = 0, 0
+
+	for _, c := range []struct {
+		name string
+		cfg  manager.Config
+	}{{"old on/off", legacy}, {"hysteresis", manager.DefaultConfig()}} {
+		clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		bm := model.NewBucketManager(2000)
+		bm.Silent = true
+		disp := manager.NewDispatcherWithConfig(bm, c.cfg)
+		disp.Clock = func() time.Time { return clock }
+
+		disp.AddJob(&model.Job{ID: "H0", SizeMB: 800})
+		disp.AddJob(&model.Job{ID: "H1", SizeMB: 800})
+		for step := 0; step < 12; step++ {
+			clock = clock.Add(10 * time.Second)
+			if step%2 == 0 {
+				disp.AddJob(&model.Job{ID: fmt.Sprintf("H%d", step+2), SizeMB: 800})
+			} else {
+				bm.GetHeaviestJobForCapacity(2000, 0)
+			}
+			disp.CheckAvalancheStatus()
+		}
+		fmt.Printf("%-11s %2d transitions in 12 steps\n", c.name, len(disp.Events))
+	}
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := manager.DefaultConfig()
+	cfg.OnTransition = func(ev manager.AvalancheEvent) {
+		fmt.Printf("event at +%s: active=%v (%s)\n", ev.At.Sub(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), ev.Active, ev.Reason)
+	}
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	disp := manager.NewDispatcherWithConfig(bm, cfg)
+	disp.Clock = func() time.Time { return clock }
+	disp.AddJob(&model.Job{ID: "Lonely", SizeMB: 1200})
+	for i := 0; i < 4; i++ {
+		clock = clock.Add(time.Minute)
+		disp.CheckAvalancheStatus()
+	}
+}
+
+// reservationCheck runs the same load under a reservation mode for 80 simulated seconds and
+// reports how many small jobs got through and how much worker time reservation left idle.
+// Partial reservation hands every held worker the heavy job it was held for in the same round,
+// so none of its workers is ever left idle.
+func reservationCheck(mode manager.ReservationMode) {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := manager.DefaultConfig()
+	cfg.EnterBacklog, cfg.ExitBacklog = 1, 0 // a single heavy job is enough to reserve
+	cfg.MinDwell = time.Minute
+	cfg.Reservation = mode
+	cfg.Backfill = false // compare the reservation modes on their own
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	disp := manager.NewDispatcherWithConfig(bm, cfg)
+	disp.Silent = true
+	disp.Clock = func() time.Time { return clock }
+
+	for i := 0; i < 6; i++ {
+		disp.AddWorker(&model.Worker{ID: fmt.Sprintf("Large_%d", i), CapacityMB: 2000})
+	}
+	disp.AddJob(&model.Job{ID: "Heavy", SizeMB: 1500, Duration: time.Minute})
+	for i := 0; i < 30; i++ {
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("Small_%d", i), SizeMB: 100, Duration: 10 * time.Second})
+	}
+
+	small := 0
+	for round := 0; round < 8; round++ {
+		for _, a := range disp.Match() {
+			if a.Job.SizeMB < cfg.JobLargeThreshold {
+				small++
+			}
+		}
+		clock = clock.Add(10 * time.Second)
+		disp.CompleteFinishedJobs()
+	}
+
+	var idle time.Duration
+	report := disp.ReservationReport()
+	for _, r := range report {
+		idle += r.Idle
+	}
+	fmt.Printf("%-16s small jobs run %2d, %d workers left idle, reserved-idle %s\n", mode, small, len(report), idle)
+}
+
+// backfillCheck holds four 1000MB workers for a 1900MB job that only the 2000MB worker can run,
+// and that worker is busy for another 30s. With backfilling the held workers run the small jobs
+// estimated to finish within those 30s; the heavy job still starts on time.
+func backfillCheck(backfill bool) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	cfg := manager.DefaultConfig()
+	cfg.EnterBacklog = 1
+	cfg.Reservation = manager.ReserveAll
+	cfg.Backfill = backfill
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	disp := manager.NewDispatcherWithConfig(bm, cfg)
+	disp.Silent = true
+	disp.Clock = func() time.Time { return clock }
+
+	disp.AddWorker(&model.Worker{ID: "Big", CapacityMB: 2000})
+	disp.AddJob(&model.Job{ID: "Prep", SizeMB: 500, Duration: 30 * time.Second})
+	disp.Match() // Big is busy with Prep until +30s
+
+	for i := 0; i < 4; i++ {
+		disp.AddWorker(&model.Worker{ID: fmt.Sprintf("Mid_%d", i), CapacityMB: 1000})
+	}
+	disp.AddJob(&model.Job{ID: "Heavy", SizeMB: 1900, Duration: time.Minute})
+	for _, est := range []int{10, 20, 25, 45} {
+		// The 25s job really takes 28s: still inside the window, estimates need not be exact.
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("Small_%ds", est), SizeMB: 200, Estimate: time.Duration(est) * time.Second,
+			Duration: time.Duration(est+est/8) * time.Second})
+	}
+
+	if backfill {
+		for _, s := range disp.Shadows() {
+			fmt.Printf("shadow: %s on %s at +%s\n", s.Job.ID, s.Worker.ID, s.Start.Sub(start))
+		}
+	}
+
+	var ran []string
+	heavyAt := time.Duration(-1)
+	for clock.Sub(start) <= time.Minute {
+		for _, a := range disp.Match() {
+			if a.Job.ID == "Heavy" {
+				heavyAt = clock.Sub(start)
+			} else if heavyAt < 0 {
+				ran = append(ran, a.Job.ID)
+			}
+		}
+		clock = clock.Add(5 * time.Second)
+		disp.CompleteFinishedJobs()
+	}
+
+	var idle time.Duration
+	for _, r := range disp.ReservationReport() {
+		idle += r.Idle
+	}
+	fmt.Printf("backfill=%-5v before heavy ran %v, heavy started at +%s, reserved-idle %s\n", backfill, ran, heavyAt, idle)
+}
+
+// multiResourceCheck runs one round on three workers shaped for different resources.
+// Bucketed on memory alone, the CPU box looks like the smallest worker and grabs the 1000MB
+// job, leaving the 8-core job with nowhere to run. Bucketed on the dominant resource the
+// 8-core job is "big" and the CPU box, the only worker it fits, takes it first.
+func multiResourceCheck(name string, scale model.Scale) {
+	cfg := manager.DefaultConfig()
+	cfg.EnterBacklog, cfg.EnterOldestWait = 0, 0 // no reservation, just matching
+	cfg.Scale = scale
+	bm := mustBuckets(model.GeometricLayout{FirstMB: 256, Factor: 2, MaxSizeMB: 65536}, model.OverflowBucket)
+	bm.Silent = true
+	disp := manager.NewDispatcherWithConfig(bm, cfg)
+	disp.Silent = true
+
+	disp.AddWorker(&model.Worker{ID: "CPUBox", CapacityMB: 2048, CPUCores: 16, DiskMB: 50000})
+	disp.AddWorker(&model.Worker{ID: "GPUBox", CapacityMB: 16384, CPUCores: 8, DiskMB: 200000, Accelerators: 1})
+	disp.AddWorker(&model.Worker{ID: "MemBox", CapacityMB: 8192, CPUCores: 2, DiskMB: 50000})
+	disp.AddJob(&model.Job{ID: "SmallMem", SizeMB: 1000, CPUCores: 1})
+	disp.AddJob(&model.Job{ID: "CpuJob", SizeMB: 512, CPUCores: 8})
+	disp.AddJob(&model.Job{ID: "Train", SizeMB: 4000, CPUCores: 4, DiskMB: 100000, Accelerators: 1})
+
+	fmt.Printf("%-12s", name)
+	for _, a := range disp.Match() {
+		fmt.Printf(" %s->%s", a.Job.ID, a.Worker.ID)
+	}
+	fmt.Printf(" | still queued: %d\n", disp.Buckets.TotalHeavyJobs(0))
+}
+
+// fairnessCheck queues 8 CPU-heavy jobs for alice and 8 memory-heavy jobs for bob on four
+// 8GB/8-core workers. Heaviest-first gives every worker one of alice's (larger) jobs;
+// DRF alternates so both owners end up with the same dominant share.
+func fairnessCheck(drf bool) {
+	cfg := manager.DefaultConfig()
+	cfg.EnterBacklog, cfg.EnterOldestWait = 0, 0
+	cfg.Scale = model.DefaultScale() // bucket alice's CPU-heavy jobs on their cores
+	cfg.DRF = drf
+	bm := mustBuckets(model.GeometricLayout{FirstMB: 256, Factor: 2, MaxSizeMB: 65536}, model.OverflowBucket)
+	bm.Silent = true
+	disp := manager.NewDispatcherWithConfig(bm, cfg)
+	disp.Silent = true
+
+	for i := 0; i < 4; i++ {
+		disp.AddWorker(&model.Worker{ID: fmt.Sprintf("Node_%d", i), CapacityMB: 8192, CPUCores: 8})
+	}
+	for i := 0; i < 8; i++ {
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("alice_%d", i), Owner: "alice", SizeMB: 1000, CPUCores: 4})
+		disp.AddJob(&model.Job{ID: fmt.Sprintf("bob_%d", i), Owner: "bob", SizeMB: 4096, CPUCores: 1})
+	}
+
+	running := make(map[string]int)
+	for _, a := range disp.Match() {
+		running[a.Job.Owner]++
+	}
+	shares := disp.DominantShares()
+	fmt.Printf("drf=%-5v running alice %d, bob %d | dominant share alice %.2f, bob %.2f\n",
+		drf, running["alice"], running["bob"], shares["alice"], shares["bob"])
+}
+
+// traceCheck runs one round with reservation and backfilling on and prints its decisions:
+// as data, then as the JSON lines TraceWriter produces.
+func traceCheck() {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cfg := manager.DefaultConfig()
+	cfg.EnterBacklog = 1
+	cfg.Reservation = manager.ReserveAll
+	cfg.Backfill = true
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	disp := manager.NewDispatcherWithConfig(bm, cfg)
+	disp.Silent = true
+	disp.Clock = func() time.Time { return clock }
+
+	disp.AddWorker(&model.Worker{ID: "Big", CapacityMB: 2000})
+	disp.AddJob(&model.Job{ID: "Prep", SizeMB: 500, Duration: 30 * time.Second})
+	disp.Match() // Big is busy until +30s
+
+	disp.AddWorker(&model.Worker{ID: "Mid_0", CapacityMB: 1000})
+	disp.AddWorker(&model.Worker{ID: "Mid_1", CapacityMB: 1000})
+	disp.AddWorker(&model.Worker{ID: "Tiny", CapacityMB: 200})
+	disp.AddJob(&model.Job{ID: "Heavy", SizeMB: 1900, Duration: time.Minute})
+	disp.AddJob(&model.Job{ID: "Quick", SizeMB: 200, Duration: 10 * time.Second})
+	disp.AddJob(&model.Job{ID: "Long", SizeMB: 300, Duration: 2 * time.Minute})
+
+	disp.Tracing = true
+	disp.Match()
+	for _, dec := range disp.Trace {
+		fmt.Printf("%-6s %-8s searched %d-%dMB, skipped %d buckets, blocked=%v (%d jobs) -> %q\n",
+			dec.WorkerID, dec.Phase, dec.SearchFromMB, dec.SearchToMB, len(dec.Skipped), dec.Blocked, dec.BlockedJobs, dec.JobID)
+	}
+
+	fmt.Println("as JSON lines:")
+	disp.TraceWriter = os.Stdout
+	clock = clock.Add(5 * time.Second)
+	disp.Match()
+}
+
+// queueEditCheck edits queued jobs through the BucketManager's ID index and shows the order
+// a 2000MB worker then takes them in.
+func queueEditCheck() {
+	bm := model.NewBucketManager(2000)
+	for _, id := range []string{"A", "B", "C", "D"} {
+		bm.AddJob(&model.Job{ID: id, SizeMB: 100})
+	}
+	fmt.Println("duplicate add:", bm.AddJob(&model.Job{ID: "A", SizeMB: 100}))
+
+	bm.SetPriority("C", 5)  // C jumps ahead of A and B in its bucket
+	bm.ResizeJob("D", 1200) // D moves to the 1200-1250MB bucket
+	bm.CancelJob("A")       // A leaves without being matched
+	_, err := bm.CancelJob("A")
+	fmt.Println("cancel again:", err)
+
+	var order []string
+	for j := bm.GetHeaviestJobForCapacity(2000, 0); j != nil; j = bm.GetHeaviestJobForCapacity(2000, 0) {
+		order = append(order, j.ID)
+	}
+	fmt.Println("taken in order:", order)
 }
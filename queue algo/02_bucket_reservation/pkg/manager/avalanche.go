@@ -0,0 +1,143 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// Config holds the reservation (avalanche) settings that used to be package constants.
+//
+// Reservation mode is entered when ANY enabled "Enter" trigger fires and left only when
+// EVERY enabled metric is back at or below its "Exit" value. Keeping Exit below Enter
+// (hysteresis) plus MinDwell stops the mode from flapping at the boundary.
+// A trigger with a zero Enter value is disabled.
+type Config struct {
+	// JobLargeThreshold: jobs of at least this size are "Large" (Heavy),
+	// and workers of at least this capacity can be reserved for them.
+	JobLargeThreshold int
+
+	// Weighted heavy backlog (see model.Backlog.Weighted: one job at the threshold = 1.0).
+	EnterBacklog float64
+	ExitBacklog  float64
+
+	// How long the oldest heavy job has been waiting.
+	EnterOldestWait time.Duration
+	ExitOldestWait  time.Duration
+
+	// MinDwell is the least time to stay in a mode before switching again.
+	MinDwell time.Duration
+
+	// Reservation picks which large workers reservation mode holds back (see ReservationMode).
+	Reservation ReservationMode
+	// Backfill lets a held worker run small jobs whose estimate ends before the earliest
+	// shadow start of the waiting heavy jobs (EASY backfilling, see Shadows).
+	Backfill bool
+
+	// Scale turns CPU, disk and accelerators into memory-equivalent MB. Jobs are bucketed,
+	// and called heavy, on their dominant resource; workers are sized the same way.
+	// The zero Scale buckets on memory only. Every dimension is still checked with Worker.Fits.
+	Scale model.Scale
+	// DRF hands each idle worker a job from the owner with the lowest dominant share
+	// (dominant-resource fairness) instead of the heaviest job overall.
+	DRF bool
+
+	// OnTransition, if set, is called with every enter/exit event (they are also kept in Events).
+	OnTransition func(AvalancheEvent)
+}
+
+// DefaultConfig: heavy means >= 800MB. Reserve when roughly 3 heavy jobs are queued or one has
+// waited 2 minutes; release once at most 1 is left and none has waited over 30s.
+// Backfill, Scale (multi-resource bucketing) and DRF are off: opt in by setting them.
+func DefaultConfig() Config {
+	return Config{
+		JobLargeThreshold: 800,
+		EnterBacklog:      3,
+		ExitBacklog:       1,
+		EnterOldestWait:   2 * time.Minute,
+		ExitOldestWait:    30 * time.Second,
+		MinDwell:          30 * time.Second,
+	}
+}
+
+// AvalancheEvent records one switch into or out of reservation mode.
+type AvalancheEvent struct {
+	At      time.Time
+	Active  bool   // true = entered reservation mode
+	Reason  string // which threshold caused it
+	Backlog model.Backlog
+}
+
+// CheckAvalancheStatus determines if we are in a heavy-load state
+func (d *Dispatcher) CheckAvalancheStatus() {
+	d.checkAvalanche(d.now())
+}
+
+// checkAvalanche is CheckAvalancheStatus at now. It returns the queued heavy jobs when it had
+// to list them, so Match can reuse the list; within MinDwell of the last switch the mode
+// cannot change, nothing is listed and listed is false.
+func (d *Dispatcher) checkAvalanche(now time.Time) (heavy []*model.Job, listed bool) {
+	if !d.lastTransition.IsZero() && now.Sub(d.lastTransition) < d.Config.MinDwell {
+		return nil, false // too soon to switch again
+	}
+	heavy = d.Buckets.HeavyJobs(d.Config.JobLargeThreshold)
+	bl := d.Buckets.BacklogOf(heavy, d.Config.JobLargeThreshold, now)
+
+	if !d.AvalancheActive {
+		if reason := d.enterReason(bl); reason != "" {
+			d.logf("!!! AVALANCHE DETECTED !!! Triggering Reservation Mode (%s).\n", reason)
+			d.transition(true, reason, bl, now)
+		}
+		return heavy, true
+	}
+	if d.cleared(bl) {
+		d.logf("... Avalanche cleared. Resuming normal operation.\n")
+		d.transition(false, fmt.Sprintf("backlog %.1f <= %.1f, oldest wait %s <= %s",
+			bl.Weighted, d.Config.ExitBacklog, bl.OldestWait.Round(time.Second), d.Config.ExitOldestWait), bl, now)
+	}
+	return heavy, true
+}
+
+// enterReason returns which enter trigger fired, or "" if none did.
+func (d *Dispatcher) enterReason(bl model.Backlog) string {
+	c := d.Config
+	if c.EnterBacklog > 0 && bl.Weighted >= c.EnterBacklog {
+		return fmt.Sprintf("heavy backlog %.1f >= %.1f", bl.Weighted, c.EnterBacklog)
+	}
+	if c.EnterOldestWait > 0 && bl.Jobs > 0 && bl.OldestWait >= c.EnterOldestWait {
+		return fmt.Sprintf("oldest heavy job waited %s >= %s", bl.OldestWait.Round(time.Second), c.EnterOldestWait)
+	}
+	return ""
+}
+
+// cleared reports whether every enabled metric is back at or below its exit value.
+func (d *Dispatcher) cleared(bl model.Backlog) bool {
+	c := d.Config
+	if c.EnterBacklog > 0 && bl.Weighted > c.ExitBacklog {
+		return false
+	}
+	if c.EnterOldestWait > 0 && bl.OldestWait > c.ExitOldestWait {
+		return false
+	}
+	return true
+}
+
+func (d *Dispatcher) transition(active bool, reason string, bl model.Backlog, now time.Time) {
+	d.AvalancheActive = active
+	d.lastTransition = now
+	ev := AvalancheEvent{At: now, Active: active, Reason: reason, Backlog: bl}
+	d.Events = append(d.Events, ev)
+	if d.Config.OnTransition != nil {
+		d.Config.OnTransition(ev)
+	}
+}
+
+// DrainEvents returns the avalanche events recorded since the last call and empties Events.
+// A long-running dispatcher should drain them now and then (or use Config.OnTransition),
+// since Events otherwise keeps every switch.
+func (d *Dispatcher) DrainEvents() []AvalancheEvent {
+	ev := d.Events
+	d.Events = nil
+	return ev
+}
@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// avalancheDispatcher uses DefaultConfig (enter at backlog 3 or a 2m wait, exit at 1 and 30s,
+// 30s MinDwell) on a settable clock, and records what OnTransition sees.
+func avalancheDispatcher(clock *time.Time) (*Dispatcher, *[]AvalancheEvent) {
+	var seen []AvalancheEvent
+	cfg := DefaultConfig()
+	cfg.OnTransition = func(ev AvalancheEvent) { seen = append(seen, ev) }
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	d := NewDispatcherWithConfig(bm, cfg)
+	d.Silent = true
+	d.Clock = func() time.Time { return *clock }
+	return d, &seen
+}
+
+func TestAvalancheEnterDwellExit(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	d, seen := avalancheDispatcher(&clock)
+	for i := 0; i < 3; i++ {
+		d.AddJob(&model.Job{ID: fmt.Sprintf("H%d", i), SizeMB: 800})
+	}
+
+	d.CheckAvalancheStatus()
+	if !d.AvalancheActive {
+		t.Fatal("3 heavy jobs queued: not active")
+	}
+
+	// The backlog clears at once, but the mode holds for MinDwell.
+	for i := 0; i < 3; i++ {
+		d.Buckets.CancelJob(fmt.Sprintf("H%d", i))
+	}
+	clock = start.Add(29 * time.Second)
+	d.CheckAvalancheStatus()
+	if !d.AvalancheActive || len(d.Events) != 1 {
+		t.Fatalf("inside MinDwell: active %v after %d events, want still active after 1", d.AvalancheActive, len(d.Events))
+	}
+
+	clock = start.Add(30 * time.Second)
+	d.CheckAvalancheStatus()
+	if d.AvalancheActive {
+		t.Fatal("backlog cleared after MinDwell: still active")
+	}
+
+	want := []AvalancheEvent{
+		{At: start, Active: true, Reason: "heavy backlog 3.0 >= 3.0", Backlog: model.Backlog{Jobs: 3, Weighted: 3}},
+		{At: start.Add(30 * time.Second), Active: false, Reason: "backlog 0.0 <= 1.0, oldest wait 0s <= 30s"},
+	}
+	if !reflect.DeepEqual(d.Events, want) {
+		t.Fatalf("Events = %+v\nwant %+v", d.Events, want)
+	}
+	if !reflect.DeepEqual(*seen, want) {
+		t.Fatalf("OnTransition saw %+v\nwant %+v", *seen, want)
+	}
+	if got := d.DrainEvents(); !reflect.DeepEqual(got, want) || len(d.Events) != 0 {
+		t.Fatalf("DrainEvents = %+v, leaving %d; want both events, leaving none", got, len(d.Events))
+	}
+}
+
+// One heavy job is below the backlog trigger, but waiting 2m enters the mode; the mode stays
+// while it waits and is left once it has gone and MinDwell has passed.
+func TestAvalancheEntersOnOldestWait(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	d, _ := avalancheDispatcher(&clock)
+	d.AddJob(&model.Job{ID: "H", SizeMB: 1600}) // weighs 2.0
+
+	clock = start.Add(time.Minute + 59*time.Second)
+	d.CheckAvalancheStatus()
+	if d.AvalancheActive {
+		t.Fatal("active before the oldest heavy job waited 2m")
+	}
+	clock = start.Add(2 * time.Minute)
+	d.CheckAvalancheStatus()
+	if !d.AvalancheActive || len(d.Events) != 1 || d.Events[0].Reason != "oldest heavy job waited 2m0s >= 2m0s" {
+		t.Fatalf("after 2m: active %v, events %+v", d.AvalancheActive, d.Events)
+	}
+
+	clock = clock.Add(time.Hour)
+	d.CheckAvalancheStatus()
+	if !d.AvalancheActive {
+		t.Fatal("left the mode while the heavy job still waits")
+	}
+	d.Buckets.CancelJob("H")
+	d.CheckAvalancheStatus()
+	if d.AvalancheActive || len(d.Events) != 2 {
+		t.Fatalf("heavy job gone: active %v, events %+v", d.AvalancheActive, d.Events)
+	}
+}
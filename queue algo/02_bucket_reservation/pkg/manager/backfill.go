@@ -0,0 +1,99 @@
+package manager
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// Shadow is where and when a waiting heavy job is expected to start: its EASY "shadow time".
+type Shadow struct {
+	Job    *model.Job
+	Worker *model.Worker
+	Start  time.Time
+}
+
+// Shadows plans every queued heavy job onto the large workers, oldest job first, using
+// job estimates: each job gets the fitting worker that is expected to be free soonest
+// (best fit on ties), and that worker is then busy for the job's estimate.
+// Jobs larger than every worker get no shadow.
+func (d *Dispatcher) Shadows() []Shadow {
+	return d.shadows(d.Buckets.HeavyJobs(d.Config.JobLargeThreshold), d.now())
+}
+
+// shadows plans heavy, a list of the queued heavy jobs (it is not changed).
+func (d *Dispatcher) shadows(heavy []*model.Job, now time.Time) []Shadow {
+	heavy = slices.Clone(heavy)
+	sort.SliceStable(heavy, func(a, b int) bool { return heavy[a].ArrivalTime.Before(heavy[b].ArrivalTime) })
+
+	freeAt := make(map[*model.Worker]time.Time)
+	for _, w := range d.Workers {
+		if d.capacity(w) >= d.Config.JobLargeThreshold {
+			freeAt[w] = w.EstimatedFree(now)
+		}
+	}
+
+	var out []Shadow
+	for _, j := range heavy {
+		var best *model.Worker
+		for _, w := range d.Workers {
+			at, ok := freeAt[w]
+			if !ok || !w.Fits(j) {
+				continue
+			}
+			if best == nil || at.Before(freeAt[best]) || (at.Equal(freeAt[best]) && d.capacity(w) < d.capacity(best)) {
+				best = w
+			}
+		}
+		if best == nil {
+			continue
+		}
+		out = append(out, Shadow{Job: j, Worker: best, Start: freeAt[best]})
+		freeAt[best] = freeAt[best].Add(j.EstimatedDuration())
+	}
+	return out
+}
+
+// backfill gives waiting reserved workers small jobs that are estimated to finish no later
+// than the earliest shadow start of the heavy jobs still queued, so the reservation is never
+// pushed back by them. With no heavy job waiting there is nothing to protect and any job may
+// be taken.
+func (d *Dispatcher) backfill(waiting []*model.Worker, heavy []*model.Job, now time.Time) []Assignment {
+	var deadline time.Time // zero = no limit
+	for _, s := range d.shadows(heavy, now) {
+		if deadline.IsZero() || s.Start.Before(deadline) {
+			deadline = s.Start
+		}
+	}
+	shortEnough := func(j *model.Job) bool {
+		return deadline.IsZero() || !now.Add(j.EstimatedDuration()).After(deadline)
+	}
+
+	var assigned []Assignment
+	for _, w := range waiting {
+		if job := d.searchTraced(w, 0, shortEnough, "backfill", true, now); job != nil {
+			assigned = append(assigned, d.assign(w, job, now, "BACKFILL"))
+		}
+	}
+	return assigned
+}
+
+// stillQueued drops from heavy the jobs this round has already assigned.
+func stillQueued(heavy []*model.Job, assigned []Assignment) []*model.Job {
+	if len(assigned) == 0 {
+		return heavy
+	}
+	taken := make(map[*model.Job]bool, len(assigned))
+	for _, a := range assigned {
+		taken[a.Job] = true
+	}
+	left := make([]*model.Job, 0, len(heavy))
+	for _, j := range heavy {
+		if !taken[j] {
+			left = append(left, j)
+		}
+	}
+	return left
+}
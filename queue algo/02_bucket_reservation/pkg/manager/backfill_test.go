@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// backfillRun plays one trace with Backfill on or off, a round every 10s. Big (2000MB) is busy
+// with Prep for 60s when Heavy (1900MB, only Big fits it) arrives; the two idle Mid workers are
+// held for it (reserve-all) and may backfill the small jobs. It returns when Heavy started and,
+// for every backfilled job, its start, estimated end and the earliest shadow start that round.
+func backfillRun(t *testing.T, backfill bool) (heavyStart time.Time, filled []backfilled) {
+	t.Helper()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := start
+	d := reservationDispatcher(ReserveAll, &clock)
+	d.Config.Backfill = backfill
+	d.Tracing = true
+	d.AddWorker(&model.Worker{ID: "Big", CapacityMB: 2000})
+	d.AddJob(&model.Job{ID: "Prep", SizeMB: 500, Duration: time.Minute})
+	d.Match()
+	d.AddWorker(&model.Worker{ID: "Mid_0", CapacityMB: 1000})
+	d.AddWorker(&model.Worker{ID: "Mid_1", CapacityMB: 1000})
+	d.AddJob(&model.Job{ID: "Heavy", SizeMB: 1900, Duration: time.Minute})
+	for _, secs := range []int{90, 20, 50, 30} { // S90 heads the queue but cannot end in time
+		// Runs take as long as estimated, so the shadow plan holds.
+		d.AddJob(&model.Job{ID: fmt.Sprintf("S%d", secs), SizeMB: 100, Duration: time.Duration(secs) * time.Second})
+	}
+
+	for clock.Before(start.Add(5 * time.Minute)) {
+		var shadow time.Time
+		for _, s := range d.Shadows() {
+			if shadow.IsZero() || s.Start.Before(shadow) {
+				shadow = s.Start
+			}
+		}
+		jobs := make(map[string]*model.Job)
+		for _, a := range d.Match() {
+			jobs[a.Job.ID] = a.Job
+			if a.Job.ID == "Heavy" {
+				heavyStart = clock
+				shadow = time.Time{} // started before the backfill step: nothing left to protect
+			}
+		}
+		for _, dec := range d.Trace {
+			if dec.Phase == "backfill" && dec.JobID != "" {
+				j := jobs[dec.JobID]
+				filled = append(filled, backfilled{job: j.ID, start: clock, end: clock.Add(j.EstimatedDuration()), shadow: shadow})
+			}
+		}
+		clock = clock.Add(10 * time.Second)
+		d.CompleteFinishedJobs()
+	}
+	if heavyStart.IsZero() {
+		t.Fatalf("backfill %v: Heavy never started", backfill)
+	}
+	return heavyStart, filled
+}
+
+type backfilled struct {
+	job        string
+	start, end time.Time
+	shadow     time.Time // zero = no heavy job was waiting
+}
+
+func TestBackfillEndsBeforeShadowStart(t *testing.T) {
+	_, filled := backfillRun(t, true)
+	if len(filled) == 0 {
+		t.Fatal("nothing was backfilled")
+	}
+	for _, f := range filled {
+		if !f.shadow.IsZero() && f.end.After(f.shadow) {
+			t.Errorf("%s backfilled at %s, expected to end %s, after the shadow start %s",
+				f.job, f.start.Format(time.TimeOnly), f.end.Format(time.TimeOnly), f.shadow.Format(time.TimeOnly))
+		}
+	}
+	if f := filled[0]; f.shadow.IsZero() {
+		t.Errorf("first backfill %s had no shadow to respect; the trace does not exercise the limit", f.job)
+	}
+}
+
+func TestBackfillDoesNotDelayReservedJob(t *testing.T) {
+	without, _ := backfillRun(t, false)
+	with, filled := backfillRun(t, true)
+	if !with.Equal(without) {
+		t.Fatalf("Heavy started at %s with backfill, %s without", with.Format(time.TimeOnly), without.Format(time.TimeOnly))
+	}
+	// S20 and S50 at once, S30 when S20 is done: all end by 60s, when Big frees up for Heavy.
+	if len(filled) < 3 || filled[2].job != "S30" {
+		t.Fatalf("backfilled %+v, want S20, S50 and then S30 before Heavy starts", filled)
+	}
+}
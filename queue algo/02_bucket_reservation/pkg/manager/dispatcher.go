@@ -1,92 +1,255 @@
 package manager
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
 )
 
-// Constants for Reservation Logic
-const (
-	AvalancheThreshold = 3   // If > 3 jobs are waiting in Large buckets, trigger avalanche
-	JobLargeThreshold  = 800 // Jobs > 800MB are considered "Large" (Heavy)
+var (
+	ErrUnknownWorker   = errors.New("unknown worker")
+	ErrNotRunning      = errors.New("worker is not running this job")
+	ErrDuplicateWorker = errors.New("a worker with this ID is already registered")
 )
 
 type Dispatcher struct {
 	Buckets         *model.BucketManager
 	Workers         []*model.Worker
 	AvalancheActive bool
+	Config          Config
+
+	// Events is every avalanche enter/exit since the last DrainEvents, oldest first.
+	Events []AvalancheEvent
+	// lastTransition is when AvalancheActive last changed (zero = never).
+	lastTransition time.Time
+
+	// Silent turns off the per-event console logging (useful for large simulations).
+	Silent bool
+
+	// Clock is used for busy/idle bookkeeping. nil means time.Now.
+	// Simulations inject a fake clock to run jobs for their Duration without sleeping.
+	Clock func() time.Time
+
+	// Tracing makes Match record a Decision for every bucket search into Trace,
+	// which holds the last round only. If TraceWriter is set too, every Decision
+	// is also written to it as one JSON line.
+	Tracing     bool
+	Trace       []Decision
+	TraceWriter io.Writer
+	round       int
+	traceEnc    *json.Encoder // encodes to traceTo, which is TraceWriter unless it was changed
+	traceTo     io.Writer
+
+	workerByID map[string]*model.Worker
+	total      resources              // every worker's resources added up, for DRF
+	usage      map[string]*ownerUsage // per owner with running jobs, for DRF
+}
+
+// Assignment is one Job handed to one Worker by Match.
+type Assignment struct {
+	Job    *model.Job
+	Worker *model.Worker
 }
 
 func NewDispatcher(maxMem int) *Dispatcher {
+	return NewDispatcherWithBuckets(model.NewBucketManager(maxMem))
+}
+
+// NewDispatcherWithBuckets uses a BucketManager built with a custom layout and overflow policy.
+func NewDispatcherWithBuckets(bm *model.BucketManager) *Dispatcher {
+	return NewDispatcherWithConfig(bm, DefaultConfig())
+}
+
+// NewDispatcherWithConfig buckets jobs on cfg.Scale (it sets bm.SizeOf), so bm should be empty.
+func NewDispatcherWithConfig(bm *model.BucketManager, cfg Config) *Dispatcher {
+	bm.SizeOf = cfg.Scale.JobSize
 	return &Dispatcher{
-		Buckets: model.NewBucketManager(maxMem),
-		Workers: make([]*model.Worker, 0),
+		Buckets:    bm,
+		Workers:    make([]*model.Worker, 0),
+		Config:     cfg,
+		workerByID: make(map[string]*model.Worker),
+		usage:      make(map[string]*ownerUsage),
 	}
 }
 
-func (d *Dispatcher) AddJob(j *model.Job) {
-	d.Buckets.AddJob(j)
+func (d *Dispatcher) logf(format string, args ...interface{}) {
+	if !d.Silent {
+		fmt.Printf(format, args...)
+	}
 }
 
-func (d *Dispatcher) AddWorker(w *model.Worker) {
+func (d *Dispatcher) now() time.Time {
+	if d.Clock == nil {
+		return time.Now()
+	}
+	return d.Clock()
+}
+
+// AddJob queues j. It fails only when j is too large and the bucket layout rejects overflow.
+func (d *Dispatcher) AddJob(j *model.Job) error {
+	if j.ArrivalTime.IsZero() {
+		j.ArrivalTime = d.now()
+	}
+	return d.Buckets.AddJob(j)
+}
+
+// AddWorker registers w. Worker IDs must be unique: CompleteJob and friends look workers up by ID.
+func (d *Dispatcher) AddWorker(w *model.Worker) error {
+	if _, ok := d.workerByID[w.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateWorker, w.ID)
+	}
+	if w.JoinedAt.IsZero() {
+		w.JoinedAt = d.now()
+	}
 	d.Workers = append(d.Workers, w)
+	d.workerByID[w.ID] = w
+	d.total[0] += w.CapacityMB
+	d.total[1] += w.CPUCores
+	d.total[2] += w.DiskMB
+	d.total[3] += w.Accelerators
+	if w.Busy && w.CurrentJob != nil {
+		d.charge(w.CurrentJob, 1) // already running something
+	}
+	return nil
+}
+
+// CompleteJob is called when a worker finishes its job: the worker goes back to idle
+// and takes part in the next Match again.
+func (d *Dispatcher) CompleteJob(workerID, jobID string) error {
+	w, ok := d.workerByID[workerID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownWorker, workerID)
+	}
+	if !w.Busy || w.CurrentJob.ID != jobID {
+		return fmt.Errorf("%w: %s on %s", ErrNotRunning, jobID, workerID)
+	}
+	d.complete(w, d.now())
+	return nil
 }
 
-// CheckAvalancheStatus determines if we are in a heavy-load state
-func (d *Dispatcher) CheckAvalancheStatus() {
-	heavyCount := d.Buckets.TotalHeavyJobs(JobLargeThreshold)
-	if heavyCount >= AvalancheThreshold {
-		if !d.AvalancheActive {
-			fmt.Println("!!! AVALANCHE DETECTED !!! Triggering Reservation Mode.")
-			d.AvalancheActive = true
+// complete frees w, counting it as busy until at.
+func (d *Dispatcher) complete(w *model.Worker, at time.Time) {
+	j := w.Release(at)
+	d.charge(j, -1)
+	d.logf("[DONE] Worker %s finished %s\n", w.ID, j)
+}
+
+// CompleteFinishedJobs completes every job whose Duration has elapsed on the clock.
+// Each worker is counted busy until its job's end, not until this call.
+// It returns the finished assignments.
+func (d *Dispatcher) CompleteFinishedJobs() []Assignment {
+	now := d.now()
+	var done []Assignment
+	for _, w := range d.Workers {
+		if w.Busy && !w.FinishesAt().After(now) {
+			done = append(done, Assignment{Job: w.CurrentJob, Worker: w})
+			d.complete(w, w.FinishesAt())
 		}
-	} else {
-		if d.AvalancheActive {
-			fmt.Println("... Avalanche cleared. Resuming normal operation.")
-			d.AvalancheActive = false
+	}
+	return done
+}
+
+// IdleWorkers returns the workers that are not running a job.
+func (d *Dispatcher) IdleWorkers() []*model.Worker {
+	idle := make([]*model.Worker, 0, len(d.Workers))
+	for _, w := range d.Workers {
+		if !w.Busy {
+			idle = append(idle, w)
 		}
 	}
+	return idle
 }
 
-// Match performs a single round of matching
-func (d *Dispatcher) Match() {
-	// 1. Update State
-	d.CheckAvalancheStatus()
+// size and capacity are a job's and a worker's dominant resource in memory-equivalent MB.
+func (d *Dispatcher) size(j *model.Job) int        { return d.Config.Scale.JobSize(j) }
+func (d *Dispatcher) capacity(w *model.Worker) int { return d.Config.Scale.WorkerSize(w) }
 
-	// 2. Iterate over Workers
-	// Ideally we iterate available workers. For sim, we assume all in slice are "Available".
+// pick removes and returns the job w should run next from buckets minBucketIndex and up,
+// restricted to jobs accepted by ok (nil accepts all). Only jobs w Fits on every resource qualify.
+// It is the heaviest such job, or under Config.DRF the heaviest one of the neediest owner.
+func (d *Dispatcher) pick(w *model.Worker, minBucketIndex int, ok func(*model.Job) bool) *model.Job {
+	fits := func(j *model.Job) bool { return w.Fits(j) && (ok == nil || ok(j)) }
+	if d.Config.DRF {
+		return d.pickFair(w, minBucketIndex, fits)
+	}
+	return d.Buckets.GetHeaviestJobWhere(d.capacity(w), minBucketIndex, fits)
+}
+
+// Utilization is the busy fraction of all worker time so far (capacity-agnostic).
+func (d *Dispatcher) Utilization() float64 {
+	now := d.now()
+	var busy, alive time.Duration
 	for _, w := range d.Workers {
-		// Determine the Minimum Bucket Index we are allowed to pick from.
-		// Default: 0 (Any job)
-		minBucketIdx := 0
-
-		// RESERVATION LOGIC:
-		// If Avalanche is Active AND Worker is capable of handling Heavy Jobs,
-		// Then enforce Reservation: Worker can ONLY pick jobs >= JobLargeThreshold.
-		if d.AvalancheActive && w.CapacityMB >= JobLargeThreshold {
-			// Calculate bucket index for the Large Threshold
-			minBucketIdx = d.Buckets.GetBucketIndex(JobLargeThreshold)
-			// fmt.Printf(" [Reserved] Worker %s reserved for jobs > %d MB\n", w.ID, JobLargeThreshold)
-		}
+		busy += w.BusyTime(now)
+		alive += now.Sub(w.JoinedAt)
+	}
+	if alive <= 0 {
+		return 0
+	}
+	return float64(busy) / float64(alive)
+}
+
+// Match performs a single round of matching over the idle workers.
+// Every worker that gets a job is marked busy until CompleteJob.
+func (d *Dispatcher) Match() []Assignment {
+	// 1. Update State. The queued heavy jobs are listed at most once per round: the avalanche
+	// check lists them unless MinDwell lets it skip, and reservation needs them only when active.
+	now := d.now()
+	heavy, listed := d.checkAvalanche(now)
+	if !listed && d.AvalancheActive {
+		heavy = d.Buckets.HeavyJobs(d.Config.JobLargeThreshold)
+	}
+	d.round++
+	d.Trace = nil
 
-		// Try to find a job
-		job := d.Buckets.GetHeaviestJobForCapacity(w.CapacityMB, minBucketIdx)
+	// 2. Decide which idle large workers are held back for heavy jobs this round.
+	reserved, heldFor := d.reservedWorkers(heavy)
 
-		if job != nil {
-			fmt.Printf("[MATCH] Worker %s (Cap %d) -> Assigned %s\n", w.ID, w.CapacityMB, job)
-			// In a real system, we'd mark worker as busy here.
-			// d.RemoveWorker(w) or similar.
+	// 3. Iterate over idle Workers, reserved ones first so they get the heavy jobs they are
+	// held for. Busy workers keep running their current job.
+	var assigned []Assignment
+	var waiting []*model.Worker
+	held, free := d.matchOrder(reserved)
+
+	// RESERVATION LOGIC:
+	// If Avalanche is Active AND this Worker is reserved for Heavy Jobs,
+	// Then enforce Reservation: Worker can ONLY pick jobs >= Config.JobLargeThreshold.
+	heavyIdx := d.Buckets.GetBucketIndex(d.Config.JobLargeThreshold)
+	for _, w := range held {
+		if job := d.searchTraced(w, heavyIdx, notHeldForOthers(w, heldFor), "reserved", true, now); job != nil {
+			assigned = append(assigned, d.assign(w, job, now, "MATCH"))
 		} else {
-			// If job is nil, it means:
-			// 1. No jobs fit capacity.
-			// 2. OR Reservation blocked taking small jobs.
-			if d.AvalancheActive && w.CapacityMB >= JobLargeThreshold {
-				// Verify if it was truly reservation blocking
-				// Check if there ARE small jobs?
-				// For now, just log that it's waiting
-				// fmt.Printf(" [Wait] Worker %s is reserved and waiting for Heavy Job...\n", w.ID)
-			}
+			// Reservation blocked taking small jobs: no queued heavy job fits this worker right now.
+			waiting = append(waiting, w)
+		}
+	}
+
+	// 4. Backfilling: let the waiting reserved workers run small jobs that will be done
+	// (by estimate) before any heavy job could start.
+	if d.Config.Backfill && len(waiting) > 0 {
+		assigned = append(assigned, d.backfill(waiting, stillQueued(heavy, assigned), now)...)
+	}
+
+	// 5. Everyone else takes the heaviest job that fits (or the fairest one, see Config.DRF).
+	for _, w := range free {
+		if job := d.searchTraced(w, 0, nil, "free", false, now); job != nil {
+			assigned = append(assigned, d.assign(w, job, now, "MATCH"))
 		}
 	}
+
+	// 6. Account for workers left idle by their reservation.
+	d.trackReservedIdle(reserved, now)
+	return assigned
+}
+
+// assign marks w busy with job and logs it under tag.
+func (d *Dispatcher) assign(w *model.Worker, job *model.Job, now time.Time, tag string) Assignment {
+	d.logf("[%s] Worker %s (Cap %d) -> Assigned %s\n", tag, w.ID, w.CapacityMB, job)
+	w.Assign(job, now)
+	d.charge(job, 1)
+	return Assignment{Job: job, Worker: w}
 }
@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+func TestDuplicateWorkerRejected(t *testing.T) {
+	d := NewDispatcher(2000)
+	first := &model.Worker{ID: "W", CapacityMB: 1000}
+	if err := d.AddWorker(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddWorker(&model.Worker{ID: "W", CapacityMB: 2000}); !errors.Is(err, ErrDuplicateWorker) {
+		t.Fatalf("second AddWorker: %v, want ErrDuplicateWorker", err)
+	}
+	if len(d.Workers) != 1 || d.workerByID["W"] != first {
+		t.Fatalf("workers %v, want only the first W", d.Workers)
+	}
+}
+
+// Opt-in features must stay off in DefaultConfig, so existing callers keep their matching.
+func TestDefaultConfigOptInsOff(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.Backfill {
+		t.Error("Backfill is on by default")
+	}
+	if cfg.DRF {
+		t.Error("DRF is on by default")
+	}
+	if cfg.Scale != (model.Scale{}) {
+		t.Errorf("Scale %+v by default, want the zero Scale (memory only)", cfg.Scale)
+	}
+}
+
+// clockDispatcher is a silent 2000MB Dispatcher with DefaultConfig on the fake clock.
+func clockDispatcher(clock *time.Time) *Dispatcher {
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	d := NewDispatcherWithConfig(bm, DefaultConfig())
+	d.Silent = true
+	d.Clock = func() time.Time { return *clock }
+	return d
+}
+
+// CompleteJob takes a worker from busy back to idle, books the busy time, and the worker
+// takes part in the next Match.
+func TestCompleteJobFreesWorker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+	d := clockDispatcher(&now)
+	w := &model.Worker{ID: "W", CapacityMB: 1000}
+	d.AddWorker(w)
+	d.AddJob(&model.Job{ID: "J1", SizeMB: 500, Duration: time.Minute})
+	d.AddJob(&model.Job{ID: "J2", SizeMB: 400, Duration: time.Minute})
+
+	if a := d.Match(); len(a) != 1 || a[0].Job.ID != "J1" {
+		t.Fatalf("Match = %v, want J1 on W", a)
+	}
+	if !w.Busy || len(d.IdleWorkers()) != 0 {
+		t.Fatalf("after Match: busy %v, idle %v; want W busy", w.Busy, d.IdleWorkers())
+	}
+	if a := d.Match(); len(a) != 0 {
+		t.Fatalf("Match on a busy worker = %v, want nothing", a)
+	}
+
+	now = start.Add(20 * time.Second)
+	if err := d.CompleteJob("W", "J1"); err != nil {
+		t.Fatal(err)
+	}
+	if w.Busy || w.CurrentJob != nil || w.Completed != 1 || w.BusyTotal != 20*time.Second {
+		t.Fatalf("after CompleteJob: busy %v, job %v, completed %d, busy total %v; want idle, nil, 1, 20s",
+			w.Busy, w.CurrentJob, w.Completed, w.BusyTotal)
+	}
+	if idle := d.IdleWorkers(); len(idle) != 1 || idle[0] != w {
+		t.Fatalf("IdleWorkers = %v, want [W]", idle)
+	}
+	if a := d.Match(); len(a) != 1 || a[0].Job.ID != "J2" {
+		t.Fatalf("Match = %v, want J2 on W", a)
+	}
+}
+
+func TestCompleteJobErrors(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := clockDispatcher(&now)
+	d.AddWorker(&model.Worker{ID: "W", CapacityMB: 1000})
+
+	if err := d.CompleteJob("W", "J1"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("completing on an idle worker: %v, want ErrNotRunning", err)
+	}
+	d.AddJob(&model.Job{ID: "J1", SizeMB: 500, Duration: time.Minute})
+	d.Match()
+	if err := d.CompleteJob("X", "J1"); !errors.Is(err, ErrUnknownWorker) {
+		t.Errorf("unknown worker: %v, want ErrUnknownWorker", err)
+	}
+	if err := d.CompleteJob("W", "J2"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("a job W is not running: %v, want ErrNotRunning", err)
+	}
+	if err := d.CompleteJob("W", "J1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CompleteJob("W", "J1"); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("completing J1 twice: %v, want ErrNotRunning", err)
+	}
+}
+
+// CompleteFinishedJobs ends only the jobs whose Duration is up, and counts each worker busy
+// until its job's end rather than until the call.
+func TestCompleteFinishedJobs(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+	d := clockDispatcher(&now)
+	d.AddWorker(&model.Worker{ID: "W1", CapacityMB: 1000})
+	d.AddWorker(&model.Worker{ID: "W2", CapacityMB: 1000})
+	d.AddJob(&model.Job{ID: "J10", SizeMB: 500, Duration: 10 * time.Second})
+	d.AddJob(&model.Job{ID: "J30", SizeMB: 500, Duration: 30 * time.Second})
+	var short, long *model.Worker
+	for _, a := range d.Match() {
+		if a.Job.ID == "J10" {
+			short = a.Worker
+		} else {
+			long = a.Worker
+		}
+	}
+	if short == nil || long == nil {
+		t.Fatal("Match did not start both jobs")
+	}
+
+	now = start.Add(5 * time.Second)
+	if done := d.CompleteFinishedJobs(); len(done) != 0 {
+		t.Fatalf("at +5s: finished %v, want none", done)
+	}
+	now = start.Add(20 * time.Second)
+	done := d.CompleteFinishedJobs()
+	if len(done) != 1 || done[0].Job.ID != "J10" || done[0].Worker != short {
+		t.Fatalf("at +20s: finished %v, want J10 on %s", done, short.ID)
+	}
+	if short.Busy || short.BusyTotal != 10*time.Second {
+		t.Fatalf("J10's worker: busy %v, busy total %v; want idle after 10s", short.Busy, short.BusyTotal)
+	}
+	if !long.Busy {
+		t.Fatal("J30 finished early")
+	}
+	now = start.Add(30 * time.Second)
+	if done := d.CompleteFinishedJobs(); len(done) != 1 || done[0].Job.ID != "J30" {
+		t.Fatalf("at +30s: finished %v, want J30", done)
+	}
+	if done := d.CompleteFinishedJobs(); len(done) != 0 {
+		t.Fatalf("second call finished %v again", done)
+	}
+}
+
+// Utilization is all busy time, finished and running, over all time since each worker joined.
+func TestUtilization(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := now
+	d := clockDispatcher(&now)
+	if u := d.Utilization(); u != 0 {
+		t.Fatalf("no workers: utilization %v, want 0", u)
+	}
+	a := &model.Worker{ID: "A", CapacityMB: 1000}
+	d.AddWorker(a)
+	d.AddJob(&model.Job{ID: "J1", SizeMB: 500, Duration: 10 * time.Second})
+	d.Match()
+
+	now = start.Add(10 * time.Second)
+	d.CompleteFinishedJobs()
+	b := &model.Worker{ID: "B", CapacityMB: 1000}
+	d.AddWorker(b) // joins at +10s
+
+	// A: busy 10s of 20s. B: idle for its 10s.
+	now = start.Add(20 * time.Second)
+	if u, want := d.Utilization(), 10.0/30; u != want {
+		t.Fatalf("at +20s: utilization %v, want %v", u, want)
+	}
+
+	// J2 runs from +20s on one of them: 10s more busy time, and 20s more alive time.
+	d.AddJob(&model.Job{ID: "J2", SizeMB: 500, Duration: time.Minute})
+	d.Match()
+	now = start.Add(30 * time.Second)
+	if u, want := d.Utilization(), 20.0/50; u != want {
+		t.Fatalf("at +30s: utilization %v, want %v", u, want)
+	}
+}
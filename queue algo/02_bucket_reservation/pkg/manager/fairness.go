@@ -0,0 +1,79 @@
+package manager
+
+import (
+	"sort"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// resources is memory, CPU cores, disk and accelerators, in that order.
+type resources [4]int
+
+// ownerUsage is what one owner's running jobs hold.
+type ownerUsage struct {
+	running int
+	used    resources
+}
+
+// charge adds (sign 1) or takes back (sign -1) j's resources to its owner's usage.
+// Assigning and finishing jobs keep the usage current, so DominantShares never rescans workers.
+func (d *Dispatcher) charge(j *model.Job, sign int) {
+	u := d.usage[j.Owner]
+	if u == nil {
+		u = &ownerUsage{}
+		d.usage[j.Owner] = u
+	}
+	u.running += sign
+	u.used[0] += sign * j.SizeMB
+	u.used[1] += sign * j.CPUCores
+	u.used[2] += sign * j.DiskMB
+	u.used[3] += sign * j.Accelerators
+	if u.running == 0 {
+		delete(d.usage, j.Owner)
+	}
+}
+
+// DominantShares returns every owner's dominant share: for each resource, the fraction of the
+// cluster's total that the owner's running jobs hold, and then the largest of those fractions.
+// An owner running 8 of 32 cores and 1GB of 32GB has a dominant share of 0.25 (CPU).
+// Owners with nothing running are not in the map (their share is 0).
+func (d *Dispatcher) DominantShares() map[string]float64 {
+	shares := make(map[string]float64, len(d.usage))
+	for owner, u := range d.usage {
+		shares[owner] = d.dominantShare(u)
+	}
+	return shares
+}
+
+func (d *Dispatcher) dominantShare(u *ownerUsage) float64 {
+	share := 0.0
+	for r, total := range d.total {
+		if total > 0 {
+			share = max(share, float64(u.used[r])/float64(total))
+		}
+	}
+	return share
+}
+
+// pickFair tries the owners of the queued jobs in ascending dominant share (ties by name)
+// and gives w the heaviest job it fits of the first owner that has one.
+// Shares are kept current as jobs start and finish, so they include the jobs assigned earlier
+// this round. Each owner is searched in its own buckets (BucketManager.GetHeaviestJobOf), so a
+// pick costs O(owners log owners) plus the owners' bucket searches, not a scan of every job.
+func (d *Dispatcher) pickFair(w *model.Worker, minBucketIndex int, fits func(*model.Job) bool) *model.Job {
+	owners := d.Buckets.Owners()
+	share := func(owner string) float64 {
+		if u := d.usage[owner]; u != nil {
+			return d.dominantShare(u)
+		}
+		return 0
+	}
+	sort.SliceStable(owners, func(a, b int) bool { return share(owners[a]) < share(owners[b]) })
+
+	for _, owner := range owners {
+		if j := d.Buckets.GetHeaviestJobOf(owner, d.capacity(w), minBucketIndex, fits); j != nil {
+			return j
+		}
+	}
+	return nil
+}
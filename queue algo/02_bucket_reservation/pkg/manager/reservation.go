@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// ReservationMode decides which large workers are held for heavy jobs during an avalanche.
+type ReservationMode int
+
+const (
+	// ReservePartial holds only as many large workers as the queued heavy jobs need,
+	// picking for each heavy job (largest first) the smallest idle worker it fits in.
+	// Every other worker keeps taking any job, and a held worker leaves the heavy jobs held
+	// for other workers alone, so each held worker gets the job it was held for (or a heavier
+	// one) and is never left idle.
+	ReservePartial ReservationMode = iota
+	// ReserveAll is the original behaviour: every idle worker of capacity >= JobLargeThreshold
+	// refuses small jobs, however few heavy jobs there are.
+	ReserveAll
+)
+
+func (m ReservationMode) String() string {
+	if m == ReserveAll {
+		return "reserve-all"
+	}
+	return "reserve-partial"
+}
+
+// reservedWorkers returns the IDs of the idle workers held for heavy jobs this round and,
+// under ReservePartial, which worker each heavy job (from the queued heavy list) is held for
+// (by job ID).
+func (d *Dispatcher) reservedWorkers(heavy []*model.Job) (reserved map[string]bool, heldFor map[string]string) {
+	reserved = make(map[string]bool)
+	if !d.AvalancheActive {
+		return reserved, nil
+	}
+
+	var large []*model.Worker
+	for _, w := range d.Workers {
+		if !w.Busy && d.capacity(w) >= d.Config.JobLargeThreshold {
+			large = append(large, w)
+		}
+	}
+	if d.Config.Reservation == ReserveAll {
+		for _, w := range large {
+			reserved[w.ID] = true
+		}
+		return reserved, nil
+	}
+
+	// Best fit, largest job first: a 1900MB job takes the 2000MB worker before a 900MB job
+	// can, and a 900MB job takes a 1000MB worker rather than a 2000MB one.
+	heavy = slices.Clone(heavy) // the caller's list stays in queue order
+	sort.SliceStable(heavy, func(a, b int) bool { return d.size(heavy[a]) > d.size(heavy[b]) })
+	sort.SliceStable(large, func(a, b int) bool { return d.capacity(large[a]) < d.capacity(large[b]) })
+	heldFor = make(map[string]string)
+	for _, j := range heavy {
+		for _, w := range large {
+			if !reserved[w.ID] && w.Fits(j) {
+				reserved[w.ID] = true
+				heldFor[j.ID] = w.ID
+				break
+			}
+		}
+		if len(reserved) == len(large) {
+			break
+		}
+	}
+	return reserved, heldFor
+}
+
+// notHeldForOthers is the job filter for held worker w: it rejects the heavy jobs held for
+// another worker. Without it a held worker could take a heavier job it also fits: the worker that
+// job was held for would sit idle, and the job held for w (which it may be the only one to fit)
+// would wait. nil when nothing is paired.
+func notHeldForOthers(w *model.Worker, heldFor map[string]string) func(*model.Job) bool {
+	if len(heldFor) == 0 {
+		return nil
+	}
+	return func(j *model.Job) bool {
+		owner, ok := heldFor[j.ID]
+		return !ok || owner == w.ID
+	}
+}
+
+// matchOrder splits the idle workers into reserved and free ones (each keeps insertion order).
+func (d *Dispatcher) matchOrder(reserved map[string]bool) (held, free []*model.Worker) {
+	for _, w := range d.Workers {
+		switch {
+		case w.Busy:
+		case reserved[w.ID]:
+			held = append(held, w)
+		default:
+			free = append(free, w)
+		}
+	}
+	return held, free
+}
+
+// trackReservedIdle opens a reserved-idle stretch for every reserved worker that is still idle
+// after the round, and closes it for every worker that got a job or is no longer reserved.
+func (d *Dispatcher) trackReservedIdle(reserved map[string]bool, now time.Time) {
+	for _, w := range d.Workers {
+		held := reserved[w.ID] && !w.Busy
+		switch {
+		case held && w.ReservedSince.IsZero():
+			w.ReservedSince = now
+		case !held && !w.ReservedSince.IsZero():
+			w.ReservedIdle += now.Sub(w.ReservedSince)
+			w.ReservedSince = time.Time{}
+		}
+	}
+}
+
+// ReservedIdle is how long one worker has sat idle because it was reserved.
+type ReservedIdle struct {
+	WorkerID   string
+	CapacityMB int
+	Idle       time.Duration
+}
+
+// ReservationReport returns the reserved-idle time of every worker that has any, largest first.
+// This is the capacity reservation mode has cost so far.
+func (d *Dispatcher) ReservationReport() []ReservedIdle {
+	now := d.now()
+	var report []ReservedIdle
+	for _, w := range d.Workers {
+		if idle := w.ReservedIdleTime(now); idle > 0 {
+			report = append(report, ReservedIdle{WorkerID: w.ID, CapacityMB: w.CapacityMB, Idle: idle})
+		}
+	}
+	sort.SliceStable(report, func(a, b int) bool { return report[a].Idle > report[b].Idle })
+	return report
+}
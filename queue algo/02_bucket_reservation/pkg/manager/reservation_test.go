@@ -0,0 +1,87 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// reservationDispatcher reserves as soon as one heavy (>= 800MB) job is queued, with a
+// settable clock and Backfill off.
+func reservationDispatcher(mode ReservationMode, clock *time.Time) *Dispatcher {
+	cfg := DefaultConfig()
+	cfg.EnterBacklog, cfg.ExitBacklog = 1, 0
+	cfg.Reservation = mode
+	bm := model.NewBucketManager(2000)
+	bm.Silent = true
+	d := NewDispatcherWithConfig(bm, cfg)
+	d.Silent = true
+	d.Clock = func() time.Time { return *clock }
+	return d
+}
+
+// A 1900MB job only the busy 2000MB worker fits: reserve-all holds the two idle 1000MB workers
+// for it, and they stay held until reservation mode ends 40s later (Heavy starts at +30s, and
+// the mode is left at the next round, +40s). The report charges each of them those 40s.
+func TestReservationReportCountsHeldIdleTime(t *testing.T) {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := reservationDispatcher(ReserveAll, &clock)
+	d.AddWorker(&model.Worker{ID: "Big", CapacityMB: 2000})
+	d.AddJob(&model.Job{ID: "Prep", SizeMB: 500, Duration: 30 * time.Second})
+	d.Match()
+	d.AddWorker(&model.Worker{ID: "Mid_0", CapacityMB: 1000})
+	d.AddWorker(&model.Worker{ID: "Mid_1", CapacityMB: 1000})
+	d.AddJob(&model.Job{ID: "Heavy", SizeMB: 1900, Duration: time.Minute})
+	d.AddJob(&model.Job{ID: "Small", SizeMB: 100, Duration: time.Second})
+
+	for i := 0; i < 3; i++ {
+		d.Match()
+		clock = clock.Add(10 * time.Second)
+		d.CompleteFinishedJobs()
+	}
+	if got := d.ReservationReport(); len(got) != 2 {
+		t.Fatalf("report while Heavy waits: %+v, want both Mid workers", got)
+	}
+
+	d.Match() // +30s: Big is free and takes Heavy
+	clock = clock.Add(10 * time.Second)
+	if a := d.Match(); len(a) != 1 || a[0].Job.ID != "Small" { // no heavy backlog: the Mids are released
+		t.Fatalf("round at +40s assigned %v, want Small", a)
+	}
+	clock = clock.Add(time.Hour)
+	want := []ReservedIdle{
+		{WorkerID: "Mid_0", CapacityMB: 1000, Idle: 40 * time.Second},
+		{WorkerID: "Mid_1", CapacityMB: 1000, Idle: 40 * time.Second},
+	}
+	if got := d.ReservationReport(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("report = %+v, want %+v", got, want)
+	}
+}
+
+// Partial reservation pairs each heavy job with a worker. Here Wide (1800MB, 4 cores) is held
+// for the 1500MB job and Deep (2000MB, 16 cores) for the 8-core one, which only Deep fits.
+// Deep matches first and must leave Wide's job alone: if it took the heavier job, Wide would sit
+// idle and the 8-core job would wait with a worker for it free.
+func TestPartialReservationKeepsPairs(t *testing.T) {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := reservationDispatcher(ReservePartial, &clock)
+	d.AddWorker(&model.Worker{ID: "Deep", CapacityMB: 2000, CPUCores: 16})
+	d.AddWorker(&model.Worker{ID: "Wide", CapacityMB: 1800, CPUCores: 4})
+	d.AddJob(&model.Job{ID: "Big", SizeMB: 1500, CPUCores: 1, Duration: time.Minute})
+	d.AddJob(&model.Job{ID: "Cores", SizeMB: 1000, CPUCores: 8, Duration: time.Minute})
+
+	got := make(map[string]string)
+	for _, a := range d.Match() {
+		got[a.Worker.ID] = a.Job.ID
+	}
+	clock = clock.Add(10 * time.Second)
+	d.Match()
+	if want := map[string]string{"Deep": "Cores", "Wide": "Big"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("assigned %v, want %v", got, want)
+	}
+	if r := d.ReservationReport(); len(r) != 0 {
+		t.Fatalf("report = %+v, want no held worker left idle", r)
+	}
+}
@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// Decision records one bucket search Match did for one idle worker: where it looked, what it
+// passed over and what it took. A reserved worker that finds no heavy job and is then
+// backfilled gets two decisions in the same round ("reserved", then "backfill").
+type Decision struct {
+	Round      int       `json:"round"`
+	At         time.Time `json:"at"`
+	WorkerID   string    `json:"worker"`
+	CapacityMB int       `json:"capacity_mb"` // dominant-resource capacity the search started from
+	Phase      string    `json:"phase"`       // "reserved", "backfill" or "free"
+	Reserved   bool      `json:"reserved"`    // held for heavy jobs this round
+
+	// The searched sizes: the bucket range [SearchFromMB, SearchToMB).
+	SearchFromMB int `json:"search_from_mb"`
+	SearchToMB   int `json:"search_to_mb"`
+
+	// Non-empty buckets in the range that were passed over, heaviest first. The chosen job's
+	// bucket is listed too if jobs ahead of it there were passed over.
+	Skipped []SkippedBucket `json:"skipped,omitempty"`
+
+	// Blocked: the worker got nothing although it could have run BlockedJobs queued jobs
+	// below the heavy buckets, which reservation keeps it from.
+	Blocked     bool `json:"blocked,omitempty"`
+	BlockedJobs int  `json:"blocked_jobs,omitempty"`
+
+	JobID     string `json:"job,omitempty"` // chosen job, "" if none
+	JobSizeMB int    `json:"job_size_mb,omitempty"`
+}
+
+// SkippedBucket is a non-empty bucket a search looked at, with why each job it passed over there
+// was passed over: all of them, or in the chosen job's bucket the ones ahead of it in Pop order.
+type SkippedBucket struct {
+	MinSize  int `json:"min_mb"`
+	MaxSize  int `json:"max_mb"`
+	Jobs     int `json:"jobs"`                // queued in the bucket when the search began
+	TooLarge int `json:"too_large,omitempty"` // bigger than the worker's capacity
+	NoFit    int `json:"no_fit,omitempty"`    // short on another resource (CPU, disk, accelerators)
+	Filtered int `json:"filtered,omitempty"`  // rejected by the phase's filter (backfill estimate, DRF owner)
+}
+
+// searchTraced is pick plus, when Tracing is on, a Decision for the search.
+// Tracing copies the searched buckets' queues before the pick, so it costs O(queued jobs in
+// the searched range) per search.
+func (d *Dispatcher) searchTraced(w *model.Worker, minBucketIndex int, ok func(*model.Job) bool, phase string, reserved bool, now time.Time) *model.Job {
+	if !d.Tracing {
+		return d.pick(w, minBucketIndex, ok)
+	}
+
+	bm := d.Buckets
+	capacity := d.capacity(w)
+	startIdx := bm.GetBucketIndex(capacity)
+	// The pick takes the chosen job out of its bucket, and with it the record of which jobs
+	// were ahead of it, so keep each searched bucket's queue in Pop order first.
+	queued := make(map[int][]*model.Job)
+	for i := startIdx; i >= minBucketIndex; i-- {
+		bm.Buckets[i].Each(func(j *model.Job) bool {
+			queued[i] = append(queued[i], j)
+			return true
+		})
+	}
+	job := d.pick(w, minBucketIndex, ok)
+
+	dec := Decision{
+		Round: d.round, At: now, WorkerID: w.ID, CapacityMB: capacity, Phase: phase, Reserved: reserved,
+		SearchFromMB: bm.Buckets[minBucketIndex].MinSize, SearchToMB: bm.Buckets[startIdx].MaxSize,
+	}
+	// Every job in the buckets above the chosen job's one was searched and passed over, and
+	// so was every job ahead of it in its own bucket.
+	stopIdx := minBucketIndex
+	if job != nil {
+		dec.JobID, dec.JobSizeMB = job.ID, bm.Size(job)
+		stopIdx = bm.GetBucketIndex(dec.JobSizeMB)
+	}
+	for i := startIdx; i >= stopIdx; i-- {
+		jobs := queued[i]
+		sb := SkippedBucket{MinSize: bm.Buckets[i].MinSize, MaxSize: bm.Buckets[i].MaxSize, Jobs: len(jobs)}
+		for _, j := range jobs {
+			if j == job {
+				break
+			}
+			switch {
+			case bm.Size(j) > capacity:
+				sb.TooLarge++
+			case !w.Fits(j):
+				sb.NoFit++
+			default:
+				sb.Filtered++
+			}
+		}
+		if sb.TooLarge+sb.NoFit+sb.Filtered > 0 {
+			dec.Skipped = append(dec.Skipped, sb)
+		}
+	}
+	if job == nil && phase == "reserved" {
+		for i := 0; i < minBucketIndex && i <= startIdx; i++ {
+			bm.Buckets[i].Each(func(j *model.Job) bool {
+				if bm.Size(j) <= capacity && w.Fits(j) {
+					dec.BlockedJobs++
+				}
+				return true
+			})
+		}
+		dec.Blocked = dec.BlockedJobs > 0
+	}
+
+	d.Trace = append(d.Trace, dec)
+	if d.TraceWriter != nil {
+		if d.traceEnc == nil || d.traceTo != d.TraceWriter {
+			d.traceEnc, d.traceTo = json.NewEncoder(d.TraceWriter), d.TraceWriter
+		}
+		if err := d.traceEnc.Encode(dec); err != nil {
+			d.logf("[TRACE] writing decision failed, JSON trace turned off: %v\n", err)
+			d.TraceWriter = nil
+		}
+	}
+	return job
+}
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/adarsh/woc1/queue_algo/02_bucket_reservation/pkg/model"
+)
+
+// The job at the head of the chosen bucket needs more cores than the worker has: the worker
+// takes the one behind it, and the trace must say the head was passed over for NoFit.
+func TestTraceCountsSkipsInChosenBucket(t *testing.T) {
+	d := NewDispatcher(2000)
+	d.Silent, d.Buckets.Silent = true, true
+	d.Tracing = true
+	var out bytes.Buffer
+	d.TraceWriter = &out
+	d.AddWorker(&model.Worker{ID: "A", CapacityMB: 1000, CPUCores: 2})
+	d.AddWorker(&model.Worker{ID: "B", CapacityMB: 1000, CPUCores: 2})
+	d.AddJob(&model.Job{ID: "Cores", SizeMB: 520, CPUCores: 8})
+	d.AddJob(&model.Job{ID: "Plain", SizeMB: 510})
+	d.AddJob(&model.Job{ID: "Small", SizeMB: 100})
+	d.Match()
+
+	if len(d.Trace) != 2 {
+		t.Fatalf("trace %+v, want 2 decisions", d.Trace)
+	}
+	dec := d.Trace[0]
+	want := []SkippedBucket{{MinSize: 500, MaxSize: 550, Jobs: 2, NoFit: 1}}
+	if dec.JobID != "Plain" || !reflect.DeepEqual(dec.Skipped, want) {
+		t.Fatalf("A: took %s, skipped %+v; want Plain, %+v", dec.JobID, dec.Skipped, want)
+	}
+	// B finds Cores alone in that bucket and passes over all of it.
+	want = []SkippedBucket{{MinSize: 500, MaxSize: 550, Jobs: 1, NoFit: 1}}
+	if dec := d.Trace[1]; dec.JobID != "Small" || !reflect.DeepEqual(dec.Skipped, want) {
+		t.Fatalf("B: took %s, skipped %+v; want Small, %+v", dec.JobID, dec.Skipped, want)
+	}
+
+	var lines []Decision
+	for sc := bufio.NewScanner(&out); sc.Scan(); {
+		var dec Decision
+		if err := json.Unmarshal(sc.Bytes(), &dec); err != nil {
+			t.Fatalf("trace line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, dec)
+	}
+	if len(lines) != 2 || lines[0].JobID != "Plain" || lines[1].JobID != "Small" {
+		t.Fatalf("JSON trace %+v, want the two decisions", lines)
+	}
+}
@@ -1,107 +1,436 @@
 package model
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"sort"
+	"time"
 )
 
 const BucketInterval = 50
 
-// JobBucket represents a single queue for a specific memory range
+// JobBucket represents a single queue for a specific memory range.
+// Jobs leave in priority order (higher Job.Priority first) and FIFO within a priority:
+// each priority in use has its own ring buffer (see jobRing), so Push, Pop, Peek and Remove
+// cost O(number of priorities in use), not O(jobs). The zero value is an empty bucket.
 type JobBucket struct {
 	MinSize int
 	MaxSize int
-	Jobs    []*Job
+
+	levels []*priorityLevel // highest priority first; empty levels are dropped
+	live   int
+}
+
+type priorityLevel struct {
+	priority int
+	jobs     jobRing
 }
 
 func (b *JobBucket) Push(j *Job) {
-	b.Jobs = append(b.Jobs, j)
+	i := sort.Search(len(b.levels), func(i int) bool { return b.levels[i].priority <= j.Priority })
+	if i == len(b.levels) || b.levels[i].priority != j.Priority {
+		b.levels = append(b.levels, nil)
+		copy(b.levels[i+1:], b.levels[i:])
+		b.levels[i] = &priorityLevel{priority: j.Priority}
+	}
+	b.levels[i].jobs.push(j)
+	b.live++
 }
 
+// Pop removes and returns the oldest job of the highest priority (nil if the bucket is empty).
 func (b *JobBucket) Pop() *Job {
-	if len(b.Jobs) == 0 {
+	if b.live == 0 {
 		return nil
 	}
-	j := b.Jobs[0]
-	b.Jobs = b.Jobs[1:]
-	return j
+	return b.taken(0, b.levels[0].jobs.pop())
+}
+
+// Peek returns the job Pop would return, without removing it.
+func (b *JobBucket) Peek() *Job {
+	if b.live == 0 {
+		return nil
+	}
+	return b.levels[0].jobs.peek()
+}
+
+// Remove cancels the queued job with the given ID, wherever it is in the queue.
+func (b *JobBucket) Remove(id string) (*Job, bool) {
+	for i, l := range b.levels {
+		if j, ok := l.jobs.remove(id); ok {
+			return b.taken(i, j), true
+		}
+	}
+	return nil, false
+}
+
+// Get returns the queued job with the given ID without removing it.
+func (b *JobBucket) Get(id string) (*Job, bool) {
+	for _, l := range b.levels {
+		if j, ok := l.jobs.get(id); ok {
+			return j, true
+		}
+	}
+	return nil, false
+}
+
+// PopFirst removes the first job, in Pop order, for which ok returns true.
+func (b *JobBucket) PopFirst(ok func(*Job) bool) *Job {
+	for i, l := range b.levels {
+		if j := l.jobs.popFirst(ok); j != nil {
+			return b.taken(i, j)
+		}
+	}
+	return nil
+}
+
+// Each calls fn on the queued jobs, in Pop order, until fn returns false.
+func (b *JobBucket) Each(fn func(*Job) bool) {
+	more := true
+	for _, l := range b.levels {
+		l.jobs.each(func(j *Job) bool {
+			more = fn(j)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
 }
 
 func (b *JobBucket) IsEmpty() bool {
-	return len(b.Jobs) == 0
+	return b.live == 0
 }
 
 func (b *JobBucket) Len() int {
-	return len(b.Jobs)
+	return b.live
 }
 
+// Cap is the total size of the ring buffers: the memory the bucket holds on to.
+func (b *JobBucket) Cap() int {
+	n := 0
+	for _, l := range b.levels {
+		n += l.jobs.cap()
+	}
+	return n
+}
+
+// taken does the bookkeeping for job j having left level i.
+func (b *JobBucket) taken(i int, j *Job) *Job {
+	b.live--
+	if b.levels[i].jobs.len() == 0 {
+		last := len(b.levels) - 1
+		copy(b.levels[i:], b.levels[i+1:])
+		b.levels[last] = nil // don't keep the dropped level's ring alive past the end
+		b.levels = b.levels[:last]
+	}
+	return j
+}
+
+var (
+	ErrJobTooLarge  = errors.New("job is larger than the largest bucket")
+	ErrDuplicateJob = errors.New("a job with this ID is already queued")
+	ErrUnknownJob   = errors.New("no queued job with this ID")
+)
+
 // BucketManager holds all buckets
+// Bucket i holds jobs with MinSize <= size < MaxSize; the ranges are contiguous.
+// The size is SizeMB, or whatever SizeOf returns (e.g. Scale.JobSize for the dominant resource).
 type BucketManager struct {
-	Buckets []*JobBucket
+	Buckets  []*JobBucket
+	Layout   BucketLayout
+	Overflow OverflowPolicy
+	// SizeOf is the key jobs are bucketed on. nil means SizeMB.
+	// Set it before adding jobs: queued jobs are not moved when it changes.
+	SizeOf func(*Job) int
+	// Silent turns off the per-job console logging (useful for large simulations).
+	Silent bool
+
+	// byID is the index of the bucket every queued job is in, for CancelJob, ResizeJob and SetPriority.
+	byID map[string]int
+	// owners is the per-owner view of the queue for Owners and GetHeaviestJobOf (DRF).
+	// It is built on first use and kept in step from then on; nil until then.
+	owners map[string]*ownerQueue
+}
+
+func (bm *BucketManager) logf(format string, args ...interface{}) {
+	if !bm.Silent {
+		fmt.Printf(format, args...)
+	}
 }
 
+// NewBucketManager is the original layout: linear BucketInterval-MB buckets up to maxSizeMB,
+// with anything larger going to one overflow bucket (it used to be clamped into the last bucket).
+// A negative maxSizeMB is treated as 0: a single 0-BucketInterval bucket plus the overflow one.
 func NewBucketManager(maxSizeMB int) *BucketManager {
-	// Create buckets up to maxSizeMB
-	// e.g. 0-50, 51-100, ...
-	numBuckets := (maxSizeMB / BucketInterval) + 1
-	bm := &BucketManager{
-		Buckets: make([]*JobBucket, numBuckets),
-	}
-
-	for i := 0; i < numBuckets; i++ {
-		min := i * BucketInterval
-		max := (i + 1) * BucketInterval
-		if i == 0 {
-			min = 0
-		} // Handle 0-50
-		bm.Buckets[i] = &JobBucket{
-			MinSize: min,
-			MaxSize: max,
-			Jobs:    make([]*Job, 0),
-		}
+	bm, _ := NewBucketManagerWithLayout(LinearLayout{Interval: BucketInterval, MaxSizeMB: max(maxSizeMB, 0)}, OverflowBucket)
+	return bm // the layout is always valid
+}
+
+// NewBucketManagerWithLayout builds the buckets for layout, or returns the layout's
+// Validate error.
+func NewBucketManagerWithLayout(layout BucketLayout, overflow OverflowPolicy) (*BucketManager, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
 	}
-	return bm
+	bm := &BucketManager{Layout: layout, Overflow: overflow, byID: make(map[string]int)}
+	for _, edge := range layout.Edges() {
+		bm.appendBucket(edge)
+	}
+	if overflow == OverflowBucket {
+		bm.appendBucket(math.MaxInt)
+	}
+	return bm, nil
 }
 
-// GetBucketIndex returns the index for a given size
+// Size is the key j is (or would be) bucketed under.
+func (bm *BucketManager) Size(j *Job) int {
+	if bm.SizeOf == nil {
+		return j.SizeMB
+	}
+	return bm.SizeOf(j)
+}
+
+func (bm *BucketManager) appendBucket(maxSize int) {
+	min := 0
+	if n := len(bm.Buckets); n > 0 {
+		min = bm.Buckets[n-1].MaxSize
+	}
+	bm.Buckets = append(bm.Buckets, &JobBucket{MinSize: min, MaxSize: maxSize})
+	for _, q := range bm.owners {
+		q.buckets = append(q.buckets, &JobBucket{MinSize: min, MaxSize: maxSize})
+	}
+}
+
+// GetBucketIndex returns the index of the bucket sizeMB falls in (binary search over the edges).
+// Sizes past the last bucket map to the last bucket, which is what capacity searches want;
+// AddJob applies the overflow policy before it gets here.
 func (bm *BucketManager) GetBucketIndex(sizeMB int) int {
-	// if size is 0-49 -> index 0. 50-99 -> index 1.
-	// Actually logic: size / 50.
-	idx := sizeMB / BucketInterval
+	idx := sort.Search(len(bm.Buckets), func(i int) bool { return sizeMB < bm.Buckets[i].MaxSize })
 	if idx >= len(bm.Buckets) {
-		// Extend or cap? Ideally we'd extend dynamicall logic, but for now lets cap at max bucket or panic
-		// Returning last bucket for overflow
 		return len(bm.Buckets) - 1
 	}
 	return idx
 }
 
-func (bm *BucketManager) AddJob(j *Job) {
-	idx := bm.GetBucketIndex(j.SizeMB)
+// MaxJobSize is the largest size the current buckets can hold (math.MaxInt-1 with an overflow
+// bucket, -1 with no buckets at all).
+func (bm *BucketManager) MaxJobSize() int {
+	if len(bm.Buckets) == 0 {
+		return -1
+	}
+	return bm.Buckets[len(bm.Buckets)-1].MaxSize - 1
+}
+
+func (bm *BucketManager) AddJob(j *Job) error {
+	if _, ok := bm.byID[j.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, j.ID)
+	}
+	if err := bm.checkSize(j); err != nil {
+		return err
+	}
+	idx := bm.place(j)
+	bm.logf("[BucketManager] Added %s to Bucket[%d] (%d-%d MB)\n", j, idx, bm.Buckets[idx].MinSize, bm.Buckets[idx].MaxSize)
+	return nil
+}
+
+// checkSize applies the overflow policy to j: it fails under OverflowReject, grows under OverflowGrow.
+func (bm *BucketManager) checkSize(j *Job) error {
+	size := bm.Size(j)
+	if size <= bm.MaxJobSize() {
+		return nil
+	}
+	if bm.Overflow != OverflowGrow {
+		return fmt.Errorf("%w: %s (max %dMB)", ErrJobTooLarge, j, bm.MaxJobSize())
+	}
+	for size > bm.MaxJobSize() {
+		bm.appendBucket(bm.Layout.Next(bm.Buckets[len(bm.Buckets)-1].MaxSize))
+	}
+	bm.logf("[BucketManager] Grew to %d buckets for %s\n", len(bm.Buckets), j)
+	return nil
+}
+
+// place queues j (already size-checked) in its bucket and returns the bucket index.
+func (bm *BucketManager) place(j *Job) int {
+	idx := bm.GetBucketIndex(bm.Size(j))
 	bm.Buckets[idx].Push(j)
-	fmt.Printf("[BucketManager] Added %s to Bucket[%d] (%d-%d MB)\n", j, idx, bm.Buckets[idx].MinSize, bm.Buckets[idx].MaxSize)
+	bm.byID[j.ID] = idx
+	bm.ownerAdd(j, idx)
+	return idx
+}
+
+// CancelJob removes a queued job. O(1) apart from the bucket's priority levels.
+func (bm *BucketManager) CancelJob(id string) (*Job, error) {
+	idx, ok := bm.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJob, id)
+	}
+	delete(bm.byID, id)
+	j, _ := bm.Buckets[idx].Remove(id)
+	bm.ownerRemove(j, idx)
+	bm.logf("[BucketManager] Cancelled %s\n", j)
+	return j, nil
+}
+
+// ResizeJob changes a queued job's memory size and moves it to the bucket the new size belongs
+// in, where it joins the back of its priority. It stays put if the bucket does not change.
+// A size the overflow policy rejects leaves the job as it was.
+func (bm *BucketManager) ResizeJob(id string, newSizeMB int) error {
+	idx, ok := bm.byID[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, id)
+	}
+	j, _ := bm.Buckets[idx].Get(id)
+	oldSize := j.SizeMB
+	j.SizeMB = newSizeMB
+	if err := bm.checkSize(j); err != nil {
+		j.SizeMB = oldSize
+		return err
+	}
+	if bm.GetBucketIndex(bm.Size(j)) != idx {
+		bm.Buckets[idx].Remove(id)
+		bm.ownerRemove(j, idx)
+		bm.place(j)
+	}
+	bm.logf("[BucketManager] Resized %s from %dMB\n", j, oldSize)
+	return nil
+}
+
+// SetPriority changes a queued job's priority (see Job.Priority). The job joins the back
+// of its new priority level in the same bucket.
+func (bm *BucketManager) SetPriority(id string, priority int) error {
+	idx, ok := bm.byID[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, id)
+	}
+	b := bm.Buckets[idx]
+	j, _ := b.Get(id)
+	if j.Priority == priority {
+		return nil
+	}
+	b.Remove(id)
+	bm.ownerRemove(j, idx)
+	j.Priority = priority
+	b.Push(j)
+	bm.ownerAdd(j, idx)
+	bm.logf("[BucketManager] %s now has priority %d\n", j, priority)
+	return nil
+}
+
+// NonEmpty returns how many buckets currently hold jobs.
+func (bm *BucketManager) NonEmpty() int {
+	n := 0
+	for _, b := range bm.Buckets {
+		if !b.IsEmpty() {
+			n++
+		}
+	}
+	return n
 }
 
 // GetHeaviestJobForCapacity finds the heaviest available job that fits within workerCapacity.
 // It searches from the largest possible bucket downwards.
 // excludedBuckets: useful if we want to forbid "Small" buckets (Reservation Mode)
 func (bm *BucketManager) GetHeaviestJobForCapacity(capacityMB int, minBucketIndex int) *Job {
+	return bm.GetHeaviestJobWhere(capacityMB, minBucketIndex, nil)
+}
+
+// GetHeaviestJobWhere is GetHeaviestJobForCapacity restricted to jobs accepted by ok
+// (nil accepts everything). Backfilling uses it to take only jobs short enough to finish in time.
+func (bm *BucketManager) GetHeaviestJobWhere(capacityMB int, minBucketIndex int, ok func(*Job) bool) *Job {
+	j, idx := bm.heaviestIn(bm.Buckets, capacityMB, minBucketIndex, ok)
+	if j != nil {
+		delete(bm.byID, j.ID)
+		bm.ownerRemove(j, idx)
+	}
+	return j
+}
+
+// heaviestIn takes the heaviest job accepted by ok out of buckets (bm.Buckets, or an owner's
+// buckets parallel to them) and returns it with its bucket index.
+func (bm *BucketManager) heaviestIn(buckets []*JobBucket, capacityMB int, minBucketIndex int, ok func(*Job) bool) (*Job, int) {
 	// Start from the bucket corresponding to capacityMB
 	startIdx := bm.GetBucketIndex(capacityMB)
 
-	// Scan downwards
-	for i := startIdx; i >= minBucketIndex; i-- {
-		if !bm.Buckets[i].IsEmpty() {
-			return bm.Buckets[i].Pop()
+	// That bucket can also hold jobs bigger than capacityMB (up to its MaxSize),
+	// so only take one that actually fits. Wide buckets (geometric layouts) make this common.
+	if startIdx >= minBucketIndex {
+		fits := func(j *Job) bool { return bm.Size(j) <= capacityMB && (ok == nil || ok(j)) }
+		if j := buckets[startIdx].PopFirst(fits); j != nil {
+			return j, startIdx
 		}
 	}
-	return nil
+
+	// Scan downwards: every job below the start bucket fits (on its size; ok checks the rest).
+	for i := startIdx - 1; i >= minBucketIndex; i-- {
+		if buckets[i].IsEmpty() {
+			continue
+		}
+		if ok == nil {
+			return buckets[i].Pop(), i
+		}
+		if j := buckets[i].PopFirst(ok); j != nil {
+			return j, i
+		}
+	}
+	return nil, -1
+}
+
+// Backlog summarizes the queued jobs of at least some size.
+type Backlog struct {
+	Jobs       int
+	OldestWait time.Duration
+	// Weighted counts each job as size / threshold, so one 3200MB job weighs as much as
+	// four 800MB ones when the threshold is 800MB.
+	Weighted float64
 }
 
-// TotalHeavyJobs returns count of jobs above a certain size threshold
+// HeavyJobs returns the queued jobs of size >= thresholdMB, smallest bucket first.
+func (bm *BucketManager) HeavyJobs(thresholdMB int) []*Job {
+	var heavy []*Job
+	for i := bm.GetBucketIndex(thresholdMB); i < len(bm.Buckets); i++ {
+		bm.Buckets[i].Each(func(j *Job) bool {
+			if bm.Size(j) >= thresholdMB { // the threshold's own bucket can start below it
+				heavy = append(heavy, j)
+			}
+			return true
+		})
+	}
+	return heavy
+}
+
+// HeavyBacklog measures the queued jobs of size >= thresholdMB as of now.
+func (bm *BucketManager) HeavyBacklog(thresholdMB int, now time.Time) Backlog {
+	return bm.BacklogOf(bm.HeavyJobs(thresholdMB), thresholdMB, now)
+}
+
+// BacklogOf measures jobs (a HeavyJobs list) against thresholdMB as of now. Callers that need the
+// list anyway use it to avoid walking the heavy buckets twice.
+func (bm *BucketManager) BacklogOf(jobs []*Job, thresholdMB int, now time.Time) Backlog {
+	var bl Backlog
+	for _, j := range jobs {
+		bl.Jobs++
+		bl.Weighted += float64(bm.Size(j)) / float64(thresholdMB)
+		if wait := now.Sub(j.ArrivalTime); wait > bl.OldestWait {
+			bl.OldestWait = wait
+		}
+	}
+	return bl
+}
+
+// TotalHeavyJobs returns how many queued jobs have size >= thresholdMB: the jobs HeavyJobs
+// lists, counted without building the list. Only the threshold's own bucket is walked, since
+// it can start below the threshold; the buckets above it are counted whole.
 func (bm *BucketManager) TotalHeavyJobs(thresholdMB int) int {
 	startIdx := bm.GetBucketIndex(thresholdMB)
 	count := 0
-	for i := startIdx; i < len(bm.Buckets); i++ {
+	bm.Buckets[startIdx].Each(func(j *Job) bool {
+		if bm.Size(j) >= thresholdMB {
+			count++
+		}
+		return true
+	})
+	for i := startIdx + 1; i < len(bm.Buckets); i++ {
 		count += bm.Buckets[i].Len()
 	}
 	return count
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// TestBucketSoak churns one bucket holding ~1000 jobs: every cycle pushes a job and pops the
+// oldest, and every 4th cycle also cancels a queued job by ID. The ring must stay within a
+// fixed size and the heap must not grow between the first million cycles and the last.
+func TestBucketSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("3M-cycle soak")
+	}
+	const (
+		cycles    = 3_000_000
+		maxSlots  = 4096    // ~1000 live jobs plus cancelled slots, rounded up to a power of two
+		maxGrowth = 1 << 20 // heap bytes
+	)
+	var b JobBucket
+	next := 0
+	push := func() {
+		b.Push(&Job{ID: strconv.Itoa(next), SizeMB: 100})
+		next++
+	}
+	for i := 0; i < 1000; i++ {
+		push()
+	}
+
+	heap := func() uint64 {
+		var ms runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		return ms.HeapAlloc
+	}
+	var base uint64
+	for i := 1; i <= cycles; i++ {
+		push()
+		b.Pop()
+		if i%4 == 0 {
+			push() // replace the cancelled job so the bucket stays at ~1000
+			b.Remove(strconv.Itoa(next - 500))
+		}
+		if b.Cap() > maxSlots {
+			t.Fatalf("cycle %d: ring grew to %d slots for %d jobs", i, b.Cap(), b.Len())
+		}
+		if i%1_000_000 != 0 {
+			continue
+		}
+		if h := heap(); base == 0 {
+			base = h
+		} else if h > base+maxGrowth {
+			t.Fatalf("after %dM cycles: heap %d bytes, %d more than after 1M", i/1_000_000, h, h-base)
+		}
+	}
+	if b.Len() < 900 || b.Len() > 1100 {
+		t.Fatalf("%d jobs queued, want ~1000", b.Len())
+	}
+}
+
+// Dropping an emptied priority level must not leave it reachable past the end of levels.
+func TestJobBucketDropsEmptyLevels(t *testing.T) {
+	var b JobBucket
+	for p := 0; p < 4; p++ {
+		b.Push(&Job{ID: strconv.Itoa(p), SizeMB: 100, Priority: p})
+	}
+	b.Remove("2")
+	b.Pop() // priority 3
+	if len(b.levels) != 2 {
+		t.Fatalf("%d levels, want 2", len(b.levels))
+	}
+	for i, l := range b.levels[len(b.levels):cap(b.levels)] {
+		if l != nil {
+			t.Fatalf("stale level %d (priority %d) past the end", len(b.levels)+i, l.priority)
+		}
+	}
+}
+
+// TotalHeavyJobs counts exactly the jobs HeavyJobs lists, even when the threshold falls inside
+// a bucket (825MB is in the 800-850MB bucket).
+func TestTotalHeavyJobsUsesTheThreshold(t *testing.T) {
+	bm := NewBucketManager(2000)
+	bm.Silent = true
+	for i, size := range []int{810, 824, 825, 849, 900, 5000} {
+		bm.AddJob(&Job{ID: strconv.Itoa(i), SizeMB: size})
+	}
+	for _, threshold := range []int{0, 800, 825, 850, 3000, 10000} {
+		if got, want := bm.TotalHeavyJobs(threshold), len(bm.HeavyJobs(threshold)); got != want {
+			t.Errorf("TotalHeavyJobs(%d) = %d, HeavyJobs lists %d", threshold, got, want)
+		}
+	}
+	if got := bm.TotalHeavyJobs(825); got != 4 {
+		t.Errorf("TotalHeavyJobs(825) = %d, want 4 (825, 849, 900, 5000)", got)
+	}
+}
+
+// popIDs empties b and returns the IDs in the order they came out.
+func popIDs(b *JobBucket) []string {
+	var ids []string
+	for !b.IsEmpty() {
+		ids = append(ids, b.Pop().ID)
+	}
+	return ids
+}
+
+// Raising a queued job's priority moves it ahead of the rest of its bucket, at the back of its
+// new level.
+func TestSetPriorityReordersBucket(t *testing.T) {
+	bm := NewBucketManager(2000)
+	bm.Silent = true
+	for i, id := range []string{"A", "B", "C", "D"} {
+		bm.AddJob(&Job{ID: id, SizeMB: 100 + 10*i}) // all in the 100-150MB bucket
+	}
+	if err := bm.SetPriority("C", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.SetPriority("A", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.SetPriority("X", 5); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("SetPriority(X): %v, want ErrUnknownJob", err)
+	}
+	b := bm.Buckets[bm.GetBucketIndex(100)]
+	if got, want := popIDs(b), []string{"C", "A", "B", "D"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pop order %v, want %v", got, want)
+	}
+}
+
+// A resize that crosses a bucket edge moves the job there; one that does not leaves it in place.
+func TestResizeMovesJobToItsBucket(t *testing.T) {
+	bm := NewBucketManager(2000)
+	bm.Silent = true
+	bm.AddJob(&Job{ID: "A", SizeMB: 100})
+	bm.AddJob(&Job{ID: "B", SizeMB: 920})
+	from, to := bm.GetBucketIndex(100), bm.GetBucketIndex(900)
+
+	if err := bm.ResizeJob("A", 910); err != nil {
+		t.Fatal(err)
+	}
+	if !bm.Buckets[from].IsEmpty() {
+		t.Fatalf("Bucket[%d] still holds %d jobs", from, bm.Buckets[from].Len())
+	}
+	if _, ok := bm.Buckets[to].Get("A"); !ok || bm.byID["A"] != to {
+		t.Fatalf("A is not in Bucket[%d] (indexed in %d)", to, bm.byID["A"])
+	}
+	if j := bm.GetHeaviestJobForCapacity(500, 0); j != nil {
+		t.Fatalf("a 500MB worker got %v after A grew", j)
+	}
+
+	// 940MB is still the 900-950MB bucket: A keeps its place ahead of B.
+	if err := bm.ResizeJob("A", 940); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := popIDs(bm.Buckets[to]), []string{"B", "A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Bucket[%d] pop order %v, want %v", to, got, want)
+	}
+}
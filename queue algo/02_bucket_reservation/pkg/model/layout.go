@@ -0,0 +1,142 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var ErrInvalidLayout = errors.New("invalid bucket layout")
+
+// BucketLayout decides where the bucket boundaries go.
+// Bucket i holds sizes in [edge i-1, edge i), the first bucket starts at 0.
+type BucketLayout interface {
+	Name() string
+	// Edges returns the upper edge (exclusive) of every bucket, strictly ascending.
+	Edges() []int
+	// Next returns the upper edge of the bucket that would follow one ending at edge.
+	// Used by OverflowGrow to add buckets on demand.
+	Next(edge int) int
+	// Validate reports a layout Edges or Next can't work with (wrapping ErrInvalidLayout).
+	Validate() error
+}
+
+// LinearLayout: fixed-width buckets, 0-Interval, Interval-2*Interval, ... covering MaxSizeMB.
+// This is the original layout (Interval = BucketInterval).
+type LinearLayout struct {
+	Interval  int
+	MaxSizeMB int
+}
+
+func (l LinearLayout) Name() string { return fmt.Sprintf("linear(%dMB)", l.Interval) }
+func (l LinearLayout) Edges() []int {
+	n := l.MaxSizeMB/l.Interval + 1
+	edges := make([]int, n)
+	for i := range edges {
+		edges[i] = (i + 1) * l.Interval
+	}
+	return edges
+}
+func (l LinearLayout) Next(edge int) int { return edge + l.Interval }
+func (l LinearLayout) Validate() error {
+	if l.Interval <= 0 || l.MaxSizeMB < 0 {
+		return fmt.Errorf("%w: %s needs Interval > 0 and MaxSizeMB >= 0, got %d and %d",
+			ErrInvalidLayout, l.Name(), l.Interval, l.MaxSizeMB)
+	}
+	return nil
+}
+
+// GeometricLayout: every bucket is Factor times wider than the previous one, starting with
+// 0-FirstMB. Good when sizes span orders of magnitude (10MB to 12GB is ~11 buckets at Factor 2,
+// instead of ~250 linear 50MB ones): the relative waste of a bucket stays the same at any size.
+type GeometricLayout struct {
+	FirstMB   int
+	Factor    float64
+	MaxSizeMB int
+}
+
+func (l GeometricLayout) Name() string {
+	return fmt.Sprintf("geometric(%dMB x%.3g)", l.FirstMB, l.Factor)
+}
+func (l GeometricLayout) Edges() []int {
+	edges := []int{l.FirstMB}
+	for edges[len(edges)-1] <= l.MaxSizeMB {
+		edges = append(edges, l.Next(edges[len(edges)-1]))
+	}
+	return edges
+}
+func (l GeometricLayout) Next(edge int) int {
+	next := int(math.Ceil(float64(edge) * l.Factor))
+	if next <= edge {
+		next = edge + 1
+	}
+	return next
+}
+func (l GeometricLayout) Validate() error {
+	if l.FirstMB <= 0 || !(l.Factor > 1) || l.MaxSizeMB < 0 {
+		return fmt.Errorf("%w: %s needs FirstMB > 0, Factor > 1 and MaxSizeMB >= 0",
+			ErrInvalidLayout, l.Name())
+	}
+	return nil
+}
+
+// ExplicitLayout uses the given upper edges as-is, e.g. the sizes of the worker types you run.
+// They must be positive and strictly ascending.
+type ExplicitLayout struct {
+	EdgesMB []int
+}
+
+func (l ExplicitLayout) Name() string { return fmt.Sprintf("explicit(%d buckets)", len(l.EdgesMB)) }
+func (l ExplicitLayout) Edges() []int {
+	return append([]int(nil), l.EdgesMB...)
+}
+
+// Next repeats the width of the last bucket.
+func (l ExplicitLayout) Next(edge int) int {
+	edges := l.EdgesMB
+	width := edges[0]
+	if len(edges) > 1 {
+		width = edges[len(edges)-1] - edges[len(edges)-2]
+	}
+	return edge + width
+}
+
+func (l ExplicitLayout) Validate() error {
+	if len(l.EdgesMB) == 0 {
+		return fmt.Errorf("%w: explicit layout has no edges", ErrInvalidLayout)
+	}
+	if l.EdgesMB[0] <= 0 {
+		return fmt.Errorf("%w: explicit layout edge %d is not positive", ErrInvalidLayout, l.EdgesMB[0])
+	}
+	for i := 1; i < len(l.EdgesMB); i++ {
+		if l.EdgesMB[i] <= l.EdgesMB[i-1] {
+			return fmt.Errorf("%w: explicit layout edges must be strictly ascending, got %d after %d",
+				ErrInvalidLayout, l.EdgesMB[i], l.EdgesMB[i-1])
+		}
+	}
+	return nil
+}
+
+// OverflowPolicy decides what happens to a job larger than the last bucket.
+type OverflowPolicy int
+
+const (
+	// OverflowReject refuses the job: AddJob returns ErrJobTooLarge.
+	OverflowReject OverflowPolicy = iota
+	// OverflowBucket puts it in one extra, unbounded bucket after the last edge.
+	OverflowBucket
+	// OverflowGrow appends buckets (using the layout's Next) until the job fits.
+	OverflowGrow
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowReject:
+		return "reject"
+	case OverflowBucket:
+		return "overflow-bucket"
+	case OverflowGrow:
+		return "grow"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInvalidLayoutsRejected(t *testing.T) {
+	for _, layout := range []BucketLayout{
+		LinearLayout{Interval: 0, MaxSizeMB: 1000},
+		LinearLayout{Interval: 50, MaxSizeMB: -1},
+		GeometricLayout{FirstMB: 0, Factor: 2, MaxSizeMB: 1000},
+		GeometricLayout{FirstMB: 16, Factor: 1, MaxSizeMB: 1000},
+		ExplicitLayout{},
+		ExplicitLayout{EdgesMB: []int{0, 64}},
+		ExplicitLayout{EdgesMB: []int{64, 64, 256}},
+		ExplicitLayout{EdgesMB: []int{256, 64}},
+	} {
+		bm, err := NewBucketManagerWithLayout(layout, OverflowGrow)
+		if bm != nil || !errors.Is(err, ErrInvalidLayout) {
+			t.Errorf("%#v: got %v, %v, want ErrInvalidLayout", layout, bm, err)
+		}
+	}
+}
+
+func TestValidLayouts(t *testing.T) {
+	for _, layout := range []BucketLayout{
+		LinearLayout{Interval: 50, MaxSizeMB: 0},
+		GeometricLayout{FirstMB: 16, Factor: 2, MaxSizeMB: 1000},
+		ExplicitLayout{EdgesMB: []int{64}},
+		ExplicitLayout{EdgesMB: []int{64, 256, 1024}},
+	} {
+		bm, err := NewBucketManagerWithLayout(layout, OverflowGrow)
+		if err != nil {
+			t.Fatalf("%#v: %v", layout, err)
+		}
+		bm.Silent = true
+		if err := bm.AddJob(&Job{ID: "big", SizeMB: 5000}); err != nil {
+			t.Fatalf("%#v: growing for a 5000MB job: %v", layout, err)
+		}
+	}
+	if got := (&BucketManager{}).MaxJobSize(); got != -1 {
+		t.Fatalf("MaxJobSize with no buckets = %d, want -1", got)
+	}
+}
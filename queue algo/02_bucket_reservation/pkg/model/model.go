@@ -2,22 +2,129 @@ package model
 
 import (
 	"fmt"
+	"time"
 )
 
 type Job struct {
 	ID     string
-	SizeMB int
+	SizeMB int // memory
+	// Other requirements. Zero means the job does not need that resource.
+	CPUCores     int
+	DiskMB       int
+	Accelerators int // GPU-like devices
+	// Owner is who submitted the job, for dominant-resource fairness (Config.DRF).
+	Owner string
+	// Priority orders jobs within a bucket: higher first, FIFO among equals.
+	// Change it on a queued job with BucketManager.SetPriority.
+	Priority int
+	// Duration is how long the job runs once a worker picks it up (used by simulations).
+	Duration time.Duration
+	// Estimate is the runtime the submitter expects, used for backfilling decisions.
+	// 0 means use Duration. Like real estimates it can be wrong.
+	Estimate time.Duration
+	// ArrivalTime is when the job was queued (set by the Dispatcher if left zero).
+	ArrivalTime time.Time
 }
 
 func (j *Job) String() string {
-	return fmt.Sprintf("Job{%s, %dMB}", j.ID, j.SizeMB)
+	return fmt.Sprintf("Job{%s, %dMB%s}", j.ID, j.SizeMB, extraResources(j.CPUCores, j.DiskMB, j.Accelerators))
+}
+
+// EstimatedDuration is Estimate, or Duration when no estimate was given.
+func (j *Job) EstimatedDuration() time.Duration {
+	if j.Estimate > 0 {
+		return j.Estimate
+	}
+	return j.Duration
 }
 
 type Worker struct {
 	ID         string
-	CapacityMB int
+	CapacityMB int // memory
+	// Other capacities. A job needing a resource the worker has 0 of cannot run on it.
+	CPUCores     int
+	DiskMB       int
+	Accelerators int
+
+	// Lifecycle, managed by the Dispatcher.
+	// A worker is idle until Match assigns it a job, then busy until CompleteJob.
+	Busy       bool
+	CurrentJob *Job
+	BusySince  time.Time
+	JoinedAt   time.Time
+	BusyTotal  time.Duration // time spent on finished jobs
+	Completed  int
+
+	// Reservation bookkeeping: time spent idle while held back for heavy jobs.
+	ReservedSince time.Time // start of the current reserved-idle stretch (zero = not in one)
+	ReservedIdle  time.Duration
 }
 
 func (w *Worker) String() string {
-	return fmt.Sprintf("Worker{%s, Cap:%dMB}", w.ID, w.CapacityMB)
+	return fmt.Sprintf("Worker{%s, Cap:%dMB%s}", w.ID, w.CapacityMB, extraResources(w.CPUCores, w.DiskMB, w.Accelerators))
+}
+
+// Assign marks the worker busy with j from now on.
+func (w *Worker) Assign(j *Job, now time.Time) {
+	w.Busy = true
+	w.CurrentJob = j
+	w.BusySince = now
+}
+
+// Release marks the worker idle again (the job ended at "at") and returns the job it was running.
+func (w *Worker) Release(at time.Time) *Job {
+	j := w.CurrentJob
+	w.BusyTotal += at.Sub(w.BusySince)
+	w.Completed++
+	w.Busy = false
+	w.CurrentJob = nil
+	w.BusySince = time.Time{}
+	return j
+}
+
+// FinishesAt is when the current job is expected to end (BusySince + Duration).
+func (w *Worker) FinishesAt() time.Time {
+	if !w.Busy {
+		return time.Time{}
+	}
+	return w.BusySince.Add(w.CurrentJob.Duration)
+}
+
+// EstimatedFree is when the worker is expected to be idle, by the current job's estimate.
+// An idle worker (or one running over its estimate) is free now.
+func (w *Worker) EstimatedFree(now time.Time) time.Time {
+	if !w.Busy {
+		return now
+	}
+	if end := w.BusySince.Add(w.CurrentJob.EstimatedDuration()); end.After(now) {
+		return end
+	}
+	return now
+}
+
+// BusyTime is the total time spent on jobs up to now, including the one still running.
+func (w *Worker) BusyTime(now time.Time) time.Duration {
+	t := w.BusyTotal
+	if w.Busy {
+		t += now.Sub(w.BusySince)
+	}
+	return t
+}
+
+// ReservedIdleTime is the total time spent idle while reserved, up to now.
+func (w *Worker) ReservedIdleTime(now time.Time) time.Duration {
+	t := w.ReservedIdle
+	if !w.ReservedSince.IsZero() {
+		t += now.Sub(w.ReservedSince)
+	}
+	return t
+}
+
+// Utilization is the fraction of the time since the worker joined that it spent busy.
+func (w *Worker) Utilization(now time.Time) float64 {
+	alive := now.Sub(w.JoinedAt)
+	if alive <= 0 {
+		return 0
+	}
+	return float64(w.BusyTime(now)) / float64(alive)
 }
@@ -0,0 +1,83 @@
+package model
+
+import "sort"
+
+// ownerQueue is one owner's queued jobs, in buckets parallel to BucketManager.Buckets.
+// Every queued job is in both, so "this owner's heaviest job" never looks at anyone else's.
+type ownerQueue struct {
+	buckets []*JobBucket
+	jobs    int
+}
+
+// indexOwners builds the per-owner view of the queue the first time it is needed.
+func (bm *BucketManager) indexOwners() {
+	if bm.owners != nil {
+		return
+	}
+	bm.owners = make(map[string]*ownerQueue)
+	for i, b := range bm.Buckets {
+		b.Each(func(j *Job) bool {
+			bm.ownerAdd(j, i) // Each is in Pop order, so the owner's bucket keeps it
+			return true
+		})
+	}
+}
+
+// ownerAdd files j, queued in bucket idx, under its owner (if the owner index is in use).
+func (bm *BucketManager) ownerAdd(j *Job, idx int) {
+	if bm.owners == nil {
+		return
+	}
+	q := bm.owners[j.Owner]
+	if q == nil {
+		q = &ownerQueue{buckets: make([]*JobBucket, len(bm.Buckets))}
+		for i, b := range bm.Buckets {
+			q.buckets[i] = &JobBucket{MinSize: b.MinSize, MaxSize: b.MaxSize}
+		}
+		bm.owners[j.Owner] = q
+	}
+	q.buckets[idx].Push(j)
+	q.jobs++
+}
+
+// ownerRemove drops j, which left bucket idx, from its owner's queue. Emptied owner queues are
+// kept, since owners tend to come back.
+func (bm *BucketManager) ownerRemove(j *Job, idx int) {
+	if q := bm.owners[j.Owner]; q != nil {
+		if _, ok := q.buckets[idx].Remove(j.ID); ok {
+			q.jobs--
+		}
+	}
+}
+
+// Owners returns the owners of the queued jobs, sorted. The first call builds a per-owner
+// index of the queue, kept up to date from then on, so it costs O(owners), not O(jobs).
+func (bm *BucketManager) Owners() []string {
+	bm.indexOwners()
+	var owners []string
+	for owner, q := range bm.owners {
+		if q.jobs > 0 {
+			owners = append(owners, owner)
+		}
+	}
+	sort.Strings(owners)
+	return owners
+}
+
+// GetHeaviestJobOf is GetHeaviestJobWhere for owner's jobs only. It searches that owner's own
+// buckets, so other owners' jobs cost nothing however many there are.
+func (bm *BucketManager) GetHeaviestJobOf(owner string, capacityMB int, minBucketIndex int, ok func(*Job) bool) *Job {
+	bm.indexOwners()
+	q := bm.owners[owner]
+	if q == nil || q.jobs == 0 {
+		return nil
+	}
+	j, idx := bm.heaviestIn(q.buckets, capacityMB, minBucketIndex, ok)
+	if j == nil {
+		return nil
+	}
+	q.jobs--
+	bm.Buckets[idx].Remove(j.ID)
+	delete(bm.byID, j.ID)
+	return j
+}
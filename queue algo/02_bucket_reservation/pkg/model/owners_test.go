@@ -0,0 +1,120 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestOwnerIndexMatchesScan runs random adds, cancels, resizes, priority changes and takes on two
+// managers fed the same jobs: one answers "owner X's heaviest job" from the owner index
+// (GetHeaviestJobOf), the other by filtering every job (GetHeaviestJobWhere). They must agree,
+// and Owners must list exactly the owners with queued jobs.
+func TestOwnerIndexMatchesScan(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		indexed, scanned := NewBucketManager(2000), NewBucketManager(2000)
+		indexed.Silent, scanned.Silent = true, true
+		queued := make(map[string]string) // job ID -> owner
+		var ids []string
+		owners := []string{"alice", "bob", "carol", "dave"}
+
+		for op := 0; op < 2000; op++ {
+			fail := func(format string, args ...interface{}) {
+				t.Fatalf("seed %d op %d: %s", seed, op, fmt.Sprintf(format, args...))
+			}
+			switch n := r.Intn(10); {
+			case n < 4:
+				id := fmt.Sprintf("J%d", op)
+				owner, size, prio := owners[r.Intn(len(owners))], r.Intn(2500), r.Intn(3)
+				indexed.AddJob(&Job{ID: id, Owner: owner, SizeMB: size, Priority: prio})
+				scanned.AddJob(&Job{ID: id, Owner: owner, SizeMB: size, Priority: prio})
+				queued[id] = owner
+				ids = append(ids, id)
+			case n < 5 && len(ids) > 0:
+				id := ids[r.Intn(len(ids))]
+				_, errA := indexed.CancelJob(id)
+				_, errB := scanned.CancelJob(id)
+				if (errA == nil) != (errB == nil) {
+					fail("CancelJob(%s): %v vs %v", id, errA, errB)
+				}
+				delete(queued, id)
+			case n < 6 && len(ids) > 0:
+				id, size := ids[r.Intn(len(ids))], r.Intn(2500)
+				indexed.ResizeJob(id, size)
+				scanned.ResizeJob(id, size)
+			case n < 7 && len(ids) > 0:
+				id, prio := ids[r.Intn(len(ids))], r.Intn(3)
+				indexed.SetPriority(id, prio)
+				scanned.SetPriority(id, prio)
+			default:
+				owner, capacity, minBucket := owners[r.Intn(len(owners))], r.Intn(2500), r.Intn(10)
+				small := func(j *Job) bool { return j.SizeMB%3 != 0 }
+				mine := func(j *Job) bool { return j.Owner == owner && small(j) }
+				a := indexed.GetHeaviestJobOf(owner, capacity, minBucket, small)
+				b := scanned.GetHeaviestJobWhere(capacity, minBucket, mine)
+				if (a == nil) != (b == nil) || a != nil && a.ID != b.ID {
+					fail("heaviest of %s within %dMB: indexed %v, scanned %v", owner, capacity, a, b)
+				}
+				if a != nil {
+					delete(queued, a.ID)
+				}
+			}
+
+			var want []string
+			for _, owner := range queued {
+				want = append(want, owner)
+			}
+			sort.Strings(want)
+			want = dedupe(want)
+			if got := indexed.Owners(); !reflect.DeepEqual(got, want) {
+				fail("Owners() = %v, want %v", got, want)
+			}
+		}
+	}
+}
+
+// A cancelled job leaves its owner's queue, and an owner with nothing left leaves Owners.
+func TestCancelRemovesFromOwnerIndex(t *testing.T) {
+	bm := NewBucketManager(2000)
+	bm.Silent = true
+	bm.AddJob(&Job{ID: "A1", Owner: "alice", SizeMB: 100})
+	bm.AddJob(&Job{ID: "A2", Owner: "alice", SizeMB: 600})
+	bm.AddJob(&Job{ID: "B1", Owner: "bob", SizeMB: 300})
+	if got := bm.Owners(); !reflect.DeepEqual(got, []string{"alice", "bob"}) {
+		t.Fatalf("Owners() = %v, want [alice bob]", got)
+	}
+
+	if _, err := bm.CancelJob("A2"); err != nil {
+		t.Fatal(err)
+	}
+	// GetHeaviestJobOf takes the job, so this also empties alice's queue.
+	if j := bm.GetHeaviestJobOf("alice", 2000, 0, nil); j == nil || j.ID != "A1" {
+		t.Fatalf("alice's heaviest job = %v, want A1 (A2 was cancelled)", j)
+	}
+	if _, err := bm.CancelJob("B1"); err != nil {
+		t.Fatal(err)
+	}
+	if j := bm.GetHeaviestJobOf("bob", 2000, 0, nil); j != nil {
+		t.Fatalf("bob's heaviest job = %v after cancelling the only one", j)
+	}
+	if got := bm.Owners(); len(got) != 0 {
+		t.Fatalf("Owners() = %v, want none", got)
+	}
+	if _, err := bm.CancelJob("B1"); !errors.Is(err, ErrUnknownJob) {
+		t.Fatalf("cancelling B1 twice: %v, want ErrUnknownJob", err)
+	}
+}
+
+func dedupe(s []string) []string {
+	var out []string
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
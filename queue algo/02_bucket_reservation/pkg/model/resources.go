@@ -0,0 +1,62 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// Fits reports whether w can run j on every resource: memory, CPU, disk and accelerators.
+func (w *Worker) Fits(j *Job) bool {
+	return j.SizeMB <= w.CapacityMB &&
+		j.CPUCores <= w.CPUCores &&
+		j.DiskMB <= w.DiskMB &&
+		j.Accelerators <= w.Accelerators
+}
+
+// Scale converts every resource into memory-equivalent MB, so a job can be bucketed on
+// whichever resource dominates it: with MBPerCore = 2048, an 8-core 512MB job has size
+// 16384, not 512, and lands in the buckets that only CPU-rich workers search.
+// The zero Scale ignores everything but memory (the original behaviour).
+type Scale struct {
+	MBPerCore   float64
+	MBPerDiskMB float64
+	MBPerAccel  float64
+}
+
+// DefaultScale prices a core at 2GB, an accelerator at 16GB and 20MB of disk at 1MB of memory.
+func DefaultScale() Scale {
+	return Scale{MBPerCore: 2048, MBPerDiskMB: 0.05, MBPerAccel: 16384}
+}
+
+// dominant is the largest of the scaled amounts, in MB.
+func (s Scale) dominant(memMB, cores, diskMB, accels int) int {
+	m := float64(memMB)
+	m = math.Max(m, float64(cores)*s.MBPerCore)
+	m = math.Max(m, float64(diskMB)*s.MBPerDiskMB)
+	m = math.Max(m, float64(accels)*s.MBPerAccel)
+	return int(math.Ceil(m))
+}
+
+// JobSize is the size the BucketManager files j under: its dominant resource in MB.
+func (s Scale) JobSize(j *Job) int {
+	return s.dominant(j.SizeMB, j.CPUCores, j.DiskMB, j.Accelerators)
+}
+
+// WorkerSize is the largest JobSize any job that Fits w can have, i.e. where w's search starts.
+func (s Scale) WorkerSize(w *Worker) int {
+	return s.dominant(w.CapacityMB, w.CPUCores, w.DiskMB, w.Accelerators)
+}
+
+func extraResources(cores, diskMB, accels int) string {
+	out := ""
+	if cores > 0 {
+		out += fmt.Sprintf(", %d cores", cores)
+	}
+	if diskMB > 0 {
+		out += fmt.Sprintf(", disk %dMB", diskMB)
+	}
+	if accels > 0 {
+		out += fmt.Sprintf(", %d accel", accels)
+	}
+	return out
+}
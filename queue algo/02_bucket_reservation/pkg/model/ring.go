@@ -0,0 +1,135 @@
+package model
+
+// jobRing is the FIFO queue behind each priority level of a JobBucket.
+//
+// It is a ring buffer (power-of-two size) rather than a slice popped with Jobs[1:], which kept
+// the whole backing array, and every popped job in it, alive under steady churn. Cancelled jobs
+// leave a nil slot that is skipped and reclaimed later, so push, pop, peek and remove are O(1)
+// amortized. The buffer doubles when full and halves when less than a quarter is in use.
+// The zero value is an empty queue.
+type jobRing struct {
+	ring  []*Job            // slot seq&(len-1) holds job number seq; nil = cancelled
+	head  uint64            // seq of the oldest slot (always live, unless empty)
+	tail  uint64            // seq the next Push gets
+	live  int               // jobs actually queued (tail-head minus cancelled slots)
+	index map[string]uint64 // job ID -> seq, for Remove
+}
+
+const minRing = 8
+
+func (b *jobRing) slot(seq uint64) *Job { return b.ring[seq&uint64(len(b.ring)-1)] }
+
+func (b *jobRing) push(j *Job) {
+	if b.ring == nil {
+		b.ring = make([]*Job, minRing)
+		b.index = make(map[string]uint64)
+	}
+	if int(b.tail-b.head) == len(b.ring) {
+		if b.live <= len(b.ring)/2 {
+			b.resize(len(b.ring)) // at least half the slots are cancelled: compacting is enough
+		} else {
+			b.resize(2 * len(b.ring))
+		}
+	}
+	b.ring[b.tail&uint64(len(b.ring)-1)] = j
+	b.index[j.ID] = b.tail
+	b.tail++
+	b.live++
+}
+
+// pop removes and returns the oldest job (nil if the bucket is empty).
+func (b *jobRing) pop() *Job {
+	if b.live == 0 {
+		return nil
+	}
+	return b.removeAt(b.head)
+}
+
+// peek returns the oldest job without removing it (nil if the bucket is empty).
+func (b *jobRing) peek() *Job {
+	if b.live == 0 {
+		return nil
+	}
+	return b.slot(b.head)
+}
+
+// remove cancels the queued job with the given ID, wherever it is in the queue.
+func (b *jobRing) remove(id string) (*Job, bool) {
+	seq, ok := b.index[id]
+	if !ok {
+		return nil, false
+	}
+	return b.removeAt(seq), true
+}
+
+// get returns the queued job with the given ID.
+func (b *jobRing) get(id string) (*Job, bool) {
+	seq, ok := b.index[id]
+	if !ok {
+		return nil, false
+	}
+	return b.slot(seq), true
+}
+
+// popFirst removes the oldest job for which ok returns true.
+func (b *jobRing) popFirst(ok func(*Job) bool) *Job {
+	for seq := b.head; seq != b.tail; seq++ {
+		if j := b.slot(seq); j != nil && ok(j) {
+			return b.removeAt(seq)
+		}
+	}
+	return nil
+}
+
+// each calls fn on the queued jobs, oldest first, until fn returns false.
+func (b *jobRing) each(fn func(*Job) bool) {
+	for seq := b.head; seq != b.tail; seq++ {
+		if j := b.slot(seq); j != nil && !fn(j) {
+			return
+		}
+	}
+}
+
+func (b *jobRing) len() int {
+	return b.live
+}
+
+// cap is the current ring size: the memory the queue holds on to.
+func (b *jobRing) cap() int {
+	return len(b.ring)
+}
+
+// removeAt empties slot seq and keeps head and tail on live slots.
+func (b *jobRing) removeAt(seq uint64) *Job {
+	mask := uint64(len(b.ring) - 1)
+	j := b.ring[seq&mask]
+	b.ring[seq&mask] = nil
+	if b.index[j.ID] == seq {
+		delete(b.index, j.ID)
+	}
+	b.live--
+	for b.head != b.tail && b.ring[b.head&mask] == nil {
+		b.head++
+	}
+	for b.tail != b.head && b.ring[(b.tail-1)&mask] == nil {
+		b.tail--
+	}
+	if len(b.ring) > minRing && b.live < len(b.ring)/4 {
+		b.resize(len(b.ring) / 2)
+	}
+	return j
+}
+
+// resize copies the live jobs, in order and without gaps, into a new ring of the given size.
+func (b *jobRing) resize(size int) {
+	ring := make([]*Job, size)
+	seq := b.head
+	for old := b.head; old != b.tail; old++ {
+		if j := b.slot(old); j != nil {
+			ring[seq&uint64(size-1)] = j
+			b.index[j.ID] = seq
+			seq++
+		}
+	}
+	b.ring, b.tail = ring, seq
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/adarsh/woc1/queue_algo/03_segment_tree/pkg/manager"
 	"github.com/adarsh/woc1/queue_algo/03_segment_tree/pkg/model"
@@ -37,5 +39,157 @@ func main() {
 	// Let's assume a fresh match round
 	disp.Match()
 
+	// Jobs leave again: completing or failing one frees its memory and repacks the worker.
+	fmt.Println("\n--- Completion & Failure ---")
+	disp.CompleteJob("GiantWorker", "Heavy_1")
+	disp.FailJob("GiantWorker", "Heavy_2")
+	fmt.Println("unknown job:", disp.CompleteJob("GiantWorker", "Heavy_1"))
+
+	// 3. Steady state with runtimes
+	// 100-1500MB jobs at ~0.7/s, a little faster than the workers serve them (~0.6/s),
+	// so the queue never runs dry; every 10s a running job fails and is retried.
+	fmt.Println("\n--- Phase 3: Steady-State Simulation (4 x 4000MB workers, 10 min) ---")
+	res := simulate(manager.HeaviestFirst, []int{4000, 4000, 4000, 4000}, 0.7, uniformJob, 10)
+	fmt.Printf("submitted %d, completed %d, dropped after retries %d, still queued %d\n",
+		res.Submitted, res.Completed, res.Dropped, res.Queued)
+	fmt.Printf("steady-state packing efficiency %.1f%%\n", 100*res.Efficiency)
+
+	// Job-driven: one job goes straight to the worker it fits most tightly.
+	fmt.Println("\n--- PlaceJob (best-fitting worker via the WorkerTree) ---")
+	placeJobDemo()
+
+	// A worker about to go away only takes jobs that will be done before it does.
+	fmt.Println("\n--- Draining Worker (heaviest job that fits and finishes within 30s) ---")
+	drainDemo()
+
+	fmt.Println("\n--- Packing Strategies (same mixed workload, workers of 4000/2000/1000MB) ---")
+	strategyReport()
+
 	fmt.Println("\nExecution Complete.")
 }
+
+// simResult is what one simulated run measured, averaged per second after a one-minute warm-up.
+type simResult struct {
+	Submitted, Completed, Dropped, Queued int
+	Efficiency                            float64 // memory in use / total memory
+	WastedMB                              float64 // free memory while jobs were waiting
+	Fragmentation                         float64 // see Dispatcher.Fragmentation
+}
+
+// simulate runs 10 minutes on a simulated clock: each second a job from newJob arrives with
+// probability rate, finished jobs complete and free their memory, and the dispatcher packs.
+// With failEvery > 0 a random running job fails every failEvery seconds and is retried.
+// Arrivals use their own seeded generator, so every strategy sees the same job stream.
+func simulate(strategy manager.PackingStrategy, capacities []int, rate float64, newJob func(r *rand.Rand, id string) *model.Job, failEvery int) simResult {
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	disp := manager.NewDispatcher(4096)
+	disp.Silent = true
+	disp.Strategy = strategy
+	disp.Clock = func() time.Time { return clock }
+	for i, c := range capacities {
+		disp.AddWorker(&model.Worker{ID: fmt.Sprintf("W%d", i), CapacityMB: c})
+	}
+
+	arrivals, failures := rand.New(rand.NewSource(7)), rand.New(rand.NewSource(11))
+	var res simResult
+	samples, waiting := 0, 0
+	for sec := 0; sec < 600; sec++ {
+		clock = clock.Add(time.Second)
+		disp.CompleteFinishedJobs()
+		if arrivals.Float64() < rate {
+			disp.AddJob(newJob(arrivals, fmt.Sprintf("J%d", res.Submitted)))
+			res.Submitted++
+		}
+		if failEvery > 0 && sec%failEvery == failEvery-1 {
+			w := disp.Workers[failures.Intn(len(disp.Workers))]
+			if len(w.CurrentJobs) > 0 {
+				disp.FailJob(w.ID, w.CurrentJobs[failures.Intn(len(w.CurrentJobs))].ID)
+			}
+		}
+		disp.Match()
+		if sec < 60 {
+			continue
+		}
+		samples++
+		res.Efficiency += disp.PackingEfficiency()
+		res.Fragmentation += disp.Fragmentation()
+		if disp.Tree.Len() > 0 {
+			waiting++
+			res.WastedMB += float64(disp.FreeMemory())
+		}
+	}
+	res.Efficiency /= float64(samples)
+	res.Fragmentation /= float64(samples)
+	if waiting > 0 {
+		res.WastedMB /= float64(waiting)
+	}
+	res.Completed, res.Dropped, res.Queued = disp.Completed, len(disp.Failed), disp.Tree.Len()
+	return res
+}
+
+// uniformJob is 100-1500MB running 5-60s.
+func uniformJob(r *rand.Rand, id string) *model.Job {
+	return &model.Job{ID: id, SizeMB: 100 + r.Intn(1401), Duration: time.Duration(5+r.Intn(56)) * time.Second}
+}
+
+// mixedJob is 70% small (50-600MB) and 30% heavy (800-2500MB), running 5-60s.
+func mixedJob(r *rand.Rand, id string) *model.Job {
+	size := 50 + r.Intn(551)
+	if r.Intn(10) < 3 {
+		size = 800 + r.Intn(1701)
+	}
+	return &model.Job{ID: id, SizeMB: size, Duration: time.Duration(5+r.Intn(56)) * time.Second}
+}
+
+// strategyReport runs every packing strategy on the same mixed workload and worker fleet.
+func strategyReport() {
+	fleet := []int{4000, 4000, 2000, 2000, 1000, 1000}
+	fmt.Printf("  %-15s %10s %10s %10s %10s %7s\n", "strategy", "efficiency", "wasted MB", "fragment.", "completed", "queued")
+	for _, s := range []manager.PackingStrategy{manager.HeaviestFirst, manager.FirstFit, manager.BestFit,
+		manager.WorstFit, manager.NextFit, manager.Lookahead} {
+		res := simulate(s, fleet, 0.6, mixedJob, 0)
+		fmt.Printf("  %-15s %9.1f%% %10.0f %10.2f %10d %7d\n", s, 100*res.Efficiency, res.WastedMB, res.Fragmentation, res.Completed, res.Queued)
+	}
+}
+
+// placeJobDemo sends single jobs to workers with 500, 1300, 2000 and 4000MB free:
+// each goes to the one it leaves the least memory on.
+func placeJobDemo() {
+	disp := manager.NewDispatcher(4096)
+	disp.Silent = true
+	for i, free := range []int{500, 1300, 2000, 4000} {
+		disp.AddWorker(&model.Worker{ID: fmt.Sprintf("Free%d", free), CapacityMB: 4000 + 100*i, UsedMemory: 4000 + 100*i - free})
+	}
+	for _, size := range []int{1200, 1200, 450, 5000} {
+		job := &model.Job{ID: fmt.Sprintf("Job_%dMB", size), SizeMB: size}
+		if w, _ := disp.PlaceJob(job); w != nil {
+			fmt.Printf("%s -> %s (%dMB left)\n", job.ID, w.ID, w.AvailableMemory())
+		} else {
+			fmt.Printf("%s -> queued, no worker has room\n", job.ID)
+		}
+	}
+}
+
+// drainDemo drains a 1000MB worker 30s from now and shows which queued jobs it still takes:
+// the 900MB job would run for 2 minutes and the 100MB one has no known duration.
+func drainDemo() {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	disp := manager.NewDispatcher(4096)
+	disp.Clock = func() time.Time { return now }
+	disp.AddWorker(&model.Worker{ID: "Leaving", CapacityMB: 1000})
+	disp.DrainWorker("Leaving", now.Add(30*time.Second))
+
+	disp.Silent = true
+	for _, j := range []*model.Job{
+		{ID: "Long_900", SizeMB: 900, Duration: 2 * time.Minute},
+		{ID: "Quick_800", SizeMB: 800, Duration: 20 * time.Second},
+		{ID: "Quick_300", SizeMB: 300, Duration: 10 * time.Second},
+		{ID: "Edge_150", SizeMB: 150, Duration: 25 * time.Second},
+		{ID: "Unknown_100", SizeMB: 100},
+	} {
+		disp.AddJob(j)
+	}
+	disp.Silent = false
+	disp.Match()
+	fmt.Printf("still queued: %d jobs (Long_900, Unknown_100, and Quick_300 which no longer fits)\n", disp.Tree.Len())
+}
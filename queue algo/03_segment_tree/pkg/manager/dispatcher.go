@@ -1,7 +1,9 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/adarsh/woc1/queue_algo/03_segment_tree/pkg/model"
 )
@@ -9,28 +11,107 @@ import (
 const (
 	AvalancheThreshold = 3
 	JobLargeThreshold  = 800
+	// DefaultMaxAttempts is how many times a job may fail before it is dropped instead of requeued.
+	DefaultMaxAttempts = 3
+)
+
+var (
+	ErrUnknownWorker   = errors.New("unknown worker")
+	ErrNotRunning      = errors.New("worker is not running this job")
+	ErrInvalidSize     = errors.New("job size must not be negative")
+	ErrDuplicateWorker = errors.New("a worker with this ID is already registered")
 )
 
 type Dispatcher struct {
 	Tree            *model.SegmentTree
 	Workers         []*model.Worker
 	AvalancheActive bool
+	// WorkerTree indexes the open Workers by available memory for best-fit lookups (BestWorker,
+	// PlaceJob): the ones that take any job that fits. Reserved and draining workers, which only
+	// take some jobs, are kept apart in held so they never slow down a lookup that skips them.
+	// The Dispatcher keeps both in sync; change UsedMemory only through it.
+	WorkerTree *model.WorkerTree
+	held       *model.WorkerTree
+
+	// MaxAttempts: a job that fails this many times goes to Failed instead of back in the tree.
+	// 0 means DefaultMaxAttempts.
+	MaxAttempts int
+	Failed      []*model.Job
+	Completed   int
+
+	// Strategy picks how jobs are packed onto workers (see PackingStrategy).
+	Strategy    PackingStrategy
+	LookaheadMB int
+	nextFit     int // NextFit's current worker
+
+	// Clock stamps Job.StartedAt. nil means time.Now.
+	// Simulations inject a fake clock to run jobs for their Duration without sleeping.
+	Clock func() time.Time
+	// Silent turns off the per-job console logging (useful for large simulations).
+	Silent bool
+
+	workerByID map[string]*model.Worker
+	drainBy    map[*model.Worker]time.Time // draining workers and when they go away
 }
 
 func NewDispatcher(maxMem int) *Dispatcher {
 	return &Dispatcher{
-		Tree:    model.NewSegmentTree(maxMem),
-		Workers: make([]*model.Worker, 0),
+		Tree:        model.NewSegmentTree(maxMem),
+		Workers:     make([]*model.Worker, 0),
+		WorkerTree:  model.NewWorkerTree(),
+		held:        model.NewWorkerTree(),
+		MaxAttempts: DefaultMaxAttempts,
+		LookaheadMB: DefaultLookaheadMB,
+		workerByID:  make(map[string]*model.Worker),
+		drainBy:     make(map[*model.Worker]time.Time),
 	}
 }
 
-func (d *Dispatcher) AddJob(j *model.Job) {
-	d.Tree.AddJob(j)
-	fmt.Printf("[Dispatcher] Job Added: %s\n", j)
+func (d *Dispatcher) logf(format string, args ...interface{}) {
+	if !d.Silent {
+		fmt.Printf(format, args...)
+	}
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Clock == nil {
+		return time.Now()
+	}
+	return d.Clock()
 }
 
-func (d *Dispatcher) AddWorker(w *model.Worker) {
+// AddJob queues j. It fails if j's size is negative or a job with its ID is already queued
+// (model.ErrDuplicateJob).
+func (d *Dispatcher) AddJob(j *model.Job) error {
+	if err := checkSize(j); err != nil {
+		return err
+	}
+	if err := d.Tree.AddJob(j); err != nil {
+		return err
+	}
+	d.logf("[Dispatcher] Job Added: %s\n", j)
+	return nil
+}
+
+// checkSize rejects negative sizes: nothing downstream (buckets, the subset-sum table in
+// fillExactly) is defined for them.
+func checkSize(j *model.Job) error {
+	if j.SizeMB < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidSize, j)
+	}
+	return nil
+}
+
+// AddWorker registers w. Worker IDs must be unique (and so a worker can't be added twice):
+// CompleteJob and friends look workers up by ID, and the worker trees file each worker once.
+func (d *Dispatcher) AddWorker(w *model.Worker) error {
+	if _, ok := d.workerByID[w.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateWorker, w.ID)
+	}
 	d.Workers = append(d.Workers, w)
+	d.workerByID[w.ID] = w
+	d.refile(w)
+	return nil
 }
 
 func (d *Dispatcher) CheckAvalancheStatus() {
@@ -39,13 +120,15 @@ func (d *Dispatcher) CheckAvalancheStatus() {
 
 	if heavyCount >= AvalancheThreshold {
 		if !d.AvalancheActive {
-			fmt.Println("\n!!! AVALANCHE DETECTED !!! Tree switching to Reservation Mode.")
+			d.logf("\n!!! AVALANCHE DETECTED !!! Tree switching to Reservation Mode.\n")
 			d.AvalancheActive = true
+			d.refileAll()
 		}
 	} else {
 		if d.AvalancheActive {
-			fmt.Println("\n... Avalanche cleared. Returning to normal tree search.")
+			d.logf("\n... Avalanche cleared. Returning to normal tree search.\n")
 			d.AvalancheActive = false
+			d.refileAll()
 		}
 	}
 }
@@ -53,34 +136,201 @@ func (d *Dispatcher) CheckAvalancheStatus() {
 func (d *Dispatcher) Match() {
 	d.CheckAvalancheStatus()
 
+	if d.jobDriven() {
+		d.placeJobs()
+		return
+	}
 	for _, w := range d.Workers {
-		// Keep trying to fill the worker until no more jobs fit or memory is full
-		for {
-			avail := w.AvailableMemory()
-			if avail <= 0 {
-				break
-			}
+		d.pack(w)
+	}
+}
 
-			minSize := 0
-			// If Avalanche is active and this worker is a "Heavy" resource,
-			// we reserve its FIRST slot for a heavy job.
-			// Once it has at least one heavy job (or if avalanche is off),
-			// it can fill its remaining space with anything.
-			if d.AvalancheActive && w.CapacityMB >= JobLargeThreshold && len(w.CurrentJobs) == 0 {
-				minSize = JobLargeThreshold
-			}
+// jobDriven reports whether the strategy picks a worker per job rather than jobs per worker.
+func (d *Dispatcher) jobDriven() bool {
+	return d.Strategy != HeaviestFirst && d.Strategy != Lookahead
+}
+
+// repack refills after w freed memory: w alone for worker-driven strategies,
+// every worker for job-driven ones (the strategy may prefer another worker).
+func (d *Dispatcher) repack(w *model.Worker) {
+	d.CheckAvalancheStatus()
+	if d.jobDriven() {
+		d.placeJobs()
+	} else {
+		d.pack(w)
+	}
+}
 
-			// Optimized O(log B) search
-			job := d.Tree.FindHeaviest(avail, minSize)
+// pack fills w's free memory with the heaviest jobs that fit.
+func (d *Dispatcher) pack(w *model.Worker) {
+	// Keep trying to fill the worker until no more jobs fit or memory is full
+	for {
+		avail := w.AvailableMemory()
+		if avail <= 0 {
+			break
+		}
+		if d.Strategy == Lookahead && avail <= d.LookaheadMB && !d.reserved(w) && !d.draining(w) {
+			d.fillExactly(w)
+			break
+		}
+
+		minSize := 0
+		// If Avalanche is active and this worker is a "Heavy" resource,
+		// we reserve its FIRST slot for a heavy job.
+		// Once it has at least one heavy job (or if avalanche is off),
+		// it can fill its remaining space with anything.
+		if d.reserved(w) {
+			minSize = JobLargeThreshold
+		}
 
-			if job != nil {
-				w.UsedMemory += job.SizeMB
-				w.CurrentJobs = append(w.CurrentJobs, job)
-				fmt.Printf("[BIN-PACKING] Worker %s -> Added %s (Remaining: %dMB)\n", w.ID, job, w.AvailableMemory())
-			} else {
-				// No more jobs fit in this worker's remaining space
-				break
+		// Optimized O(log B) search; a draining worker also filters on duration
+		var job *model.Job
+		if window, ok := d.drainWindow(w); ok {
+			job = d.Tree.FindHeaviestWithin(avail, minSize, window)
+		} else {
+			job = d.Tree.FindHeaviest(avail, minSize)
+		}
+
+		if job != nil {
+			d.assign(w, job)
+		} else {
+			// No more jobs fit in this worker's remaining space
+			break
+		}
+	}
+}
+
+// assign puts job (already out of the tree) on w.
+func (d *Dispatcher) assign(w *model.Worker, job *model.Job) {
+	w.UsedMemory += job.SizeMB
+	w.CurrentJobs = append(w.CurrentJobs, job)
+	d.refile(w)
+	job.StartedAt = d.now()
+	d.logf("[BIN-PACKING] Worker %s -> Added %s (Remaining: %dMB)\n", w.ID, job, w.AvailableMemory())
+}
+
+// take removes jobID from workerID, freeing its memory.
+func (d *Dispatcher) take(workerID, jobID string) (*model.Worker, *model.Job, error) {
+	w, ok := d.workerByID[workerID]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownWorker, workerID)
+	}
+	j, ok := w.Remove(jobID)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %s on %s", ErrNotRunning, jobID, workerID)
+	}
+	d.refile(w)
+	return w, j, nil
+}
+
+// CompleteJob is called when a job finishes: its memory is freed and the worker is
+// packed again straight away.
+func (d *Dispatcher) CompleteJob(workerID, jobID string) error {
+	w, j, err := d.take(workerID, jobID)
+	if err != nil {
+		return err
+	}
+	d.Completed++
+	d.logf("[DONE] Worker %s finished %s (Remaining: %dMB)\n", w.ID, j, w.AvailableMemory())
+	d.repack(w)
+	return nil
+}
+
+// FailJob is called when a job crashes or its worker gives it up: its memory is freed, the job
+// goes back in the tree (or to Failed after MaxAttempts tries) and the worker is packed again.
+// If a job with the same ID was queued while this one ran, the queued one is kept: this one
+// goes to Failed and FailJob returns model.ErrDuplicateJob.
+func (d *Dispatcher) FailJob(workerID, jobID string) error {
+	w, j, err := d.take(workerID, jobID)
+	if err != nil {
+		return err
+	}
+	j.Attempts++
+	j.StartedAt = time.Time{}
+	if j.Attempts >= d.maxAttempts() {
+		d.Failed = append(d.Failed, j)
+		d.logf("[FAILED] Worker %s dropped %s after %d attempts\n", w.ID, j, j.Attempts)
+	} else if err = d.Tree.AddJob(j); err != nil {
+		d.Failed = append(d.Failed, j)
+		d.logf("[FAILED] Worker %s dropped %s, its ID is queued again\n", w.ID, j)
+	} else {
+		d.logf("[RETRY] Worker %s failed %s, requeued (attempt %d)\n", w.ID, j, j.Attempts)
+	}
+	d.repack(w)
+	return err
+}
+
+// maxAttempts is MaxAttempts, or DefaultMaxAttempts if it was never set.
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+	return d.MaxAttempts
+}
+
+// CompleteFinishedJobs completes every job whose Duration has elapsed on the clock,
+// then packs each worker that freed memory. It returns how many jobs finished.
+// Jobs without a Duration are left alone: only CompleteJob knows when they are done.
+func (d *Dispatcher) CompleteFinishedJobs() int {
+	now := d.now()
+	done := 0
+	for _, w := range d.Workers {
+		freed := false
+		for i := 0; i < len(w.CurrentJobs); {
+			j := w.CurrentJobs[i]
+			if j.Duration <= 0 || j.StartedAt.Add(j.Duration).After(now) {
+				i++
+				continue
 			}
+			w.Remove(j.ID)
+			d.Completed++
+			done++
+			freed = true
+			d.logf("[DONE] Worker %s finished %s\n", w.ID, j)
+		}
+		if freed {
+			d.refile(w)
+			d.repack(w)
+		}
+	}
+	return done
+}
+
+// PackingEfficiency is the fraction of all worker memory currently in use.
+func (d *Dispatcher) PackingEfficiency() float64 {
+	used, capacity := 0, 0
+	for _, w := range d.Workers {
+		used += w.UsedMemory
+		capacity += w.CapacityMB
+	}
+	if capacity == 0 {
+		return 0
+	}
+	return float64(used) / float64(capacity)
+}
+
+// FreeMemory is the total free memory over all workers.
+func (d *Dispatcher) FreeMemory() int {
+	free := 0
+	for _, w := range d.Workers {
+		free += w.AvailableMemory()
+	}
+	return free
+}
+
+// Fragmentation is 1 - largest free block / total free memory: 0 when all free memory is on
+// one worker (any job up to that size can still run), close to 1 when it is scattered in
+// slivers too small for most jobs. 0 when nothing is free.
+func (d *Dispatcher) Fragmentation() float64 {
+	free, largest := 0, 0
+	for _, w := range d.Workers {
+		free += w.AvailableMemory()
+		if w.AvailableMemory() > largest {
+			largest = w.AvailableMemory()
 		}
 	}
+	if free == 0 {
+		return 0
+	}
+	return 1 - float64(largest)/float64(free)
 }
@@ -0,0 +1,118 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adarsh/woc1/queue_algo/03_segment_tree/pkg/model"
+)
+
+// During an avalanche the empty heavy-capable workers are reserved: they must sit in the held
+// tree, so a small job's lookup goes straight to an open worker, and come back once it clears.
+func TestReservedWorkersHeldApart(t *testing.T) {
+	d := NewDispatcher(4096)
+	d.Silent = true
+	for i := 0; i < 100; i++ {
+		d.AddWorker(&model.Worker{ID: fmt.Sprintf("Big%d", i), CapacityMB: 4000})
+	}
+	d.AddWorker(&model.Worker{ID: "Small", CapacityMB: 500})
+	var heavy []*model.Job
+	for i := 0; i < AvalancheThreshold; i++ {
+		j := &model.Job{ID: fmt.Sprintf("Heavy%d", i), SizeMB: 5000} // fits nobody, stays queued
+		d.AddJob(j)
+		heavy = append(heavy, j)
+	}
+	d.CheckAvalancheStatus()
+	if !d.AvalancheActive {
+		t.Fatal("avalanche not detected")
+	}
+	if d.WorkerTree.Len() != 1 || d.held.Len() != 100 {
+		t.Fatalf("open %d / held %d workers, want 1 / 100", d.WorkerTree.Len(), d.held.Len())
+	}
+	if w := d.BestWorker(&model.Job{ID: "tiny", SizeMB: 100}); w == nil || w.ID != "Small" {
+		t.Fatalf("small job went to %v, want Small", w)
+	}
+	if w := d.BestWorker(&model.Job{ID: "big", SizeMB: 900}); w == nil || w.CapacityMB != 4000 {
+		t.Fatalf("heavy job went to %v, want a reserved worker", w)
+	}
+
+	for _, j := range heavy {
+		d.Tree.Remove(j)
+	}
+	d.CheckAvalancheStatus()
+	if d.WorkerTree.Len() != 101 || d.held.Len() != 0 {
+		t.Fatalf("after the avalanche: open %d / held %d workers, want 101 / 0", d.WorkerTree.Len(), d.held.Len())
+	}
+}
+
+func TestNegativeSizeRejected(t *testing.T) {
+	d := NewDispatcher(4096)
+	d.Silent = true
+	d.Strategy = Lookahead
+	d.AddWorker(&model.Worker{ID: "W", CapacityMB: 1000})
+	bad := &model.Job{ID: "bad", SizeMB: -100}
+	if err := d.AddJob(bad); !errors.Is(err, ErrInvalidSize) {
+		t.Fatalf("AddJob: %v, want ErrInvalidSize", err)
+	}
+	if w, err := d.PlaceJob(bad); w != nil || !errors.Is(err, ErrInvalidSize) {
+		t.Fatalf("PlaceJob: %v, %v, want nil, ErrInvalidSize", w, err)
+	}
+	if d.Tree.Len() != 0 {
+		t.Fatalf("%d jobs queued, want 0", d.Tree.Len())
+	}
+	d.Match() // fillExactly must not see the job
+}
+
+func TestDuplicateWorkerRejected(t *testing.T) {
+	d := NewDispatcher(4096)
+	w := &model.Worker{ID: "W", CapacityMB: 1000}
+	if err := d.AddWorker(w); err != nil {
+		t.Fatal(err)
+	}
+	for _, again := range []*model.Worker{w, {ID: "W", CapacityMB: 2000}} {
+		if err := d.AddWorker(again); !errors.Is(err, ErrDuplicateWorker) {
+			t.Fatalf("AddWorker(%v): %v, want ErrDuplicateWorker", again, err)
+		}
+	}
+	if len(d.Workers) != 1 || d.WorkerTree.Len() != 1 {
+		t.Fatalf("%d workers, %d in the tree, want 1 and 1", len(d.Workers), d.WorkerTree.Len())
+	}
+}
+
+// A queued job's ID can't be queued twice, by AddJob, PlaceJob or a failed job's requeue.
+// Once the job is running its ID is free again.
+func TestDuplicateJobRejected(t *testing.T) {
+	d := NewDispatcher(4096)
+	d.Silent = true
+	first := &model.Job{ID: "J", SizeMB: 500}
+	if err := d.AddJob(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddJob(&model.Job{ID: "J", SizeMB: 900}); !errors.Is(err, model.ErrDuplicateJob) {
+		t.Fatalf("second AddJob: %v, want ErrDuplicateJob", err)
+	}
+	if w, err := d.PlaceJob(&model.Job{ID: "J", SizeMB: 100}); w != nil || !errors.Is(err, model.ErrDuplicateJob) {
+		t.Fatalf("PlaceJob: %v, %v, want nil, ErrDuplicateJob", w, err)
+	}
+	if d.Tree.Len() != 1 {
+		t.Fatalf("%d jobs queued, want 1", d.Tree.Len())
+	}
+
+	d.AddWorker(&model.Worker{ID: "W", CapacityMB: 1000})
+	d.Match()
+	second := &model.Job{ID: "J", SizeMB: 600} // too big to share W with the first
+	if err := d.AddJob(second); err != nil {
+		t.Fatalf("AddJob while J runs: %v", err)
+	}
+	if err := d.FailJob("W", "J"); !errors.Is(err, model.ErrDuplicateJob) {
+		t.Fatalf("FailJob: %v, want ErrDuplicateJob", err)
+	}
+	if len(d.Failed) != 1 || d.Failed[0] != first {
+		t.Fatalf("Failed = %v, want the first J", d.Failed)
+	}
+	w := d.workerByID["W"]
+	if len(w.CurrentJobs) != 1 || w.CurrentJobs[0] != second || d.Tree.Len() != 0 {
+		t.Fatalf("W runs %v with %d queued, want the second J and nothing queued", w.CurrentJobs, d.Tree.Len())
+	}
+}
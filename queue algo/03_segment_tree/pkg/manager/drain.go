@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adarsh/woc1/queue_algo/03_segment_tree/pkg/model"
+)
+
+// DrainWorker marks a worker as going away at deadline: from now on it only takes jobs with a
+// known Duration that will finish by then (the heaviest such job, via the tree's memory x
+// duration index), so its last minutes are not wasted and nothing has to be killed.
+// A zero deadline ends the drain.
+func (d *Dispatcher) DrainWorker(workerID string, deadline time.Time) error {
+	w, ok := d.workerByID[workerID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownWorker, workerID)
+	}
+	if deadline.IsZero() {
+		delete(d.drainBy, w)
+		d.refile(w)
+		d.logf("[DRAIN] Worker %s no longer draining\n", w.ID)
+		return nil
+	}
+	d.drainBy[w] = deadline
+	d.refile(w)
+	d.logf("[DRAIN] Worker %s draining, only jobs done within %s\n", w.ID, deadline.Sub(d.now()))
+	return nil
+}
+
+// drainWindow reports whether w is draining and, if so, how long a job it may still start.
+func (d *Dispatcher) drainWindow(w *model.Worker) (time.Duration, bool) {
+	deadline, ok := d.drainBy[w]
+	if !ok {
+		return 0, false
+	}
+	return deadline.Sub(d.now()), true
+}
+
+func (d *Dispatcher) draining(w *model.Worker) bool {
+	_, ok := d.drainBy[w]
+	return ok
+}
+
+// finishesInTime reports whether job may start on w: always for a normal worker, and for a
+// draining one only if the job is known to be done by the deadline.
+func (d *Dispatcher) finishesInTime(w *model.Worker, job *model.Job) bool {
+	window, ok := d.drainWindow(w)
+	return !ok || (job.Duration > 0 && job.Duration <= window)
+}
@@ -0,0 +1,234 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/adarsh/woc1/queue_algo/03_segment_tree/pkg/model"
+)
+
+// PackingStrategy decides which jobs go on which workers.
+//
+// HeaviestFirst and Lookahead are worker-driven: each worker in turn is filled from the tree.
+// The classic fits are job-driven: the tree hands out jobs largest first (only ever one that
+// fits somewhere, found in O(log B)) and the strategy picks the worker for each.
+type PackingStrategy int
+
+const (
+	// HeaviestFirst is the original behaviour: each worker, in insertion order, repeatedly
+	// takes the heaviest job that fits its free memory.
+	HeaviestFirst PackingStrategy = iota
+	// FirstFit puts each job on the first worker (insertion order) with room for it.
+	FirstFit
+	// BestFit puts each job on the worker it leaves the least free memory on.
+	BestFit
+	// WorstFit puts each job on the worker with the most free memory, spreading the load.
+	WorstFit
+	// NextFit keeps filling one worker and moves on (round-robin) when a job does not fit it.
+	NextFit
+	// Lookahead takes heaviest jobs while a worker has more than LookaheadMB free, then fills
+	// the rest as exactly as possible with a subset-sum over the small buckets.
+	Lookahead
+)
+
+func (s PackingStrategy) String() string {
+	switch s {
+	case HeaviestFirst:
+		return "heaviest-first"
+	case FirstFit:
+		return "first-fit"
+	case BestFit:
+		return "best-fit"
+	case WorstFit:
+		return "worst-fit"
+	case NextFit:
+		return "next-fit"
+	case Lookahead:
+		return "lookahead"
+	}
+	return fmt.Sprintf("PackingStrategy(%d)", int(s))
+}
+
+const (
+	// DefaultLookaheadMB is the free memory below which Lookahead switches to exact filling.
+	DefaultLookaheadMB = 1024
+	// lookaheadPerBucket caps the subset-sum candidates taken from each small bucket.
+	lookaheadPerBucket = 4
+)
+
+// reserved reports whether w must take a heavy job before anything else:
+// during an avalanche an empty heavy-capable worker keeps its first slot for one.
+func (d *Dispatcher) reserved(w *model.Worker) bool {
+	return d.AvalancheActive && w.CapacityMB >= JobLargeThreshold && len(w.CurrentJobs) == 0
+}
+
+// refile keeps w in the right worker tree, under its current free memory: held if it is
+// reserved or draining, WorkerTree otherwise.
+func (d *Dispatcher) refile(w *model.Worker) {
+	from, to := d.held, d.WorkerTree
+	if d.reserved(w) || d.draining(w) {
+		from, to = to, from
+	}
+	from.Remove(w)
+	to.Update(w)
+}
+
+// refileAll refiles every worker, after the avalanche flag (and so who is reserved) changed.
+func (d *Dispatcher) refileAll() {
+	for _, w := range d.Workers {
+		d.refile(w)
+	}
+}
+
+// bestFit returns the worker with the least free memory that accepts job, or nil. Open workers
+// take any job that fits, so that is one O(log W) search; only held workers are checked one by one.
+func (d *Dispatcher) bestFit(job *model.Job) *model.Worker {
+	w := d.WorkerTree.BestFit(job.SizeMB, nil)
+	h := d.held.BestFit(job.SizeMB, func(h *model.Worker) bool { return d.accepts(h, job) })
+	if h != nil && (w == nil || h.AvailableMemory() < w.AvailableMemory()) {
+		return h
+	}
+	return w
+}
+
+// largest returns the worker with the most free memory, among the open workers and the held
+// ones heldOK accepts, or nil.
+func (d *Dispatcher) largest(heldOK func(*model.Worker) bool) *model.Worker {
+	w := d.WorkerTree.Largest(nil)
+	h := d.held.Largest(heldOK)
+	if h != nil && (w == nil || h.AvailableMemory() > w.AvailableMemory()) {
+		return h
+	}
+	return w
+}
+
+// placeJobs runs the job-driven strategies over all workers until no queued job fits anywhere.
+// During an avalanche heavy jobs go first, so reserved workers can get theirs before small
+// jobs are placed on the other workers. Draining workers are then filled with what finishes
+// in time.
+func (d *Dispatcher) placeJobs() {
+	if d.AvalancheActive {
+		d.placeFrom(JobLargeThreshold)
+	}
+	d.placeFrom(0)
+	for _, w := range d.Workers {
+		if d.draining(w) {
+			d.pack(w)
+		}
+	}
+}
+
+// placeFrom places jobs of at least minSize, largest first. Each one is no bigger than the
+// most free memory of a worker allowed to take it, so the strategy always finds a worker.
+// Draining workers are left out here since they cannot take just any job.
+func (d *Dispatcher) placeFrom(minSize int) {
+	heldOK := func(w *model.Worker) bool { return minSize >= JobLargeThreshold && !d.draining(w) }
+	for {
+		largest := d.largest(heldOK)
+		if largest == nil {
+			return
+		}
+		job := d.Tree.FindHeaviest(largest.AvailableMemory(), minSize)
+		if job == nil {
+			return
+		}
+		d.assign(d.chooseWorker(job), job)
+	}
+}
+
+// accepts reports whether job may go on w right now.
+func (d *Dispatcher) accepts(w *model.Worker, job *model.Job) bool {
+	return job.SizeMB <= w.AvailableMemory() && (job.SizeMB >= JobLargeThreshold || !d.reserved(w)) &&
+		d.finishesInTime(w, job)
+}
+
+// chooseWorker picks the worker for job under the job-driven strategy.
+func (d *Dispatcher) chooseWorker(job *model.Job) *model.Worker {
+	if d.Strategy == NextFit {
+		for k := 0; k < len(d.Workers); k++ {
+			w := d.Workers[(d.nextFit+k)%len(d.Workers)]
+			if d.accepts(w, job) {
+				d.nextFit = (d.nextFit + k) % len(d.Workers)
+				return w
+			}
+		}
+		return nil
+	}
+
+	ok := func(w *model.Worker) bool { return d.accepts(w, job) }
+	switch d.Strategy {
+	case BestFit:
+		return d.bestFit(job)
+	case WorstFit:
+		if w := d.largest(ok); w != nil && ok(w) {
+			return w
+		}
+		return nil
+	}
+	for _, w := range d.Workers { // FirstFit
+		if ok(w) {
+			return w
+		}
+	}
+	return nil
+}
+
+// BestWorker returns the worker with the least free memory that can take job, or nil.
+// During an avalanche an empty heavy-capable worker only qualifies for a heavy job, and a
+// draining worker only for one that finishes in time. It costs O(log W) for W open workers,
+// plus a check of each reserved or draining worker passed over.
+func (d *Dispatcher) BestWorker(job *model.Job) *model.Worker {
+	return d.bestFit(job)
+}
+
+// PlaceJob places a single job directly on its best-fitting worker and returns that worker.
+// If no worker can take it, the job is queued in the job tree and PlaceJob returns nil.
+// Like AddJob, it turns away a job whose ID is already queued.
+func (d *Dispatcher) PlaceJob(job *model.Job) (*model.Worker, error) {
+	if err := checkSize(job); err != nil {
+		return nil, err
+	}
+	if d.Tree.Contains(job.ID) {
+		return nil, fmt.Errorf("%w: %s", model.ErrDuplicateJob, job.ID)
+	}
+	w := d.BestWorker(job)
+	if w == nil {
+		return nil, d.AddJob(job)
+	}
+	d.assign(w, job)
+	return w, nil
+}
+
+// fillExactly packs w's remaining free memory with the subset of small queued jobs that
+// comes closest to filling it. The candidates are the oldest few jobs of each bucket that
+// fits, and the subset-sum table has one entry per MB of free memory.
+func (d *Dispatcher) fillExactly(w *model.Worker) {
+	free := w.AvailableMemory()
+	if free <= 0 || d.reserved(w) {
+		return
+	}
+	items := d.Tree.Candidates(free, lookaheadPerBucket)
+	if len(items) == 0 {
+		return
+	}
+
+	// from[s] = index+1 of the last item used to reach sum s (0 = unreachable, s = 0 is the base).
+	from := make([]int, free+1)
+	from[0] = -1
+	for k, j := range items {
+		for s := free; s >= j.SizeMB; s-- {
+			if from[s] == 0 && from[s-j.SizeMB] != 0 {
+				from[s] = k + 1
+			}
+		}
+	}
+	best := free
+	for from[best] == 0 {
+		best--
+	}
+	for s := best; s > 0; {
+		j := items[from[s]-1]
+		d.Tree.Remove(j)
+		d.assign(w, j)
+		s -= j.SizeMB
+	}
+}
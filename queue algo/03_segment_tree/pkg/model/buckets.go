@@ -1,24 +1,135 @@
 package model
 
+// JobBucket is the FIFO queue behind one BucketInterval-wide leaf of a SegmentTree.
+//
+// The tree pops from the front (FindHeaviest) and also pulls jobs out of the middle by ID
+// (Remove, FindHeaviestWithin), so the bucket is a power-of-two ring indexed by a running
+// sequence number, with an ID -> sequence map. A job pulled from the middle leaves a nil slot
+// behind; slots are reused as the ring turns, nil ones are squeezed out whenever it is
+// compacted, and it doubles when full and halves below a quarter full. That keeps every
+// operation O(1) amortized and the memory proportional to the queued jobs, however long the
+// tree runs. The zero value is an empty bucket.
 type JobBucket struct {
 	MinSize int
 	MaxSize int
-	Jobs    []*Job
+
+	ring  []*Job            // slot seq&(len-1) holds job number seq; nil = cancelled
+	head  uint64            // seq of the oldest slot (always live, unless empty)
+	tail  uint64            // seq the next Push gets
+	live  int               // jobs actually queued (tail-head minus cancelled slots)
+	index map[string]uint64 // job ID -> seq, for Remove
 }
 
+const minRing = 8
+
+func (b *JobBucket) slot(seq uint64) *Job { return b.ring[seq&uint64(len(b.ring)-1)] }
+
 func (b *JobBucket) Push(j *Job) {
-	b.Jobs = append(b.Jobs, j)
+	if b.ring == nil {
+		b.ring = make([]*Job, minRing)
+		b.index = make(map[string]uint64)
+	}
+	if int(b.tail-b.head) == len(b.ring) {
+		if b.live <= len(b.ring)/2 {
+			b.resize(len(b.ring)) // at least half the slots are cancelled: compacting is enough
+		} else {
+			b.resize(2 * len(b.ring))
+		}
+	}
+	b.ring[b.tail&uint64(len(b.ring)-1)] = j
+	b.index[j.ID] = b.tail
+	b.tail++
+	b.live++
 }
 
+// Pop removes and returns the oldest job (nil if the bucket is empty).
 func (b *JobBucket) Pop() *Job {
-	if len(b.Jobs) == 0 {
+	if b.live == 0 {
 		return nil
 	}
-	j := b.Jobs[0]
-	b.Jobs = b.Jobs[1:]
-	return j
+	return b.removeAt(b.head)
+}
+
+// Peek returns the oldest job without removing it (nil if the bucket is empty).
+func (b *JobBucket) Peek() *Job {
+	if b.live == 0 {
+		return nil
+	}
+	return b.slot(b.head)
+}
+
+// Remove cancels the queued job with the given ID, wherever it is in the queue.
+func (b *JobBucket) Remove(id string) (*Job, bool) {
+	seq, ok := b.index[id]
+	if !ok {
+		return nil, false
+	}
+	return b.removeAt(seq), true
+}
+
+// PopFirst removes the oldest job for which ok returns true.
+func (b *JobBucket) PopFirst(ok func(*Job) bool) *Job {
+	for seq := b.head; seq != b.tail; seq++ {
+		if j := b.slot(seq); j != nil && ok(j) {
+			return b.removeAt(seq)
+		}
+	}
+	return nil
+}
+
+// Each calls fn on the queued jobs, oldest first, until fn returns false.
+func (b *JobBucket) Each(fn func(*Job) bool) {
+	for seq := b.head; seq != b.tail; seq++ {
+		if j := b.slot(seq); j != nil && !fn(j) {
+			return
+		}
+	}
 }
 
 func (b *JobBucket) IsEmpty() bool {
-	return len(b.Jobs) == 0
+	return b.live == 0
+}
+
+func (b *JobBucket) Len() int {
+	return b.live
+}
+
+// Cap is the current ring size: the memory the bucket holds on to.
+func (b *JobBucket) Cap() int {
+	return len(b.ring)
+}
+
+// removeAt empties slot seq and keeps head and tail on live slots.
+func (b *JobBucket) removeAt(seq uint64) *Job {
+	mask := uint64(len(b.ring) - 1)
+	j := b.ring[seq&mask]
+	b.ring[seq&mask] = nil
+	if b.index[j.ID] == seq {
+		delete(b.index, j.ID)
+	}
+	b.live--
+	for b.head != b.tail && b.ring[b.head&mask] == nil {
+		b.head++
+	}
+	for b.tail != b.head && b.ring[(b.tail-1)&mask] == nil {
+		b.tail--
+	}
+	if len(b.ring) > minRing && b.live < len(b.ring)/4 {
+		b.resize(len(b.ring) / 2)
+	}
+	return j
+}
+
+// resize copies the live jobs, in order and without gaps, into a new ring of the given size.
+func (b *JobBucket) resize(size int) {
+	ring := make([]*Job, size)
+	seq := b.head
+	for old := b.head; old != b.tail; old++ {
+		if j := b.slot(old); j != nil {
+			ring[seq&uint64(size-1)] = j
+			b.index[j.ID] = seq
+			seq++
+		}
+	}
+	b.ring, b.tail = ring, seq
 }
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+)
+
+// drain pops b empty and returns the IDs in the order they came out.
+func drain(b *JobBucket) []string {
+	var ids []string
+	for j := b.Pop(); j != nil; j = b.Pop() {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
+
+// Remove cancels a job from the head, the middle or the tail of the ring and leaves the
+// others in order; the ID is free to be queued again afterwards.
+func TestJobBucketRemoveByID(t *testing.T) {
+	var b JobBucket
+	for _, id := range []string{"A", "B", "C", "D", "E"} {
+		b.Push(&Job{ID: id, SizeMB: 100})
+	}
+	for _, id := range []string{"C", "A", "E"} {
+		if j, ok := b.Remove(id); !ok || j.ID != id {
+			t.Fatalf("Remove(%s) = %v, %v", id, j, ok)
+		}
+	}
+	if _, ok := b.Remove("C"); ok {
+		t.Fatal("C removed twice")
+	}
+	if _, ok := b.Remove("X"); ok {
+		t.Fatal("removed X, which was never queued")
+	}
+	if b.Len() != 2 || b.Peek().ID != "B" {
+		t.Fatalf("Len %d, head %v; want 2, B", b.Len(), b.Peek())
+	}
+	b.Push(&Job{ID: "C", SizeMB: 100})
+	if got, want := drain(&b), []string{"B", "D", "C"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("pop order %v, want %v", got, want)
+	}
+	if !b.IsEmpty() {
+		t.Fatal("bucket not empty after draining")
+	}
+}
+
+// TestTreeChurnSoak runs a SegmentTree the way a long-lived dispatcher does: every cycle queues
+// a job of random size and cancels the one queued 1000 cycles earlier (if it is still there),
+// and every third cycle FindHeaviest takes a job for a random capacity. Across all buckets the
+// rings must stay proportional to the ~1000 queued jobs, and the heap must not grow between
+// the first million cycles and the last.
+func TestTreeChurnSoak(t *testing.T) {
+	if testing.Short() {
+		t.Skip("3M-cycle soak")
+	}
+	const (
+		cycles    = 3_000_000
+		window    = 1000
+		maxSize   = 4000
+		maxGrowth = 1 << 20 // heap bytes
+	)
+	st := NewSegmentTree(maxSize)
+	maxSlots := 4*window + len(st.Buckets)*minRing // a ring shrinks once under a quarter full
+	r := rand.New(rand.NewSource(1))
+	recent := make([]*Job, window)
+
+	slots := func() int {
+		n := 0
+		for i := range st.Buckets {
+			n += st.Buckets[i].Cap()
+		}
+		return n
+	}
+	heap := func() uint64 {
+		var ms runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&ms)
+		return ms.HeapAlloc
+	}
+	var base uint64
+	for i := 1; i <= cycles; i++ {
+		k := i % window
+		if old := recent[k]; old != nil {
+			st.Remove(old)
+		}
+		recent[k] = &Job{ID: strconv.Itoa(i), SizeMB: r.Intn(maxSize)}
+		st.AddJob(recent[k])
+		if i%3 == 0 {
+			st.FindHeaviest(r.Intn(maxSize), 0)
+		}
+		if i%window != 0 {
+			continue
+		}
+		if n := slots(); n > maxSlots {
+			t.Fatalf("cycle %d: %d ring slots for %d jobs", i, n, st.Len())
+		}
+		if i%1_000_000 != 0 {
+			continue
+		}
+		if err := st.Validate(); err != nil {
+			t.Fatalf("after %dM cycles: %v", i/1_000_000, err)
+		}
+		if h := heap(); base == 0 {
+			base = h
+		} else if h > base+maxGrowth {
+			t.Fatalf("after %dM cycles: heap %d bytes, %d more than after 1M", i/1_000_000, h, h-base)
+		}
+	}
+	if st.Len() > window {
+		t.Fatalf("%d jobs queued, want at most %d", st.Len(), window)
+	}
+}
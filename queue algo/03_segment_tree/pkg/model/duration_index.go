@@ -0,0 +1,174 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DurationInterval is the width of one duration cell in the memory x duration index.
+	DurationInterval = 5 * time.Second
+	// MaxIndexedDuration is the longest duration with cells of its own: longer jobs, and jobs
+	// with no Duration, share the last cell.
+	MaxIndexedDuration = 10 * time.Minute
+)
+
+// durationCells is the number of duration cells, the last one being "longer or unknown".
+const durationCells = int(MaxIndexedDuration/DurationInterval) + 1
+
+func cellOf(d time.Duration) int {
+	if d <= 0 || d >= MaxIndexedDuration {
+		return durationCells - 1
+	}
+	return int(d / DurationInterval)
+}
+
+// durationIndex is the 2D (size bucket x duration cell) view of the queued jobs behind
+// SegmentTree.FindHeaviestWithin: a segment tree over the size buckets in which every node is
+// a Fenwick tree of job counts per duration cell. "Does any job in buckets lo..hi run at most
+// c cells" is one Fenwick prefix per node, so the heaviest bucket with a short enough job is
+// found in O(log B * log D). Each (bucket, cell) pair has its own FIFO of jobs.
+type durationIndex struct {
+	size  int           // leaves: the number of buckets rounded up to a power of two
+	nodes []fenwick     // nodes[1] is the root, bucket i is leaf nodes[size+i]
+	cells [][]JobBucket // cells[bucket][cell], allocated the first time a bucket gets a job
+}
+
+func newDurationIndex(buckets int) *durationIndex {
+	size := 1
+	for size < buckets {
+		size <<= 1
+	}
+	ix := &durationIndex{size: size, nodes: make([]fenwick, 2*size), cells: make([][]JobBucket, buckets)}
+	for k := 1; k < len(ix.nodes); k++ {
+		ix.nodes[k] = newFenwick(durationCells)
+	}
+	return ix
+}
+
+// count updates every node on the path from bucket i's leaf to the root.
+func (ix *durationIndex) count(i, cell, delta int) {
+	for k := ix.size + i; k > 0; k >>= 1 {
+		ix.nodes[k].add(cell, delta)
+	}
+}
+
+func (ix *durationIndex) add(i int, j *Job) {
+	if ix.cells[i] == nil {
+		ix.cells[i] = make([]JobBucket, durationCells)
+	}
+	c := cellOf(j.Duration)
+	ix.cells[i][c].Push(j)
+	ix.count(i, c, 1)
+}
+
+func (ix *durationIndex) remove(i int, j *Job) {
+	c := cellOf(j.Duration)
+	if ix.cells[i] == nil {
+		return
+	}
+	if _, ok := ix.cells[i][c].Remove(j.ID); ok {
+		ix.count(i, c, -1)
+	}
+}
+
+// take removes and returns a job accepted by ok from the highest bucket in [lo, hi] that has
+// one in cells 0..maxCell, along with its bucket. Within a bucket the longest cell is tried
+// first and each cell is FIFO. ok must only reject jobs in the end buckets or in maxCell.
+func (ix *durationIndex) take(lo, hi, maxCell int, ok func(*Job) bool) (int, *Job) {
+	return ix.descend(1, 0, ix.size-1, lo, hi, maxCell, ok)
+}
+
+func (ix *durationIndex) descend(k, nodeLo, nodeHi, lo, hi, maxCell int, ok func(*Job) bool) (int, *Job) {
+	if nodeHi < lo || nodeLo > hi || ix.nodes[k].prefix(maxCell) == 0 {
+		return -1, nil
+	}
+	if k < ix.size {
+		mid := nodeLo + (nodeHi-nodeLo)/2
+		if i, j := ix.descend(2*k+1, mid+1, nodeHi, lo, hi, maxCell, ok); j != nil {
+			return i, j
+		}
+		return ix.descend(2*k, nodeLo, mid, lo, hi, maxCell, ok)
+	}
+
+	i := k - ix.size
+	leaf := &ix.nodes[k]
+	for c := leaf.last(0, maxCell); c >= 0; c = leaf.last(0, c-1) {
+		cell := &ix.cells[i][c]
+		j := cell.Peek()
+		if ok(j) {
+			cell.Pop()
+		} else if j = cell.PopFirst(ok); j == nil {
+			continue
+		}
+		ix.count(i, c, -1)
+		return i, j
+	}
+	return -1, nil
+}
+
+// validate checks the index against st: each bucket's cells hold exactly its jobs, each in the
+// cell of its Duration, and every node's count per cell is the sum of its children's.
+// Fenwick trees are linear in their counts, so the latter is a plain array comparison.
+func (ix *durationIndex) validate(st *SegmentTree) error {
+	for i := range st.Buckets {
+		inCells := 0
+		want := make([]int, durationCells+1) // the leaf's Fenwick array, built from the cell lengths
+		for c := range ix.cells[i] {
+			cell := &ix.cells[i][c]
+			var stray *Job
+			cell.Each(func(j *Job) bool {
+				if cellOf(j.Duration) != c || st.bucketOf(j.SizeMB) != i {
+					stray = j
+				}
+				return stray == nil
+			})
+			if stray != nil {
+				return fmt.Errorf("duration cell (%d, %d) holds %s", i, c, stray)
+			}
+			want[c+1] += cell.Len()
+			if up := c + 1 + (c+1)&-(c+1); up < len(want) {
+				want[up] += want[c+1]
+			}
+			inCells += cell.Len()
+		}
+		var missing *Job
+		st.Buckets[i].Each(func(j *Job) bool {
+			if ix.cells[i] == nil {
+				missing = j
+			} else if _, ok := ix.cells[i][cellOf(j.Duration)].index[j.ID]; !ok {
+				missing = j
+			}
+			return missing == nil
+		})
+		if missing != nil {
+			return fmt.Errorf("bucket %d job %s is not in the duration index", i, missing)
+		}
+		if inCells != st.Buckets[i].Len() {
+			return fmt.Errorf("bucket %d has %d jobs but %d in the duration index", i, st.Buckets[i].Len(), inCells)
+		}
+		leaf := &ix.nodes[ix.size+i]
+		if leaf.total != inCells {
+			return fmt.Errorf("bucket %d has %d jobs in the duration index but its leaf says %d", i, inCells, leaf.total)
+		}
+		for x := range want {
+			if leaf.tree[x] != want[x] {
+				return fmt.Errorf("bucket %d: leaf counts disagree with its duration cells", i)
+			}
+		}
+	}
+	for k := ix.size + len(st.Buckets); k < 2*ix.size; k++ {
+		if ix.nodes[k].total != 0 {
+			return fmt.Errorf("padding leaf %d counts %d jobs", k-ix.size, ix.nodes[k].total)
+		}
+	}
+	for k := ix.size - 1; k >= 1; k-- {
+		node, left, right := &ix.nodes[k], &ix.nodes[2*k], &ix.nodes[2*k+1]
+		for x := range node.tree {
+			if node.tree[x] != left.tree[x]+right.tree[x] {
+				return fmt.Errorf("duration node %d disagrees with its children", k)
+			}
+		}
+	}
+	return nil
+}
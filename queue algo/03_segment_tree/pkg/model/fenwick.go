@@ -0,0 +1,68 @@
+package model
+
+import "math/bits"
+
+// fenwick counts items in n slots (0..n-1) with O(log n) updates, prefix sums and
+// "which slot holds the k-th item" searches, all as loops over one []int.
+type fenwick struct {
+	tree  []int // 1-based: tree[i] sums the slots (i - lowbit(i), i]
+	total int
+}
+
+func newFenwick(n int) fenwick {
+	return fenwick{tree: make([]int, n+1)}
+}
+
+// add changes slot i's count by delta.
+func (f *fenwick) add(i, delta int) {
+	f.total += delta
+	for i++; i < len(f.tree); i += i & -i {
+		f.tree[i] += delta
+	}
+}
+
+// prefix returns the number of items in slots 0..i.
+func (f *fenwick) prefix(i int) int {
+	n := 0
+	for i++; i > 0; i -= i & -i {
+		n += f.tree[i]
+	}
+	return n
+}
+
+// slotOf returns the slot holding the k-th item (1-based, in slot order),
+// i.e. the smallest slot whose prefix count reaches k.
+func (f *fenwick) slotOf(k int) int {
+	pos := 0
+	for step := 1 << (bits.Len(uint(len(f.tree)-1)) - 1); step > 0; step >>= 1 {
+		if next := pos + step; next < len(f.tree) && f.tree[next] < k {
+			pos = next
+			k -= f.tree[next]
+		}
+	}
+	return pos // 1-based pos+1 is the answer, which is slot pos
+}
+
+// last returns the highest non-empty slot in [lo, hi], or -1.
+func (f *fenwick) last(lo, hi int) int {
+	if hi < lo {
+		return -1
+	}
+	k := f.prefix(hi)
+	if k == f.prefix(lo-1) {
+		return -1
+	}
+	return f.slotOf(k)
+}
+
+// first returns the lowest non-empty slot in [lo, hi], or -1.
+func (f *fenwick) first(lo, hi int) int {
+	if hi < lo {
+		return -1
+	}
+	k := f.prefix(lo-1) + 1
+	if k > f.prefix(hi) {
+		return -1
+	}
+	return f.slotOf(k)
+}
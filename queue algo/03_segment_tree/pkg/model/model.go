@@ -1,10 +1,19 @@
 package model
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type Job struct {
 	ID     string
 	SizeMB int
+	// Duration is how long the job runs once packed onto a worker (used by simulations).
+	Duration time.Duration
+	// StartedAt is when the job was packed onto its current worker (zero while queued).
+	StartedAt time.Time
+	// Attempts counts how many times the job has failed and been requeued.
+	Attempts int
 }
 
 func (j *Job) String() string {
@@ -18,6 +27,18 @@ type Worker struct {
 	CurrentJobs []*Job
 }
 
+// Remove takes the job with the given ID off the worker and frees its memory.
+func (w *Worker) Remove(jobID string) (*Job, bool) {
+	for i, j := range w.CurrentJobs {
+		if j.ID == jobID {
+			w.CurrentJobs = append(w.CurrentJobs[:i], w.CurrentJobs[i+1:]...)
+			w.UsedMemory -= j.SizeMB
+			return j, true
+		}
+	}
+	return nil, false
+}
+
 func (w *Worker) AvailableMemory() int {
 	return w.CapacityMB - w.UsedMemory
 }
@@ -1,102 +1,238 @@
 package model
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 const BucketInterval = 50
 
-type Node struct {
-	Count       int // Number of jobs in this range
-	MinSize     int
-	MaxSize     int
-	Left, Right *Node
-	Bucket      *JobBucket // Only for leaves
-}
+var ErrDuplicateJob = errors.New("a job with this ID is already queued")
 
+// SegmentTree indexes the job buckets by size so the heaviest job in a size range is found in
+// O(log B) for B buckets.
+//
+// It is implicit: bucket i covers sizes [i*BucketInterval, (i+1)*BucketInterval), so the ranges
+// are contiguous with no gaps, and the only tree is a Fenwick (binary indexed) tree of per-bucket
+// job counts in one []int. Updates and queries are loops over that array, with no per-node
+// allocation and no pointer chasing. Jobs larger than MaxSize go to the last bucket.
 type SegmentTree struct {
-	Root    *Node
 	MaxSize int
+	Buckets []JobBucket
+
+	counts fenwick             // jobs per bucket
+	ids    map[string]struct{} // IDs of the queued jobs, so AddJob can turn duplicates away
+	// durations is the memory x duration index for FindHeaviestWithin. It is built on the
+	// first such query and kept in step from then on, so trees that never use it pay nothing.
+	durations *durationIndex
 }
 
 func NewSegmentTree(maxSizeMB int) *SegmentTree {
-	st := &SegmentTree{MaxSize: maxSizeMB}
-	st.Root = buildTree(0, maxSizeMB)
+	n := maxSizeMB/BucketInterval + 1
+	st := &SegmentTree{MaxSize: maxSizeMB, Buckets: make([]JobBucket, n), counts: newFenwick(n), ids: make(map[string]struct{})}
+	for i := range st.Buckets {
+		st.Buckets[i].MinSize = i * BucketInterval
+		st.Buckets[i].MaxSize = (i + 1) * BucketInterval
+	}
 	return st
 }
 
-func buildTree(min, max int) *Node {
-	node := &Node{MinSize: min, MaxSize: max}
-	if max-min <= BucketInterval {
-		node.Bucket = &JobBucket{MinSize: min, MaxSize: max}
-		return node
+// bucketOf returns the index of the bucket sizeMB falls in, clamped to the valid range.
+func (st *SegmentTree) bucketOf(sizeMB int) int {
+	i := sizeMB / BucketInterval
+	switch {
+	case i < 0:
+		return 0
+	case i >= len(st.Buckets):
+		return len(st.Buckets) - 1
 	}
-	mid := min + (max-min)/2
-	node.Left = buildTree(min, mid)
-	node.Right = buildTree(mid+1, max)
-	return node
+	return i
 }
 
-// AddJob updates the tree in O(log B)
-func (st *SegmentTree) AddJob(j *Job) {
-	update(st.Root, j, 1)
-}
-
-func update(n *Node, j *Job, delta int) {
-	n.Count += delta
-	if n.Bucket != nil {
-		if delta > 0 {
-			n.Bucket.Push(j)
-		}
-		return
+// AddJob updates the tree in O(log B). A job whose ID is already queued is rejected: Remove and
+// the buckets find jobs by ID, so two queued jobs must never share one.
+func (st *SegmentTree) AddJob(j *Job) error {
+	if _, ok := st.ids[j.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateJob, j.ID)
 	}
-	mid := n.MinSize + (n.MaxSize-n.MinSize)/2
-	if j.SizeMB <= mid {
-		update(n.Left, j, delta)
-	} else {
-		update(n.Right, j, delta)
+	st.ids[j.ID] = struct{}{}
+	i := st.bucketOf(j.SizeMB)
+	st.Buckets[i].Push(j)
+	st.counts.add(i, 1)
+	if st.durations != nil {
+		st.durations.add(i, j)
 	}
+	return nil
 }
 
-// FindHeaviest finds the best job <= capacity in O(log B)
+// FindHeaviest removes and returns a job with minSize <= SizeMB <= capacity from the highest
+// non-empty bucket in that range (oldest first within a bucket), in O(log B).
+// Only the buckets at the two ends of the range can hold jobs outside it; they are filtered.
 func (st *SegmentTree) FindHeaviest(capacity, minSize int) *Job {
-	return query(st.Root, capacity, minSize)
+	if minSize > capacity {
+		return nil
+	}
+	lo, hi := st.bucketOf(minSize), st.bucketOf(capacity)
+	inRange := func(j *Job) bool { return j.SizeMB >= minSize && j.SizeMB <= capacity }
+
+	// The capacity's own bucket may hold jobs that are too big.
+	if j := st.popFrom(hi, inRange); j != nil {
+		return j
+	}
+	i := st.counts.last(lo, hi-1)
+	if i < 0 {
+		return nil
+	}
+	return st.popFrom(i, inRange)
 }
 
-func query(n *Node, cap, min int) *Job {
-	// Optimization: If this branch has no jobs, or the range is completely outside our search, skip it.
-	if n.Count == 0 || n.MinSize > cap || n.MaxSize < min {
+// popFrom takes the oldest job of bucket i accepted by ok.
+func (st *SegmentTree) popFrom(i int, ok func(*Job) bool) *Job {
+	b := &st.Buckets[i]
+	if b.IsEmpty() {
+		return nil
+	}
+	j := b.Peek()
+	if ok(j) {
+		b.Pop()
+	} else if j = b.PopFirst(ok); j == nil {
 		return nil
 	}
+	st.counts.add(i, -1)
+	delete(st.ids, j.ID)
+	if st.durations != nil {
+		st.durations.remove(i, j)
+	}
+	return j
+}
 
-	// If leaf, try to pop a job
-	if n.Bucket != nil {
-		j := n.Bucket.Pop()
-		if j != nil {
-			n.Count--
+// FindHeaviestWithin is FindHeaviest with a time limit: it removes and returns a job with
+// minSize <= SizeMB <= capacity and a known Duration of at most maxDuration, from the highest
+// bucket that has one, in O(log B * log D) for D duration cells. Within that bucket it takes
+// the longest job (to the DurationInterval) that still finishes in time, oldest first.
+// Jobs without a Duration never qualify, since nothing says when they would finish.
+func (st *SegmentTree) FindHeaviestWithin(capacity, minSize int, maxDuration time.Duration) *Job {
+	if minSize > capacity || maxDuration <= 0 {
+		return nil
+	}
+	if st.durations == nil {
+		st.durations = newDurationIndex(len(st.Buckets))
+		for i := range st.Buckets {
+			st.Buckets[i].Each(func(j *Job) bool {
+				st.durations.add(i, j)
+				return true
+			})
 		}
-		return j
 	}
+	lo, hi := st.bucketOf(minSize), st.bucketOf(capacity)
+	ok := func(j *Job) bool {
+		return j.SizeMB >= minSize && j.SizeMB <= capacity && j.Duration > 0 && j.Duration <= maxDuration
+	}
+	i, j := st.durations.take(lo, hi, cellOf(maxDuration), ok)
+	if j == nil {
+		return nil
+	}
+	st.Buckets[i].Remove(j.ID)
+	st.counts.add(i, -1)
+	delete(st.ids, j.ID)
+	return j
+}
 
-	// Try Right (Heavier) branch first to find the best fit
-	job := query(n.Right, cap, min)
-	if job == nil {
-		// Fallback to Left (Lighter) branch
-		job = query(n.Left, cap, min)
+// Remove takes a specific queued job out of the tree.
+func (st *SegmentTree) Remove(j *Job) bool {
+	i := st.bucketOf(j.SizeMB)
+	if _, ok := st.Buckets[i].Remove(j.ID); !ok {
+		return false
+	}
+	st.counts.add(i, -1)
+	delete(st.ids, j.ID)
+	if st.durations != nil {
+		st.durations.remove(i, j)
 	}
+	return true
+}
 
-	if job != nil {
-		n.Count--
+// Candidates returns up to perBucket of the oldest jobs of every non-empty bucket,
+// keeping only jobs of at most maxSize, heaviest bucket first. Empty buckets are skipped
+// through the count tree, so it costs O(log B) per non-empty bucket visited.
+func (st *SegmentTree) Candidates(maxSize, perBucket int) []*Job {
+	var out []*Job
+	for i := st.counts.last(0, st.bucketOf(maxSize)); i >= 0; i = st.counts.last(0, i-1) {
+		n := 0
+		st.Buckets[i].Each(func(j *Job) bool {
+			if j.SizeMB <= maxSize {
+				out = append(out, j)
+				n++
+			}
+			return n < perBucket
+		})
 	}
-	return job
+	return out
 }
 
+// TotalJobsInRange counts the jobs in the buckets that hold sizes min through max, in O(log B).
 func (st *SegmentTree) TotalJobsInRange(min, max int) int {
-	return countRange(st.Root, min, max)
+	lo, hi := st.bucketOf(min), st.bucketOf(max)
+	if hi < lo {
+		return 0
+	}
+	return st.counts.prefix(hi) - st.counts.prefix(lo-1)
 }
 
-func countRange(n *Node, min, max int) int {
-	if n == nil || n.MinSize > max || n.MaxSize < min {
-		return 0
+// Contains reports whether a job with this ID is queued.
+func (st *SegmentTree) Contains(id string) bool {
+	_, ok := st.ids[id]
+	return ok
+}
+
+// Len is the number of queued jobs.
+func (st *SegmentTree) Len() int {
+	return st.counts.total
+}
+
+// Validate checks the tree's invariants and returns the first one broken, or nil:
+// every bucket covers its own range and only holds jobs of that range, the count tree agrees
+// with the bucket lengths (which pins down every Fenwick entry), and the duration index, if
+// built, holds exactly the same jobs. It is O(n + B) and meant for tests and debugging.
+func (st *SegmentTree) Validate() error {
+	if len(st.counts.tree) != len(st.Buckets)+1 {
+		return fmt.Errorf("count tree has %d slots for %d buckets", len(st.counts.tree)-1, len(st.Buckets))
+	}
+	total := 0
+	for i := range st.Buckets {
+		b := &st.Buckets[i]
+		if b.MinSize != i*BucketInterval || b.MaxSize != (i+1)*BucketInterval {
+			return fmt.Errorf("bucket %d covers [%d, %d)", i, b.MinSize, b.MaxSize)
+		}
+		n := 0
+		var stray *Job
+		b.Each(func(j *Job) bool {
+			n++
+			if st.bucketOf(j.SizeMB) != i {
+				stray = j
+			}
+			return stray == nil
+		})
+		if stray != nil {
+			return fmt.Errorf("bucket %d holds %s", i, stray)
+		}
+		if n != b.Len() {
+			return fmt.Errorf("bucket %d has %d jobs but Len %d", i, n, b.Len())
+		}
+		if c := st.counts.prefix(i) - st.counts.prefix(i-1); c != n {
+			return fmt.Errorf("bucket %d has %d jobs but the count tree says %d", i, n, c)
+		}
+		total += n
+	}
+	if total != st.counts.total {
+		return fmt.Errorf("%d jobs queued but the count tree total is %d", total, st.counts.total)
+	}
+	if len(st.ids) != total {
+		return fmt.Errorf("%d jobs queued but %d IDs indexed", total, len(st.ids))
 	}
-	if n.MinSize >= min && n.MaxSize <= max {
-		return n.Count
+	if st.durations != nil {
+		return st.durations.validate(st)
 	}
-	return countRange(n.Left, min, max) + countRange(n.Right, min, max)
+	return nil
 }
@@ -0,0 +1,139 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// legacyNode / legacyTree are the old pointer-based segment tree, kept here only to benchmark
+// against: one *Node per range, recursive descent through Left/Right, and a right child that
+// starts at mid+1.
+type legacyNode struct {
+	Count            int
+	MinSize, MaxSize int
+	Left, Right      *legacyNode
+	Bucket           *JobBucket
+}
+
+type legacyTree struct {
+	Root *legacyNode
+}
+
+func newLegacyTree(maxSizeMB int) *legacyTree {
+	return &legacyTree{Root: legacyBuild(0, maxSizeMB)}
+}
+
+func legacyBuild(min, max int) *legacyNode {
+	node := &legacyNode{MinSize: min, MaxSize: max}
+	if max-min <= BucketInterval {
+		node.Bucket = &JobBucket{MinSize: min, MaxSize: max}
+		return node
+	}
+	mid := min + (max-min)/2
+	node.Left = legacyBuild(min, mid)
+	node.Right = legacyBuild(mid+1, max)
+	return node
+}
+
+// AddJob never fails: the legacy tree had no ID index to check for duplicates.
+func (t *legacyTree) AddJob(j *Job) error {
+	legacyUpdate(t.Root, j)
+	return nil
+}
+
+func legacyUpdate(n *legacyNode, j *Job) {
+	n.Count++
+	if n.Bucket != nil {
+		n.Bucket.Push(j)
+		return
+	}
+	if j.SizeMB <= n.MinSize+(n.MaxSize-n.MinSize)/2 {
+		legacyUpdate(n.Left, j)
+	} else {
+		legacyUpdate(n.Right, j)
+	}
+}
+
+func (t *legacyTree) FindHeaviest(capacity, minSize int) *Job {
+	return legacyQuery(t.Root, capacity, minSize)
+}
+
+func legacyQuery(n *legacyNode, cap, min int) *Job {
+	if n.Count == 0 || n.MinSize > cap || n.MaxSize < min {
+		return nil
+	}
+	if n.Bucket != nil {
+		j := n.Bucket.Pop()
+		if j != nil {
+			n.Count--
+		}
+		return j
+	}
+	job := legacyQuery(n.Right, cap, min)
+	if job == nil {
+		job = legacyQuery(n.Left, cap, min)
+	}
+	if job != nil {
+		n.Count--
+	}
+	return job
+}
+
+type benchTree interface {
+	AddJob(*Job) error
+	FindHeaviest(capacity, minSize int) *Job
+}
+
+var benchTrees = []struct {
+	name  string
+	build func(maxSizeMB int) benchTree
+}{
+	{"pointer", func(maxSizeMB int) benchTree { return newLegacyTree(maxSizeMB) }},
+	{"array", func(maxSizeMB int) benchTree { return NewSegmentTree(maxSizeMB) }},
+}
+
+var benchBuckets = []int{1_000, 64_000, 1_000_000}
+
+// BenchmarkFindHeaviest runs the same steady-state workload on both trees: the tree holds 10k
+// jobs of random sizes, and every op takes the heaviest job under a random capacity and adds
+// it back.
+func BenchmarkFindHeaviest(b *testing.B) {
+	for _, tree := range benchTrees {
+		for _, buckets := range benchBuckets {
+			b.Run(fmt.Sprintf("%s/B=%d", tree.name, buckets), func(b *testing.B) {
+				maxSize := buckets * BucketInterval
+				r := rand.New(rand.NewSource(1))
+				t := tree.build(maxSize)
+				for i := 0; i < 10_000; i++ {
+					t.AddJob(&Job{ID: fmt.Sprintf("B%d", i), SizeMB: r.Intn(maxSize)})
+				}
+				caps := make([]int, 4096)
+				for i := range caps {
+					caps[i] = r.Intn(maxSize)
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if j := t.FindHeaviest(caps[i%len(caps)], 0); j != nil {
+						t.AddJob(j)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkBuildTree measures building an empty tree of each kind.
+func BenchmarkBuildTree(b *testing.B) {
+	for _, tree := range benchTrees {
+		for _, buckets := range benchBuckets {
+			b.Run(fmt.Sprintf("%s/B=%d", tree.name, buckets), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					tree.build(buckets * BucketInterval)
+				}
+			})
+		}
+	}
+}
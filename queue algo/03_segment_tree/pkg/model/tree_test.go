@@ -0,0 +1,182 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// choices is where a run of tree operations gets its random numbers: a seeded *rand.Rand for
+// the randomized test, fuzz bytes for the fuzz test.
+type choices interface {
+	Intn(n int) int
+}
+
+// fuzzChoices reads two bytes per choice; once the bytes run out every choice is 0.
+type fuzzChoices struct {
+	data []byte
+}
+
+func (c *fuzzChoices) Intn(n int) int {
+	if len(c.data) < 2 {
+		return 0
+	}
+	v := int(c.data[0])<<8 | int(c.data[1])
+	c.data = c.data[2:]
+	return v % n
+}
+
+// runOps runs ops random AddJob / FindHeaviest / FindHeaviestWithin / Remove / TotalJobsInRange
+// calls on a tree of random size and compares every answer with a plain slice of the queued
+// jobs in arrival order, calling Validate after each call. It returns the first mismatch.
+func runOps(c choices, ops int) error {
+	st := NewSegmentTree(500 + c.Intn(4000))
+	bucket := func(size int) int { return min(max(size/BucketInterval, 0), len(st.Buckets)-1) }
+	cell := func(d time.Duration) int {
+		if d <= 0 || d >= MaxIndexedDuration {
+			return int(MaxIndexedDuration / DurationInterval)
+		}
+		return int(d / DurationInterval)
+	}
+	var queue []*Job // reference: queued jobs in arrival order
+	// heaviest is the job the tree must return: highest bucket (then longest duration cell
+	// if byCell), oldest first, among the jobs ok accepts.
+	heaviest := func(ok func(*Job) bool, byCell bool) int {
+		best := -1
+		for k, j := range queue {
+			if !ok(j) {
+				continue
+			}
+			if best < 0 || bucket(j.SizeMB) > bucket(queue[best].SizeMB) ||
+				byCell && bucket(j.SizeMB) == bucket(queue[best].SizeMB) && cell(j.Duration) > cell(queue[best].Duration) {
+				best = k
+			}
+		}
+		return best
+	}
+	check := func(op string, got *Job, want int) error {
+		if want < 0 {
+			if got != nil {
+				return fmt.Errorf("%s returned %s, want nil", op, got)
+			}
+			return nil
+		}
+		if got != queue[want] {
+			return fmt.Errorf("%s returned %v, want %s", op, got, queue[want])
+		}
+		queue = append(queue[:want], queue[want+1:]...)
+		return nil
+	}
+
+	for n := 0; n < ops; n++ {
+		var err error
+		switch op := c.Intn(10); {
+		case op < 4:
+			j := &Job{ID: fmt.Sprintf("J%d", n), SizeMB: c.Intn(st.MaxSize + 200)}
+			if c.Intn(8) > 0 {
+				j.Duration = time.Duration(c.Intn(700)) * time.Second
+			}
+			st.AddJob(j)
+			queue = append(queue, j)
+		case op < 6:
+			capacity, minSize := c.Intn(st.MaxSize+100), c.Intn(600)
+			in := func(j *Job) bool { return j.SizeMB >= minSize && j.SizeMB <= capacity }
+			err = check(fmt.Sprintf("FindHeaviest(%d, %d)", capacity, minSize),
+				st.FindHeaviest(capacity, minSize), heaviest(in, false))
+		case op < 8:
+			capacity, minSize := c.Intn(st.MaxSize+100), c.Intn(600)
+			within := time.Duration(c.Intn(800)) * time.Second
+			in := func(j *Job) bool {
+				return j.SizeMB >= minSize && j.SizeMB <= capacity && j.Duration > 0 && j.Duration <= within
+			}
+			err = check(fmt.Sprintf("FindHeaviestWithin(%d, %d, %s)", capacity, minSize, within),
+				st.FindHeaviestWithin(capacity, minSize, within), heaviest(in, true))
+		case op < 9:
+			if len(queue) > 0 {
+				k := c.Intn(len(queue))
+				if !st.Remove(queue[k]) {
+					err = fmt.Errorf("Remove(%s) found nothing", queue[k])
+				}
+				queue = append(queue[:k], queue[k+1:]...)
+			}
+		default:
+			lo, hi := c.Intn(st.MaxSize), c.Intn(st.MaxSize)
+			want := 0
+			for _, j := range queue {
+				if b := bucket(j.SizeMB); b >= bucket(lo) && b <= bucket(hi) {
+					want++
+				}
+			}
+			if got := st.TotalJobsInRange(lo, hi); got != want {
+				err = fmt.Errorf("TotalJobsInRange(%d, %d) = %d, want %d", lo, hi, got, want)
+			}
+		}
+		if err == nil && st.Len() != len(queue) {
+			err = fmt.Errorf("Len %d, want %d", st.Len(), len(queue))
+		}
+		if err == nil {
+			err = st.Validate()
+		}
+		if err != nil {
+			return fmt.Errorf("op %d: %w", n+1, err)
+		}
+	}
+	return nil
+}
+
+func TestSegmentTreeRandomOps(t *testing.T) {
+	seeds := 100
+	if testing.Short() {
+		seeds = 10
+	}
+	for seed := int64(1); seed <= int64(seeds); seed++ {
+		if err := runOps(rand.New(rand.NewSource(seed)), 1000); err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+	}
+}
+
+func FuzzSegmentTree(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{0, 7, 0, 1, 0, 200, 0, 3, 1, 0, 0, 5, 0, 100, 0, 0, 0, 9, 1, 1})
+	f.Add([]byte("a fuzzed mix of adds, finds, removes and range counts"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := runOps(&fuzzChoices{data: data}, len(data)/2); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// The tree refuses a second queued job with the same ID, and takes the ID again once the
+// first has left by any route: FindHeaviest, FindHeaviestWithin or Remove.
+func TestSegmentTreeRejectsDuplicateIDs(t *testing.T) {
+	st := NewSegmentTree(1000)
+	j := &Job{ID: "J", SizeMB: 300, Duration: time.Minute}
+	leave := map[string]func() bool{
+		"FindHeaviest":       func() bool { return st.FindHeaviest(1000, 0) == j },
+		"FindHeaviestWithin": func() bool { return st.FindHeaviestWithin(1000, 0, time.Hour) == j },
+		"Remove":             func() bool { return st.Remove(j) },
+	}
+	for name, take := range leave {
+		if err := st.AddJob(j); err != nil {
+			t.Fatalf("before %s: %v", name, err)
+		}
+		if err := st.AddJob(&Job{ID: "J", SizeMB: 700}); !errors.Is(err, ErrDuplicateJob) {
+			t.Fatalf("second J: %v, want ErrDuplicateJob", err)
+		}
+		if !st.Contains("J") || st.Len() != 1 {
+			t.Fatalf("Contains(J) = %v with %d queued, want true with 1", st.Contains("J"), st.Len())
+		}
+		if !take() {
+			t.Fatalf("%s did not take J", name)
+		}
+		if st.Contains("J") {
+			t.Fatalf("J still indexed after %s", name)
+		}
+		if err := st.Validate(); err != nil {
+			t.Fatalf("after %s: %v", name, err)
+		}
+	}
+}
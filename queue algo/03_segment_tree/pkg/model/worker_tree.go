@@ -0,0 +1,179 @@
+package model
+
+// WorkerTree is the worker-side counterpart of SegmentTree: it keeps the workers ordered by
+// available memory, so "which worker has the least free memory that still fits this 1200MB
+// job" is one walk down the tree, O(log W) for W workers however large their memory is.
+//
+// It is a treap: a binary search tree on (free memory, filing order) whose nodes also carry a
+// pseudo-random priority kept in heap order, which keeps the tree balanced in expectation
+// without any rotation bookkeeping. Workers with the same free memory come out in the order
+// they were filed. It holds one node per worker, O(W).
+//
+// Call Update whenever a worker's UsedMemory changes.
+type WorkerTree struct {
+	root  *workerNode
+	nodes map[*Worker]*workerNode
+	seq   uint64 // filings so far: orders equal free amounts and seeds the priorities
+}
+
+type workerNode struct {
+	w           *Worker
+	free        int // the available memory w is filed under
+	seq         uint64
+	prio        uint64
+	left, right *workerNode
+}
+
+// before reports whether n sorts before m: less free memory, or filed earlier.
+func (n *workerNode) before(m *workerNode) bool {
+	return n.free < m.free || n.free == m.free && n.seq < m.seq
+}
+
+func NewWorkerTree() *WorkerTree {
+	return &WorkerTree{nodes: make(map[*Worker]*workerNode)}
+}
+
+func (t *WorkerTree) Len() int {
+	return len(t.nodes)
+}
+
+// Add files w under its current available memory (re-filing it if it is already in the tree).
+func (t *WorkerTree) Add(w *Worker) {
+	t.Remove(w)
+	t.seq++
+	n := &workerNode{w: w, free: w.AvailableMemory(), seq: t.seq, prio: treapPriority(t.seq)}
+	t.nodes[w] = n
+	t.root = insertNode(t.root, n)
+}
+
+// Remove takes w out of the tree.
+func (t *WorkerTree) Remove(w *Worker) {
+	n, ok := t.nodes[w]
+	if !ok {
+		return
+	}
+	t.root = removeNode(t.root, n)
+	delete(t.nodes, w)
+}
+
+// Update re-files w after its UsedMemory changed. A worker whose free memory did not change
+// keeps its place.
+func (t *WorkerTree) Update(w *Worker) {
+	if n, ok := t.nodes[w]; ok && n.free == w.AvailableMemory() {
+		return
+	}
+	t.Add(w)
+}
+
+// BestFit returns the worker with the least available memory >= sizeMB that ok accepts
+// (nil accepts all), or nil. With ok == nil it is O(log W). Otherwise the workers are visited
+// in order from the best fit on, so each one ok rejects adds to the cost: a filter that rejects
+// many workers makes it linear in them, so keep such workers in a tree of their own.
+func (t *WorkerTree) BestFit(sizeMB int, ok func(*Worker) bool) *Worker {
+	if sizeMB < 0 {
+		sizeMB = 0
+	}
+	var walk func(n *workerNode) *Worker
+	walk = func(n *workerNode) *Worker {
+		if n == nil {
+			return nil
+		}
+		if n.free < sizeMB {
+			return walk(n.right)
+		}
+		if w := walk(n.left); w != nil {
+			return w
+		}
+		if ok == nil || ok(n.w) {
+			return n.w
+		}
+		return walk(n.right)
+	}
+	return walk(t.root)
+}
+
+// Largest returns the worker with the most available memory that ok accepts
+// (nil accepts all), or nil. It costs the same as BestFit.
+func (t *WorkerTree) Largest(ok func(*Worker) bool) *Worker {
+	var walk func(n *workerNode) *Worker
+	walk = func(n *workerNode) *Worker {
+		if n == nil {
+			return nil
+		}
+		if w := walk(n.right); w != nil {
+			return w
+		}
+		if ok == nil || ok(n.w) {
+			return n.w
+		}
+		return walk(n.left)
+	}
+	return walk(t.root)
+}
+
+// insertNode adds n to the subtree at root and returns the new root.
+func insertNode(root, n *workerNode) *workerNode {
+	if root == nil {
+		return n
+	}
+	if n.prio > root.prio {
+		n.left, n.right = splitNode(root, n)
+		return n
+	}
+	if n.before(root) {
+		root.left = insertNode(root.left, n)
+	} else {
+		root.right = insertNode(root.right, n)
+	}
+	return root
+}
+
+// splitNode divides the subtree at root into the nodes that sort before n and those after it.
+func splitNode(root, n *workerNode) (before, after *workerNode) {
+	if root == nil {
+		return nil, nil
+	}
+	if root.before(n) {
+		root.right, after = splitNode(root.right, n)
+		return root, after
+	}
+	before, root.left = splitNode(root.left, n)
+	return before, root
+}
+
+// removeNode takes n out of the subtree at root and returns the new root.
+func removeNode(root, n *workerNode) *workerNode {
+	if root == n {
+		return mergeNodes(n.left, n.right)
+	}
+	if n.before(root) {
+		root.left = removeNode(root.left, n)
+	} else {
+		root.right = removeNode(root.right, n)
+	}
+	return root
+}
+
+// mergeNodes joins two subtrees where every node of a sorts before every node of b.
+func mergeNodes(a, b *workerNode) *workerNode {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.prio > b.prio:
+		a.right = mergeNodes(a.right, b)
+		return a
+	}
+	b.left = mergeNodes(a, b.left)
+	return b
+}
+
+// treapPriority is splitmix64: it turns the filing counter into a well-spread but
+// reproducible priority.
+func treapPriority(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
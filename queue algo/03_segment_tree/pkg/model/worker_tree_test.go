@@ -0,0 +1,161 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// scanBestFit is the linear reference for WorkerTree.BestFit.
+func scanBestFit(workers []*Worker, sizeMB int, ok func(*Worker) bool) *Worker {
+	var best *Worker
+	for _, w := range workers {
+		if free := w.AvailableMemory(); free >= sizeMB && (ok == nil || ok(w)) &&
+			(best == nil || free < best.AvailableMemory()) {
+			best = w
+		}
+	}
+	return best
+}
+
+func TestWorkerTreeMatchesScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tree := NewWorkerTree()
+	var workers []*Worker
+	even := func(w *Worker) bool { return w.UsedMemory%2 == 0 }
+	for op := 0; op < 20_000; op++ {
+		switch k := r.Intn(10); {
+		case k < 3 || len(workers) == 0:
+			w := &Worker{ID: fmt.Sprintf("W%d", op), CapacityMB: 500 + r.Intn(2000)}
+			w.UsedMemory = r.Intn(w.CapacityMB + 1)
+			tree.Add(w)
+			workers = append(workers, w)
+		case k < 4:
+			i := r.Intn(len(workers))
+			tree.Remove(workers[i])
+			workers = append(workers[:i], workers[i+1:]...)
+		case k < 7:
+			w := workers[r.Intn(len(workers))]
+			w.UsedMemory = r.Intn(w.CapacityMB + 1)
+			tree.Update(w)
+		default:
+			size := r.Intn(2500)
+			for _, ok := range []func(*Worker) bool{nil, even} {
+				got, want := tree.BestFit(size, ok), scanBestFit(workers, size, ok)
+				if (got == nil) != (want == nil) || got != nil && got.AvailableMemory() != want.AvailableMemory() {
+					t.Fatalf("op %d: BestFit(%d) = %v, want %v", op, size, got, want)
+				}
+			}
+			most := 0
+			for _, w := range workers {
+				most = max(most, w.AvailableMemory())
+			}
+			if got := tree.Largest(nil); got.AvailableMemory() != most {
+				t.Fatalf("op %d: Largest has %dMB free, want %dMB", op, got.AvailableMemory(), most)
+			}
+		}
+		if tree.Len() != len(workers) {
+			t.Fatalf("op %d: Len %d, want %d", op, tree.Len(), len(workers))
+		}
+	}
+}
+
+// height is the depth of the deepest node under n.
+func height(n *workerNode) int {
+	if n == nil {
+		return 0
+	}
+	return 1 + max(height(n.left), height(n.right))
+}
+
+// The tree stays O(log W) deep under churn: 100k workers, every one re-filed ten times.
+func TestWorkerTreeStaysBalanced(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	tree := NewWorkerTree()
+	workers := make([]*Worker, 100_000)
+	for i := range workers {
+		workers[i] = &Worker{ID: fmt.Sprintf("W%d", i), CapacityMB: 16384, UsedMemory: r.Intn(16385)}
+		tree.Add(workers[i])
+	}
+	for i := 0; i < 10*len(workers); i++ {
+		w := workers[r.Intn(len(workers))]
+		w.UsedMemory = r.Intn(w.CapacityMB + 1)
+		tree.Update(w)
+	}
+	// A random treap of n nodes is about 4.3*ln(n) deep, ~50 for 100k; a degenerate one is n.
+	if h := height(tree.root); h > 3*50 {
+		t.Fatalf("height %d for %d workers", h, tree.Len())
+	}
+}
+
+// Update leaves a worker whose free memory is unchanged where it is, overcommitted or not,
+// so it keeps its turn among workers with the same free memory.
+func TestWorkerTreeUpdateKeepsPlace(t *testing.T) {
+	tree := NewWorkerTree()
+	over := &Worker{ID: "Over", CapacityMB: 1000, UsedMemory: 1200}
+	a := &Worker{ID: "A", CapacityMB: 1000, UsedMemory: 600}
+	b := &Worker{ID: "B", CapacityMB: 1000, UsedMemory: 600}
+	for _, w := range []*Worker{over, a, b} {
+		tree.Add(w)
+	}
+	filed := tree.nodes[over]
+	tree.Update(over)
+	tree.Update(a)
+	if tree.nodes[over] != filed {
+		t.Fatal("Update re-filed an overcommitted worker whose memory did not change")
+	}
+	if w := tree.BestFit(400, nil); w != a {
+		t.Fatalf("BestFit(400) = %v, want A (filed before B)", w)
+	}
+	if w := tree.BestFit(0, nil); w != a {
+		t.Fatalf("BestFit(0) = %v, want A: Over has no free memory", w)
+	}
+	a.UsedMemory = 500
+	tree.Update(a)
+	a.UsedMemory = 600
+	tree.Update(a) // back to 400MB free, now filed after B
+	if w := tree.BestFit(400, nil); w != b {
+		t.Fatalf("BestFit(400) = %v, want B", w)
+	}
+}
+
+// BenchmarkBestFit compares finding the best-fitting worker (least free memory that fits) by
+// scanning every worker against the WorkerTree, for W workers of 16GB. Every op looks up a
+// worker for a random job size and then changes that worker's used memory.
+func BenchmarkBestFit(b *testing.B) {
+	for _, w := range []int{1_000, 100_000} {
+		r := rand.New(rand.NewSource(2))
+		workers := make([]*Worker, w)
+		for i := range workers {
+			workers[i] = &Worker{ID: fmt.Sprintf("W%d", i), CapacityMB: 16384, UsedMemory: r.Intn(16385)}
+		}
+		sizes := make([]int, 4096)
+		for i := range sizes {
+			sizes[i] = r.Intn(4096)
+		}
+		churn := func(w *Worker, i int) {
+			w.UsedMemory = (w.UsedMemory + 7919*(i+1)) % (w.CapacityMB + 1)
+		}
+
+		b.Run(fmt.Sprintf("scan/W=%d", w), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if best := scanBestFit(workers, sizes[i%len(sizes)], nil); best != nil {
+					churn(best, i)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("tree/W=%d", w), func(b *testing.B) {
+			tree := NewWorkerTree()
+			for _, w := range workers {
+				tree.Add(w)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if best := tree.BestFit(sizes[i%len(sizes)], nil); best != nil {
+					churn(best, i)
+					tree.Update(best)
+				}
+			}
+		})
+	}
+}